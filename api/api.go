@@ -0,0 +1,14 @@
+// Package api holds the OpenAPI document of the order API.
+// orderclient is generated from it, run `go generate ./api` after changing openapi.json.
+// orderpb is generated from proto/orders/v1/orders.proto, it needs protoc with protoc-gen-go and protoc-gen-go-grpc.
+package api
+
+import _ "embed"
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.5.1 -config oapi-codegen.yaml openapi.json
+//go:generate protoc -I proto --go_out=module=MockOrderService:.. --go-grpc_out=module=MockOrderService:.. orders/v1/orders.proto
+
+// OpenAPI is the OpenAPI 3 document in JSON
+//
+//go:embed openapi.json
+var OpenAPI []byte
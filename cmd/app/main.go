@@ -2,25 +2,38 @@ package main
 
 import (
 	"MockOrderService/config"
+	"MockOrderService/internal/auth"
+	graphqldelivery "MockOrderService/internal/delivery/graphql"
+	grpcdelivery "MockOrderService/internal/delivery/grpc"
 	httpdelivery "MockOrderService/internal/delivery/http"
 	"MockOrderService/internal/delivery/kafka"
+	"MockOrderService/internal/encryption"
 	kafkaInfra "MockOrderService/internal/infra/kafka"
 	"MockOrderService/internal/infra/postgres"
 	"MockOrderService/internal/infra/redis"
+	"MockOrderService/internal/infra/spool"
 	"MockOrderService/internal/logger"
 	"MockOrderService/internal/monitoring"
+	"MockOrderService/internal/ratelimit"
 	postgresRepo "MockOrderService/internal/repository/postgres"
 	redisRepo "MockOrderService/internal/repository/redis"
 	"MockOrderService/internal/service"
+	"MockOrderService/internal/tracing"
 	"context"
+	"errors"
 	"fmt"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"log"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
+// recentErrors is the amount of logged errors kept for the operations page
+const recentErrors = 50
+
 func main() {
 	// Initiating logger
 	sugar, err := logger.NewLogger()
@@ -28,6 +41,11 @@ func main() {
 		log.Fatalf("cannot init logger %v", err)
 		return
 	}
+	// the latest errors are shown on the operations page
+	errorLog := monitoring.NewErrorLog(recentErrors)
+	sugar = sugar.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, errorLog)
+	}))
 	defer sugar.Sync()
 
 	cfg, err := config.Load()
@@ -40,6 +58,20 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// spans go from kafka messages through db and cache calls to http responses
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		File:        cfg.TracingFile,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		sugar.Fatalw("failed to initialize tracing", "error", err)
+		return
+	}
+	if cfg.TracingExporter != tracing.ExporterNone {
+		sugar.Infow("tracing is enabled", "exporter", cfg.TracingExporter, "sampleRatio", cfg.TracingSampleRatio)
+	}
+
 	pgClient, err := postgres.NewClient(cfg, ctx)
 	if err != nil {
 		sugar.Fatalw("failed to initialize PostgreSQL client", "error", err)
@@ -58,27 +90,182 @@ func main() {
 	kafkaClient := kafkaInfra.NewClient(cfg.KafkaBroker, cfg.KafkaGroupId, cfg.KafkaTopic)
 	defer kafkaClient.Close()
 
-	orderRepo := postgresRepo.NewOrderRepository(pgClient.Pool)
-	cacheRepo := redisRepo.NewCacheRepository(redisClient.Client)
+	// personal data of deliveries is encrypted in db and cache if a keyfile is set
+	var keyring *encryption.Keyring
+	if cfg.EncryptionKeyfile != "" {
+		keyring, err = encryption.LoadKeyring(cfg.EncryptionKeyfile)
+		if err != nil {
+			sugar.Fatalw("failed to load encryption keyfile", "error", err)
+			return
+		}
+		sugar.Infow("delivery encryption is enabled", "active_key", keyring.ActiveKeyID())
+	}
+
+	orderRepo := postgresRepo.NewOrderRepository(pgClient.Pool, keyring)
+	// consumed messages, rejections and cache lookups are counted for the operations page
+	pipelineMetrics := monitoring.NewPipelineMetrics()
+	cacheRepo := redisRepo.NewCacheRepository(redisClient.Client, keyring, pipelineMetrics)
+	if keyring != nil && cfg.EncryptionRotateInterval > 0 {
+		go service.NewKeyRotator(sugar, orderRepo, keyring).Start(ctx, cfg.EncryptionRotateInterval)
+	}
 
-	orderService := service.NewOrderService(sugar, orderRepo, cacheRepo)
+	// degraded mode: keep accepting orders while db is down, replicas share the pending records of their spools
+	spoolRepo := redisRepo.NewSpoolRepository(redisClient.Client)
+	var orderSpool service.OrderSpool
+	if cfg.SpoolEnabled {
+		sp, err := spool.Open(sugar, cfg.SpoolDir)
+		if err != nil {
+			sugar.Fatalw("failed to open order spool", "error", err)
+			return
+		}
+		defer sp.Close()
+		orderSpool = sp
+		sugar.Infow("order spool is enabled", "dir", cfg.SpoolDir, "id", sp.ID(), "pending", sp.Pending())
+	}
+
+	// stored and erased orders are numbered in redis and streamed to subscribers of every replica
+	orderReader := service.NewOrderReader(sugar, orderRepo, cacheRepo)
+	orderFeed := service.NewOrderBroadcaster(sugar, redisRepo.NewOrderFeedRepository(redisClient.Client, cfg.FeedHistory),
+		orderReader, service.NewOrderFeed(), cfg.FeedHistory)
+	go orderFeed.Run(ctx)
+
+	orderService := service.NewOrderService(sugar, orderRepo, cacheRepo, orderSpool, spoolRepo, keyring, orderFeed)
 	go orderService.HeatUpCache(ctx)
+	go orderService.FlushSpool(ctx, cfg.SpoolFlushInterval)
+
+	reconciler := service.NewReconciler(sugar, orderRepo, cacheRepo, orderSpool, cfg.ReconcileSampleSize)
+	if cfg.ReconcileInterval > 0 {
+		go reconciler.Start(ctx, cfg.ReconcileInterval)
+	}
 
 	kafkaProducer := kafka.NewProducer(kafkaClient, sugar)
 	go kafkaProducer.Start(stop)
 
-	kafkaConsumer := kafka.NewConsumer(kafkaClient, orderService, sugar)
+	// rejected messages are kept in redis for the dashboard
+	rejectionRepo := redisRepo.NewRejectionRepository(redisClient.Client, cfg.RejectionHistory)
+	kafkaConsumer := kafka.NewConsumer(kafkaClient, orderService, rejectionRepo, keyring, pipelineMetrics, sugar)
 	go kafkaConsumer.Start(ctx, stop)
 
-	healthChecker := monitoring.NewHealthChecker(pgClient, redisClient, 10*time.Second, sugar, stop)
+	healthChecker := monitoring.NewHealthChecker(pgClient, redisClient, 10*time.Second, sugar, stop, cfg.SpoolEnabled)
 	go healthChecker.Start(ctx)
 
-	serverErrors := make(chan error, 2)
+	serverErrors := make(chan error, 3)
+
+	// orders submitted over http go through the same pipeline as kafka messages
+	ingestion := httpdelivery.OrderIngestion{
+		Processor:   orderService,
+		Idempotency: redisRepo.NewIdempotencyRepository(redisClient.Client, cfg.IdempotencyTTL),
+	}
+	if cfg.HTTPIngestMode == "kafka" {
+		ingestion.Publisher = kafkaProducer
+	}
+
+	// api keys are stored in db, bearer tokens are checked against a local JWKS
+	apiKeyRepo := postgresRepo.NewAPIKeyRepository(pgClient.Pool)
+	access := httpdelivery.AccessControl{APIKeys: apiKeyRepo}
+	if cfg.AuthEnabled {
+		var jwtVerifier *auth.JWTVerifier
+		if cfg.JWTJWKSFile != "" {
+			jwtVerifier, err = auth.NewJWTVerifier(cfg.JWTJWKSFile, cfg.JWTIssuer, cfg.JWTAudience)
+			if err != nil {
+				sugar.Fatalw("failed to load JWKS", "error", err)
+				return
+			}
+		}
+		access.Authenticator = auth.NewAuthenticator(apiKeyRepo, jwtVerifier, cfg.AuthBootstrapKey)
+
+		// the dashboard has no login of its own, so everyone who reaches it acts with its key
+		if cfg.WebAPIKey != "" {
+			webPrincipal, err := access.Authenticator.AuthenticateAPIKey(ctx, cfg.WebAPIKey)
+			switch {
+			case errors.Is(err, auth.ErrInvalidCredentials):
+				sugar.Warnw("WEB_API_KEY is unknown or revoked, the dashboard won't be able to read orders")
+			case err != nil:
+				sugar.Fatalw("failed to check WEB_API_KEY", "error", err)
+				return
+			case webPrincipal.Role.Allows(auth.RoleSupport):
+				sugar.Fatalw("WEB_API_KEY must have the viewer role, the dashboard doesn't authenticate its users",
+					"role", webPrincipal.Role)
+				return
+			}
+		}
+	} else {
+		sugar.Warnw("api authentication is disabled")
+	}
+
+	// token buckets are kept in memory unless replicas have to share them
+	var rateLimiter httpdelivery.RateLimiter
+	if cfg.RateLimitEnabled {
+		rateLimiter = ratelimit.NewLocalLimiter()
+		if cfg.RateLimitShared {
+			rateLimiter = redisRepo.NewRateLimitRepository(redisClient.Client)
+		}
+	} else {
+		sugar.Warnw("api rate limiting is disabled")
+	}
+
+	var orderQueries httpdelivery.OrderQueries
+	if cfg.GraphQLEnabled {
+		orderQueries, err = graphqldelivery.NewSchema(sugar, orderReader, orderRepo)
+		if err != nil {
+			sugar.Fatalw("failed to initialize GraphQL schema", "error", err)
+			return
+		}
+	}
+
+	// reports are read from daily aggregates, every replica refreshes them unless another one just did
+	var orderAnalytics httpdelivery.OrderAnalytics
+	if cfg.AnalyticsEnabled {
+		analyticsRepo := postgresRepo.NewAnalyticsRepository(pgClient.Pool)
+		if cfg.AnalyticsRefreshInterval > 0 {
+			go service.NewAnalyticsRefresher(sugar, analyticsRepo).Start(ctx, cfg.AnalyticsRefreshInterval)
+		}
+		orderAnalytics = analyticsRepo
+	}
 
 	// api for frontend
-	apiServer := httpdelivery.NewApiServer(sugar, ctx, orderRepo, cacheRepo)
+	apiServer, err := httpdelivery.NewApiServer(sugar, ctx, orderRepo, cacheRepo, reconciler, ingestion, access, httpdelivery.ApiServerConfig{
+		ValidateResponses:   cfg.OpenAPIValidateResponses,
+		CacheControl:        cfg.CacheControl,
+		RateLimiter:         rateLimiter,
+		RateLimits:          cfg.RateLimits,
+		TrustProxy:          cfg.RateLimitTrustProxy,
+		Timeouts:            cfg.RequestTimeouts,
+		Feed:                orderFeed,
+		GraphQL:             orderQueries,
+		Analytics:           orderAnalytics,
+		Rejections:          rejectionRepo,
+		Spool:               orderSpool,
+		Spools:              spoolRepo,
+		EncryptedDeliveries: keyring != nil,
+		Operations:          monitoring.NewOperations(pgClient, redisClient, kafkaClient, pipelineMetrics, errorLog),
+	})
+	if err != nil {
+		sugar.Fatalw("failed to initialize API server", "error", err)
+		return
+	}
+
+	webServer, err := httpdelivery.NewWebServer(cfg.ApiURL, cfg.WebAPIKey, cfg.WebMaskPII)
+	if err != nil {
+		sugar.Fatalw("failed to initialize Web server", "error", err)
+		return
+	}
 
-	webServer := &httpdelivery.WebServer{}
+	// grpc api shares authentication and the cache-then-db reads with the http api
+	var grpcServer *grpcdelivery.Server
+	if cfg.GRPCEnabled {
+		grpcServer = grpcdelivery.NewServer(sugar, orderReader, orderRepo, orderFeed,
+			access.Authenticator, grpcdelivery.ServerConfig{
+				Addr:        cfg.GRPCAddr,
+				Timeout:     cfg.GRPCRequestTimeout,
+				WatchBuffer: cfg.GRPCWatchBuffer,
+			})
+		go func() {
+			if err := grpcServer.Start(); err != nil {
+				serverErrors <- fmt.Errorf("grpc server error: %w", err)
+			}
+		}()
+	}
 
 	go func() {
 		if err := apiServer.StartApiServer(); err != nil {
@@ -114,6 +301,16 @@ func main() {
 		sugar.Errorw("Failed to shutdown Web server gracefully", "error", err)
 	}
 
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(shutdownCtx); err != nil {
+			sugar.Errorw("Failed to shutdown gRPC server gracefully", "error", err)
+		}
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		sugar.Errorw("Failed to flush traces", "error", err)
+	}
+
 	sugar.Info("Application shutdown complete")
 
 }
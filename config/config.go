@@ -2,8 +2,12 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"github.com/joho/godotenv"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -20,6 +24,101 @@ type Config struct {
 
 	RedisHost     string
 	RedisPassword string
+
+	// RedisMode is one of "standalone", "sentinel" or "cluster"
+	RedisMode               string
+	RedisUsername           string
+	RedisDB                 int
+	RedisSentinelMasterName string
+	RedisSentinelAddrs      []string
+	RedisSentinelPassword   string
+	RedisClusterAddrs       []string
+	RedisTLS                bool
+	RedisTLSSkipVerify      bool
+	RedisPoolSize           int
+	RedisMinIdleConns       int
+
+	// SpoolEnabled turns on degraded mode: orders are spooled to SpoolDir while the database is unavailable
+	SpoolEnabled       bool
+	SpoolDir           string
+	SpoolFlushInterval time.Duration
+
+	// ReconcileInterval is the period of cache/db reconciliation, 0 disables scheduled runs
+	ReconcileInterval time.Duration
+	// ReconcileSampleSize is the amount of random orders checked per run, 0 means a full scan
+	ReconcileSampleSize int
+
+	// HTTPIngestMode is "direct" to save orders received over http right away or "kafka" to publish them to the topic
+	HTTPIngestMode string
+	// IdempotencyTTL is how long responses to requests with an Idempotency-Key are kept
+	IdempotencyTTL time.Duration
+
+	// ApiURL is the base url the web server uses to reach the api server
+	ApiURL string
+	// OpenAPIValidateResponses logs api responses which don't match the OpenAPI document
+	OpenAPIValidateResponses bool
+	// CacheControl maps api route names ("order", "openapi", "admin") to Cache-Control policies,
+	// set by CACHE_CONTROL_<ROUTE> variables
+	CacheControl map[string]string
+
+	// RequestTimeouts maps api route names ("order", "batch", "ingest", "export", "admin") to request deadlines,
+	// set by REQUEST_TIMEOUT_<ROUTE> variables, 0 disables the deadline
+	RequestTimeouts map[string]time.Duration
+
+	// AuthEnabled requires an api key or a JWT for every api request except the OpenAPI document
+	AuthEnabled bool
+	// AuthBootstrapKey is an admin api key accepted besides the stored ones, to create the first keys
+	AuthBootstrapKey string
+	// JWTJWKSFile is the path to a JWKS file with keys for JWT bearer tokens, empty disables JWT
+	JWTJWKSFile string
+	JWTIssuer   string
+	JWTAudience string
+	// WebAPIKey is the api key the web server uses to reach the api server, it must have the viewer role
+	WebAPIKey string
+	// WebMaskPII makes the dashboard show masked personal data regardless of the WebAPIKey role
+	WebMaskPII bool
+
+	// RateLimitEnabled turns on per-client rate limiting of api requests
+	RateLimitEnabled bool
+	// RateLimitShared keeps rate limit counters in redis, so limits hold across api server replicas
+	RateLimitShared bool
+	// RateLimits maps api route names ("order", "batch", "ingest", "export", "admin", "stream") to limits like "100/1m,burst=20",
+	// set by RATE_LIMIT_<ROUTE> variables
+	RateLimits map[string]string
+	// RateLimitTrustProxy takes the client ip from X-Forwarded-For, only for an api server behind a proxy
+	RateLimitTrustProxy bool
+
+	// TracingExporter is "none", "otlp" (endpoint from OTEL_EXPORTER_OTLP_* variables) or "file"
+	TracingExporter string
+	// TracingFile receives spans of the file exporter as JSON lines
+	TracingFile string
+	// TracingSampleRatio is the share of new traces recorded
+	TracingSampleRatio float64
+
+	// FeedHistory is the amount of latest order events kept in redis for resuming streams
+	FeedHistory int
+	// RejectionHistory is the amount of latest rejected messages kept in redis
+	RejectionHistory int
+
+	// GraphQLEnabled serves order queries at /api/graphql
+	GraphQLEnabled bool
+	// AnalyticsEnabled serves reports under /api/analytics
+	AnalyticsEnabled bool
+	// AnalyticsRefreshInterval is how often the analytics aggregates are refreshed, 0 disables scheduled refreshes
+	AnalyticsRefreshInterval time.Duration
+	// GRPCEnabled starts the grpc order api next to the http one
+	GRPCEnabled bool
+	// GRPCAddr is the listen address of the grpc server
+	GRPCAddr string
+	// GRPCRequestTimeout limits unary grpc calls, 0 disables the limit
+	GRPCRequestTimeout time.Duration
+	// GRPCWatchBuffer is the amount of events a WatchOrders caller may fall behind before it's disconnected
+	GRPCWatchBuffer int
+
+	// EncryptionKeyfile is the path to the keyfile for delivery personal data, empty stores it as plaintext
+	EncryptionKeyfile string
+	// EncryptionRotateInterval is how often the keyfile is reread and stored deliveries are re-encrypted
+	EncryptionRotateInterval time.Duration
 }
 
 func Load() (*Config, error) {
@@ -64,11 +163,133 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	redisHost, err := getEnv("REDIS_HOST")
+	// REDIS_HOST is only mandatory for a single-node setup,
+	// sentinel and cluster modes use their own address lists
+	redisMode := getEnvDefault("REDIS_MODE", "standalone")
+	redisHost := os.Getenv("REDIS_HOST")
+	if redisHost == "" && redisMode == "standalone" {
+		return nil, errors.New("no variable found: REDIS_HOST")
+	}
+	redisPass, err := getEnv("REDIS_PASSWORD")
 	if err != nil {
 		return nil, err
 	}
-	redisPass, err := getEnv("REDIS_PASSWORD")
+
+	redisDB, err := getEnvInt("REDIS_DB", 0)
+	if err != nil {
+		return nil, err
+	}
+	redisTLS, err := getEnvBool("REDIS_TLS", false)
+	if err != nil {
+		return nil, err
+	}
+	redisTLSSkipVerify, err := getEnvBool("REDIS_TLS_SKIP_VERIFY", false)
+	if err != nil {
+		return nil, err
+	}
+	redisPoolSize, err := getEnvInt("REDIS_POOL_SIZE", 0)
+	if err != nil {
+		return nil, err
+	}
+	redisMinIdleConns, err := getEnvInt("REDIS_MIN_IDLE_CONNS", 0)
+	if err != nil {
+		return nil, err
+	}
+	spoolEnabled, err := getEnvBool("SPOOL_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	spoolFlushInterval, err := getEnvDuration("SPOOL_FLUSH_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	reconcileInterval, err := getEnvDuration("RECONCILE_INTERVAL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	reconcileSampleSize, err := getEnvInt("RECONCILE_SAMPLE_SIZE", 0)
+	if err != nil {
+		return nil, err
+	}
+	httpIngestMode := getEnvDefault("HTTP_INGEST_MODE", "direct")
+	if httpIngestMode != "direct" && httpIngestMode != "kafka" {
+		return nil, fmt.Errorf("unknown HTTP_INGEST_MODE: %q", httpIngestMode)
+	}
+	idempotencyTTL, err := getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	openAPIValidateResponses, err := getEnvBool("OPENAPI_VALIDATE_RESPONSES", false)
+	if err != nil {
+		return nil, err
+	}
+	authEnabled, err := getEnvBool("AUTH_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+	webMaskPII, err := getEnvBool("WEB_MASK_PII", true)
+	if err != nil {
+		return nil, err
+	}
+	rateLimitEnabled, err := getEnvBool("RATE_LIMIT_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+	rateLimitShared, err := getEnvBool("RATE_LIMIT_SHARED", false)
+	if err != nil {
+		return nil, err
+	}
+	rateLimitTrustProxy, err := getEnvBool("RATE_LIMIT_TRUST_PROXY", false)
+	if err != nil {
+		return nil, err
+	}
+	tracingExporter := getEnvDefault("TRACING_EXPORTER", "none")
+	if tracingExporter != "none" && tracingExporter != "otlp" && tracingExporter != "file" {
+		return nil, fmt.Errorf("unknown TRACING_EXPORTER: %q", tracingExporter)
+	}
+	tracingSampleRatio, err := getEnvFloat("TRACING_SAMPLE_RATIO", 1)
+	if err != nil {
+		return nil, err
+	}
+	feedHistory, err := getEnvInt("FEED_HISTORY", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if feedHistory < 1 {
+		return nil, fmt.Errorf("FEED_HISTORY must be positive: %d", feedHistory)
+	}
+	rejectionHistory, err := getEnvInt("REJECTION_HISTORY", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if rejectionHistory < 1 {
+		return nil, fmt.Errorf("REJECTION_HISTORY must be positive: %d", rejectionHistory)
+	}
+	graphQLEnabled, err := getEnvBool("GRAPHQL_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+	analyticsEnabled, err := getEnvBool("ANALYTICS_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+	analyticsRefreshInterval, err := getEnvDuration("ANALYTICS_REFRESH_INTERVAL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	grpcEnabled, err := getEnvBool("GRPC_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+	grpcRequestTimeout, err := getEnvDuration("GRPC_REQUEST_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	grpcWatchBuffer, err := getEnvInt("GRPC_WATCH_BUFFER", 256)
+	if err != nil {
+		return nil, err
+	}
+	encryptionRotateInterval, err := getEnvDuration("ENCRYPTION_ROTATE_INTERVAL", time.Minute)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +306,86 @@ func Load() (*Config, error) {
 		KafkaGroupId:  kafkaGroupId,
 		RedisHost:     redisHost,
 		RedisPassword: redisPass,
+
+		RedisMode:               redisMode,
+		RedisUsername:           os.Getenv("REDIS_USERNAME"),
+		RedisDB:                 redisDB,
+		RedisSentinelMasterName: os.Getenv("REDIS_SENTINEL_MASTER"),
+		RedisSentinelAddrs:      getEnvList("REDIS_SENTINEL_ADDRS"),
+		RedisSentinelPassword:   os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		RedisClusterAddrs:       getEnvList("REDIS_CLUSTER_ADDRS"),
+		RedisTLS:                redisTLS,
+		RedisTLSSkipVerify:      redisTLSSkipVerify,
+		RedisPoolSize:           redisPoolSize,
+		RedisMinIdleConns:       redisMinIdleConns,
+
+		SpoolEnabled:       spoolEnabled,
+		SpoolDir:           getEnvDefault("SPOOL_DIR", "data/spool"),
+		SpoolFlushInterval: spoolFlushInterval,
+
+		ReconcileInterval:   reconcileInterval,
+		ReconcileSampleSize: reconcileSampleSize,
+
+		HTTPIngestMode: httpIngestMode,
+		IdempotencyTTL: idempotencyTTL,
+
+		ApiURL:                   getEnvDefault("API_URL", "http://localhost:8081"),
+		OpenAPIValidateResponses: openAPIValidateResponses,
+		CacheControl:             make(map[string]string),
+		RequestTimeouts:          make(map[string]time.Duration),
+
+		AuthEnabled:      authEnabled,
+		AuthBootstrapKey: os.Getenv("AUTH_BOOTSTRAP_KEY"),
+		JWTJWKSFile:      os.Getenv("JWT_JWKS_FILE"),
+		JWTIssuer:        os.Getenv("JWT_ISSUER"),
+		JWTAudience:      os.Getenv("JWT_AUDIENCE"),
+		WebAPIKey:        os.Getenv("WEB_API_KEY"),
+		WebMaskPII:       webMaskPII,
+
+		RateLimitEnabled:    rateLimitEnabled,
+		RateLimitShared:     rateLimitShared,
+		RateLimits:          make(map[string]string),
+		RateLimitTrustProxy: rateLimitTrustProxy,
+
+		TracingExporter:    tracingExporter,
+		TracingFile:        getEnvDefault("TRACING_FILE", "data/traces.jsonl"),
+		TracingSampleRatio: tracingSampleRatio,
+
+		FeedHistory:      feedHistory,
+		RejectionHistory: rejectionHistory,
+
+		GraphQLEnabled:           graphQLEnabled,
+		AnalyticsEnabled:         analyticsEnabled,
+		AnalyticsRefreshInterval: analyticsRefreshInterval,
+
+		GRPCEnabled:        grpcEnabled,
+		GRPCAddr:           getEnvDefault("GRPC_ADDR", ":9090"),
+		GRPCRequestTimeout: grpcRequestTimeout,
+		GRPCWatchBuffer:    grpcWatchBuffer,
+
+		EncryptionKeyfile:        os.Getenv("ENCRYPTION_KEYFILE"),
+		EncryptionRotateInterval: encryptionRotateInterval,
+	}
+	for _, route := range []string{"order", "openapi", "admin", "analytics"} {
+		if policy := os.Getenv("CACHE_CONTROL_" + strings.ToUpper(route)); policy != "" {
+			config.CacheControl[route] = policy
+		}
+	}
+	for _, route := range []string{"order", "batch", "ingest", "export", "admin", "graphql", "search", "analytics", "list", "operations"} {
+		key := "REQUEST_TIMEOUT_" + strings.ToUpper(route)
+		if os.Getenv(key) == "" {
+			continue
+		}
+		timeout, err := getEnvDuration(key, 0)
+		if err != nil {
+			return nil, err
+		}
+		config.RequestTimeouts[route] = timeout
+	}
+	for _, route := range []string{"order", "batch", "ingest", "export", "admin", "stream", "graphql", "search", "analytics", "list", "operations"} {
+		if limit := os.Getenv("RATE_LIMIT_" + strings.ToUpper(route)); limit != "" {
+			config.RateLimits[route] = limit
+		}
 	}
 
 	return config, nil
@@ -98,3 +399,75 @@ func getEnv(key string) (string, error) {
 	}
 	return value, nil
 }
+
+// getEnvDefault returns the variable value or def if it is not set
+func getEnvDefault(key string, def string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// getEnvInt parses an optional integer variable
+func getEnvInt(key string, def int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer in %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// getEnvFloat parses an optional floating point variable
+func getEnvFloat(key string, def float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number in %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// getEnvBool parses an optional boolean variable
+func getEnvBool(key string, def bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean in %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// getEnvDuration parses an optional duration variable like "5s"
+func getEnvDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration in %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// getEnvList splits an optional comma-separated variable
+func getEnvList(key string) []string {
+	var list []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
@@ -32,6 +32,12 @@ CREATE TABLE IF NOT EXISTS deliveries (
     address   TEXT,
     region    TEXT,
     email     TEXT,
+    -- name, phone, address и email зашифрованы, если задан key_id (ключ данных обёрнут ключом key_id)
+    key_id      TEXT,
+    wrapped_key BYTEA,
+    -- слепые индексы (HMAC) для поиска по телефону и email
+    phone_index TEXT,
+    email_index TEXT,
     created_at TIMESTAMPTZ DEFAULT now()
     );
 
@@ -73,12 +79,43 @@ CREATE TABLE IF NOT EXISTS items (
 -- Индексы для ускорения поиска
 CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id);
 CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created);
+-- постраничный вывод заказов (GraphQL), от новых к старым
+CREATE INDEX IF NOT EXISTS idx_orders_created_at_uid ON orders(created_at DESC, order_uid DESC);
 CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders(track_number);
 CREATE INDEX IF NOT EXISTS idx_items_nm_id ON items(nm_id);
 CREATE INDEX IF NOT EXISTS idx_items_chrt_id ON items(chrt_id);
 CREATE INDEX IF NOT EXISTS idx_items_order_uid ON items(order_uid);
+CREATE INDEX IF NOT EXISTS idx_deliveries_phone_index ON deliveries(phone_index);
+CREATE INDEX IF NOT EXISTS idx_deliveries_email_index ON deliveries(email_index);
+CREATE INDEX IF NOT EXISTS idx_deliveries_key_id ON deliveries(key_id);
 
 
+-- API-ключи (хранится только sha256 ключа)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id         SERIAL PRIMARY KEY,
+    name       TEXT NOT NULL,
+    role       TEXT NOT NULL,
+    prefix     TEXT NOT NULL,
+    key_hash   TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+    );
+
+-- Журнал удаления данных клиентов (вместо customer_id хранится его слепой индекс, HMAC с ключом index_key;
+-- без keyfile — пустая строка), pseudonym — случайный customer_id, который получили обезличенные заказы,
+-- spools_checked — перед удалением проверено, что спулы всех реплик пусты
+CREATE TABLE IF NOT EXISTS erasures (
+    id             SERIAL PRIMARY KEY,
+    customer_hash  TEXT NOT NULL,
+    pseudonym      TEXT NOT NULL DEFAULT '',
+    orders         INTEGER NOT NULL,
+    requested_by   TEXT NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    spools_checked BOOLEAN NOT NULL DEFAULT false,
+    erased_at      TIMESTAMPTZ DEFAULT now()
+    );
+CREATE INDEX IF NOT EXISTS idx_erasures_customer_hash ON erasures(customer_hash);
+
 ALTER TABLE deliveries
     ADD CONSTRAINT deliveries_order_uid_key UNIQUE (order_uid);
 
@@ -88,6 +125,90 @@ ALTER TABLE payments
 ALTER TABLE items
     ADD CONSTRAINT items_order_rid_key UNIQUE (order_uid, rid);
 
+-- Полнотекстовый поиск: tsvector в русской и английской конфигурациях и триграммы для нечёткого поиска.
+-- Зашифрованные адреса (key_id задан) не индексируются: с ENCRYPTION_KEYFILE поиск по адресу не работает,
+-- и ответ поиска предупреждает об этом в warnings.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE items ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', coalesce(name, '')) || to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(brand, '')) || to_tsvector('english', coalesce(brand, '')), 'B')
+    ) STORED;
+
+-- вес A — адрес, B — город
+ALTER TABLE deliveries ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', CASE WHEN key_id IS NULL THEN coalesce(address, '') ELSE '' END) ||
+              to_tsvector('english', CASE WHEN key_id IS NULL THEN coalesce(address, '') ELSE '' END), 'A') ||
+    setweight(to_tsvector('russian', coalesce(city, '')) || to_tsvector('english', coalesce(city, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_items_search ON items USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_deliveries_search ON deliveries USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_items_name_trgm ON items USING gin (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_items_brand_trgm ON items USING gin (brand gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_deliveries_city_trgm ON deliveries USING gin (city gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_deliveries_address_trgm ON deliveries USING gin (address gin_trgm_ops) WHERE key_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_orders_track_number_trgm ON orders USING gin (track_number gin_trgm_ops);
+
+-- Аналитика: дневные агрегаты (по UTC), обновляются по расписанию (ANALYTICS_REFRESH_INTERVAL).
+-- Уникальные индексы нужны для REFRESH MATERIALIZED VIEW CONCURRENTLY.
+CREATE MATERIALIZED VIEW IF NOT EXISTS order_stats_daily AS
+SELECT (o.date_created AT TIME ZONE 'UTC')::date AS day,
+       coalesce(p.currency, '')                   AS currency,
+       coalesce(o.delivery_service, '')           AS delivery_service,
+       coalesce(p.provider, '')                   AS provider,
+       coalesce(p.bank, '')                       AS bank,
+       coalesce(d.city, '')                       AS city,
+       coalesce(d.region, '')                     AS region,
+       count(*)                                   AS orders,
+       coalesce(sum(p.amount), 0)::bigint         AS revenue,
+       coalesce(sum(i.items), 0)::bigint          AS items
+FROM orders o
+         LEFT JOIN payments p ON p.order_uid = o.order_uid
+         LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+         LEFT JOIN (SELECT order_uid, count(*) AS items FROM items GROUP BY order_uid) i ON i.order_uid = o.order_uid
+WHERE o.date_created IS NOT NULL
+GROUP BY 1, 2, 3, 4, 5, 6, 7;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_stats_daily_key
+    ON order_stats_daily (day, currency, delivery_service, provider, bank, city, region);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS item_stats_daily AS
+SELECT (o.date_created AT TIME ZONE 'UTC')::date AS day,
+       coalesce(p.currency, '')                   AS currency,
+       coalesce(i.nm_id, 0)                       AS nm_id,
+       coalesce(i.brand, '')                      AS brand,
+       count(*)                                   AS items,
+       count(DISTINCT i.order_uid)                AS orders,
+       coalesce(sum(i.total_price), 0)::bigint    AS revenue
+FROM items i
+         JOIN orders o ON o.order_uid = i.order_uid
+         LEFT JOIN payments p ON p.order_uid = i.order_uid
+WHERE o.date_created IS NOT NULL
+GROUP BY 1, 2, 3, 4;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_item_stats_daily_key ON item_stats_daily (day, currency, nm_id, brand);
+
+-- заказ с несколькими товарами бренда считается один раз, поэтому бренды нельзя собирать из item_stats_daily
+CREATE MATERIALIZED VIEW IF NOT EXISTS brand_stats_daily AS
+SELECT (o.date_created AT TIME ZONE 'UTC')::date AS day,
+       coalesce(p.currency, '')                   AS currency,
+       coalesce(i.brand, '')                      AS brand,
+       count(*)                                   AS items,
+       count(DISTINCT i.order_uid)                AS orders,
+       coalesce(sum(i.total_price), 0)::bigint    AS revenue
+FROM items i
+         JOIN orders o ON o.order_uid = i.order_uid
+         LEFT JOIN payments p ON p.order_uid = i.order_uid
+WHERE o.date_created IS NOT NULL
+GROUP BY 1, 2, 3;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_brand_stats_daily_key ON brand_stats_daily (day, currency, brand);
+
+-- время последнего обновления аналитики, одна строка
+CREATE TABLE IF NOT EXISTS analytics_refreshes (
+    id           BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    refreshed_at TIMESTAMPTZ NOT NULL
+    );
+INSERT INTO analytics_refreshes (refreshed_at) VALUES (now()) ON CONFLICT DO NOTHING;
+
 -- Доступы для пользователя приложения (app_user)
 -- GRANT USAGE ON SCHEMA public TO app_user;
 -- GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO app_user;
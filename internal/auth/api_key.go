@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	apiKeyPrefix = "mos_"
+	// apiKeyShownPrefix is how many characters of a key are kept to tell keys apart
+	apiKeyShownPrefix = 12
+)
+
+// GenerateAPIKey returns a new random key, its display prefix and its hash
+func GenerateAPIKey() (key string, prefix string, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + hex.EncodeToString(buf)
+	return key, key[:apiKeyShownPrefix], HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hash under which a key is stored.
+// Keys are long and random, so a fast hash without salt is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
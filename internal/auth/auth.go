@@ -0,0 +1,72 @@
+// Package auth authenticates api clients with API keys and JWT bearer tokens and defines their roles.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Role of an api client. Every role can do everything the lower roles can.
+type Role string
+
+const (
+	// RoleViewer reads orders without personal data
+	RoleViewer Role = "viewer"
+	// RoleSupport reads whole orders, exports and submits them
+	RoleSupport Role = "support"
+	// RoleAdmin also manages the service: api keys, reconciliation
+	RoleAdmin Role = "admin"
+)
+
+var roleLevels = map[Role]int{RoleViewer: 1, RoleSupport: 2, RoleAdmin: 3}
+
+// ParseRole checks that s is a known role
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleLevels[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, expected viewer, support or admin", s)
+	}
+	return role, nil
+}
+
+// Allows is true if the role has at least the required role
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+// Authentication methods
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	// MethodNone is used when authentication is disabled
+	MethodNone = "none"
+)
+
+// Principal is an authenticated api client
+type Principal struct {
+	// Subject is the api key name or the token subject
+	Subject string
+	Role    Role
+	Method  string
+}
+
+var (
+	// ErrNoCredentials means the request has neither an api key nor a bearer token
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials means the key or token is unknown, revoked, expired or malformed
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+type principalKey struct{}
+
+// WithPrincipal stores the principal in the context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal of the request context, or nil
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
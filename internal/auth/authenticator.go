@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"sync"
+	"time"
+)
+
+// apiKeyCacheTTL is how long looked up keys are trusted without asking the store,
+// revocations made elsewhere take effect within this time
+const apiKeyCacheTTL = 30 * time.Second
+
+// maxCachedAPIKeys bounds the cache, it's dropped as a whole when full
+const maxCachedAPIKeys = 10000
+
+type APIKeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error)
+}
+
+// Authenticator resolves api keys and bearer tokens to principals
+type Authenticator struct {
+	keys APIKeyStore
+	// jwt is nil if bearer tokens aren't accepted
+	jwt *JWTVerifier
+	// bootstrapHash is the hash of an admin key from the configuration, used to create the first stored keys
+	bootstrapHash string
+
+	mu    sync.Mutex
+	cache map[string]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	principal *Principal
+	expires   time.Time
+}
+
+// NewAuthenticator creates an authenticator. jwt may be nil, bootstrapKey may be empty.
+func NewAuthenticator(keys APIKeyStore, jwt *JWTVerifier, bootstrapKey string) *Authenticator {
+	a := &Authenticator{keys: keys, jwt: jwt, cache: make(map[string]cachedAPIKey)}
+	if bootstrapKey != "" {
+		a.bootstrapHash = HashAPIKey(bootstrapKey)
+	}
+	return a
+}
+
+// AuthenticateAPIKey looks the key up by its hash. Unknown and revoked keys give ErrInvalidCredentials,
+// other errors mean the store is unavailable.
+func (a *Authenticator) AuthenticateAPIKey(ctx context.Context, key string) (*Principal, error) {
+	hash := HashAPIKey(key)
+	if a.bootstrapHash != "" && hash == a.bootstrapHash {
+		return &Principal{Subject: "bootstrap", Role: RoleAdmin, Method: MethodAPIKey}, nil
+	}
+
+	a.mu.Lock()
+	cached, ok := a.cache[hash]
+	a.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		if cached.principal == nil {
+			return nil, ErrInvalidCredentials
+		}
+		return cached.principal, nil
+	}
+
+	stored, err := a.keys.GetAPIKeyByHash(ctx, hash)
+	var principal *Principal
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("failed to look up api key: %w", err)
+	case stored.RevokedAt == nil:
+		role, err := ParseRole(stored.Role)
+		if err != nil {
+			return nil, fmt.Errorf("api key %d: %w", stored.ID, err)
+		}
+		principal = &Principal{Subject: stored.Name, Role: role, Method: MethodAPIKey}
+	}
+
+	// unknown keys are cached too, so guessing doesn't hit the database on every request
+	a.mu.Lock()
+	if len(a.cache) >= maxCachedAPIKeys {
+		a.cache = make(map[string]cachedAPIKey)
+	}
+	a.cache[hash] = cachedAPIKey{principal: principal, expires: time.Now().Add(apiKeyCacheTTL)}
+	a.mu.Unlock()
+	if principal == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return principal, nil
+}
+
+// AuthenticateBearer validates a JWT
+func (a *Authenticator) AuthenticateBearer(token string) (*Principal, error) {
+	if a.jwt == nil {
+		return nil, fmt.Errorf("%w: bearer tokens are not accepted", ErrInvalidCredentials)
+	}
+	return a.jwt.Verify(token)
+}
+
+// ForgetAPIKeys drops cached keys, e.g. after a key was revoked
+func (a *Authenticator) ForgetAPIKeys() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cache = make(map[string]cachedAPIKey)
+}
@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwtLeeway allows for clock skew when checking exp and nbf
+	jwtLeeway = 30 * time.Second
+	// jwksReloadInterval limits how often the JWKS file is checked for changes on unknown key ids
+	jwksReloadInterval = 10 * time.Second
+)
+
+// JWTVerifier validates JWT bearer tokens signed with keys from a local JWKS file.
+// The file is reloaded when a token refers to an unknown key id, so keys can be rotated without restarts.
+type JWTVerifier struct {
+	path     string
+	issuer   string
+	audience string
+
+	mu         sync.Mutex
+	keys       map[string]crypto.PublicKey
+	modTime    time.Time
+	lastReload time.Time
+}
+
+// NewJWTVerifier loads the JWKS file. Empty issuer or audience are not checked.
+func NewJWTVerifier(path string, issuer string, audience string) (*JWTVerifier, error) {
+	v := &JWTVerifier{path: path, issuer: issuer, audience: audience}
+	if err := v.reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Role      string          `json:"role"`
+	Roles     []string        `json:"roles"`
+}
+
+// Verify checks the token signature and claims and returns its principal.
+// The role is taken from the "role" claim or the highest of the "roles" claim.
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed token header", ErrInvalidCredentials)
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token signature", ErrInvalidCredentials)
+	}
+	if err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	var claims jwtClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed token claims", ErrInvalidCredentials)
+	}
+	now := time.Now()
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return nil, fmt.Errorf("%w: token is expired", ErrInvalidCredentials)
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidCredentials)
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidCredentials)
+	}
+	if v.audience != "" && !hasAudience(claims.Audience, v.audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidCredentials)
+	}
+
+	var role Role
+	for _, name := range append(claims.Roles, claims.Role) {
+		if r, err := ParseRole(name); err == nil && !role.Allows(r) {
+			role = r
+		}
+	}
+	if role == "" {
+		return nil, fmt.Errorf("%w: token has no known role", ErrInvalidCredentials)
+	}
+	return &Principal{Subject: claims.Subject, Role: role, Method: MethodJWT}, nil
+}
+
+// key returns the key by id, reloading the file if the id is unknown
+func (v *JWTVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(v.lastReload) >= jwksReloadInterval {
+		if info, err := os.Stat(v.path); err == nil && !info.ModTime().Equal(v.modTime) {
+			if err = v.reloadLocked(); err != nil {
+				return nil, err
+			}
+		}
+		v.lastReload = time.Now()
+	}
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidCredentials, kid)
+}
+
+func (v *JWTVerifier) reload() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.reloadLocked()
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (v *JWTVerifier) reloadLocked() error {
+	info, err := os.Stat(v.path)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks: %w", err)
+	}
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks: %w", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("invalid jwk %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	v.keys = keys
+	v.modTime = info.ModTime()
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// jwsAlgorithm describes a supported signature algorithm
+type jwsAlgorithm struct {
+	// scheme is "RS" (PKCS #1 v1.5), "PS" (RSASSA-PSS), "ES" (ECDSA) or "EdDSA"
+	scheme string
+	hash   crypto.Hash
+	// curveBits is the size of the curve an ES algorithm is bound to
+	curveBits int
+}
+
+// jwsAlgorithms are the accepted "alg" values, anything else ("none", HMAC, typos) is rejected
+var jwsAlgorithms = map[string]jwsAlgorithm{
+	"RS256": {scheme: "RS", hash: crypto.SHA256},
+	"RS384": {scheme: "RS", hash: crypto.SHA384},
+	"RS512": {scheme: "RS", hash: crypto.SHA512},
+	"PS256": {scheme: "PS", hash: crypto.SHA256},
+	"PS384": {scheme: "PS", hash: crypto.SHA384},
+	"PS512": {scheme: "PS", hash: crypto.SHA512},
+	"ES256": {scheme: "ES", hash: crypto.SHA256, curveBits: 256},
+	"ES384": {scheme: "ES", hash: crypto.SHA384, curveBits: 384},
+	"ES512": {scheme: "ES", hash: crypto.SHA512, curveBits: 521},
+	"EdDSA": {scheme: "EdDSA"},
+}
+
+// verifySignature checks the signature with the algorithm from the token header,
+// which must be in jwsAlgorithms and match the key type (so an RSA key can't be used as an HMAC secret)
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	a, ok := jwsAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	digest := func() []byte {
+		h := a.hash.New()
+		h.Write(signed)
+		return h.Sum(nil)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch a.scheme {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, a.hash, digest(), signature)
+		case "PS":
+			return rsa.VerifyPSS(k, a.hash, digest(), signature, nil)
+		}
+	case *ecdsa.PublicKey:
+		if a.scheme != "ES" || a.curveBits != k.Curve.Params().BitSize {
+			break
+		}
+		// JWS uses the fixed-size r||s encoding
+		size := (a.curveBits + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest(), r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if a.scheme != "EdDSA" {
+			break
+		}
+		if !ed25519.Verify(k, signed, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("algorithm %q doesn't match the key", alg)
+}
+
+// hasAudience checks the "aud" claim, which is a string or an array of strings
+func hasAudience(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+// newTestVerifier writes a JWKS with an RSA key "rsa" and a P-256 key "ec"
+func newTestVerifier(t *testing.T, issuer, audience string) (*JWTVerifier, testKeys) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTVerifier(path, issuer, audience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+// signToken builds a token, sign gets the signing input and returns the raw signature
+func signToken(t *testing.T, header, claims map[string]any, sign func(signed []byte) []byte) string {
+	t.Helper()
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":  "alice",
+		"iss":  "issuer",
+		"aud":  "orders",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+		"role": "support",
+	}
+}
+
+func TestJWTVerifierAlgorithms(t *testing.T) {
+	v, keys := newTestVerifier(t, "issuer", "orders")
+	rs256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, keys.rsa, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	es256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, keys.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	// the classic confusion: the public RSA modulus used as an HMAC secret
+	hs256 := func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, keys.rsa.N.Bytes())
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+	unsigned := func([]byte) []byte { return nil }
+
+	tests := []struct {
+		name   string
+		header map[string]any
+		sign   func([]byte) []byte
+		valid  bool
+	}{
+		{"RS256", map[string]any{"alg": "RS256", "kid": "rsa"}, rs256, true},
+		{"ES256", map[string]any{"alg": "ES256", "kid": "ec"}, es256, true},
+		{"none", map[string]any{"alg": "none", "kid": "rsa"}, unsigned, false},
+		{"HS256 with an RSA key", map[string]any{"alg": "HS256", "kid": "rsa"}, hs256, false},
+		{"bogus RS prefix", map[string]any{"alg": "RSRS256", "kid": "rsa"}, rs256, false},
+		{"bogus PS prefix", map[string]any{"alg": "PSE256", "kid": "rsa"}, rs256, false},
+		{"lowercase", map[string]any{"alg": "rs256", "kid": "rsa"}, rs256, false},
+		{"RS256 with an EC key", map[string]any{"alg": "RS256", "kid": "ec"}, rs256, false},
+		{"ES256 with an RSA key", map[string]any{"alg": "ES256", "kid": "rsa"}, es256, false},
+		{"ES384 with a P-256 key", map[string]any{"alg": "ES384", "kid": "ec"}, es256, false},
+		{"PS256 over a PKCS1 signature", map[string]any{"alg": "PS256", "kid": "rsa"}, rs256, false},
+		{"unknown key id", map[string]any{"alg": "RS256", "kid": "other"}, rs256, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := v.Verify(signToken(t, tt.header, validClaims(), tt.sign))
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("expected ErrInvalidCredentials, got principal %+v, err %v", principal, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if principal.Subject != "alice" || principal.Role != RoleSupport || principal.Method != MethodJWT {
+				t.Fatalf("unexpected principal %+v", principal)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierClaims(t *testing.T) {
+	v, keys := newTestVerifier(t, "issuer", "orders")
+	rs256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, keys.rsa, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		change func(claims map[string]any)
+		valid  bool
+	}{
+		{"valid", func(map[string]any) {}, true},
+		{"audience in a list", func(c map[string]any) { c["aud"] = []string{"billing", "orders"} }, true},
+		{"expired within leeway", func(c map[string]any) { c["exp"] = now.Add(-10 * time.Second).Unix() }, true},
+		{"highest of roles", func(c map[string]any) { delete(c, "role"); c["roles"] = []string{"viewer", "admin"} }, true},
+		{"expired", func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() }, false},
+		{"no expiry", func(c map[string]any) { delete(c, "exp") }, false},
+		{"not valid yet", func(c map[string]any) { c["nbf"] = now.Add(time.Hour).Unix() }, false},
+		{"other audience", func(c map[string]any) { c["aud"] = "billing" }, false},
+		{"other audiences in a list", func(c map[string]any) { c["aud"] = []string{"billing"} }, false},
+		{"no audience", func(c map[string]any) { delete(c, "aud") }, false},
+		{"other issuer", func(c map[string]any) { c["iss"] = "someone" }, false},
+		{"unknown role", func(c map[string]any) { c["role"] = "root" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.change(claims)
+			_, err := v.Verify(signToken(t, map[string]any{"alg": "RS256", "kid": "rsa"}, claims, rs256))
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package graphql
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"github.com/graph-gophers/dataloader/v7"
+	"go.uber.org/zap"
+	"sync/atomic"
+)
+
+// orderLoader batches lookups of orders by uid made while resolving a single request
+type orderLoader = dataloader.Loader[string, *model.Order]
+
+// loaders are created per request, so their caches never outlive it
+type loaders struct {
+	// order reads whole orders through the cache
+	order *orderLoader
+	// delivery, payment and items read a single sub-resource of listed orders from the db
+	delivery *orderLoader
+	payment  *orderLoader
+	items    *orderLoader
+}
+
+func (r *queryResolver) newLoaders() *loaders {
+	return &loaders{
+		order:    newOrderLoader(r.reader.GetOrders, model.AllOrderParts),
+		delivery: newOrderLoader(r.orderRepo.GetOrdersByOrderUIDs, model.OrderParts{Delivery: true}),
+		payment:  newOrderLoader(r.orderRepo.GetOrdersByOrderUIDs, model.OrderParts{Payment: true}),
+		items:    newOrderLoader(r.orderRepo.GetOrdersByOrderUIDs, model.OrderParts{Items: true}),
+	}
+}
+
+// newOrderLoader loads the given parts of orders with a single get per batch, unknown orders load as nil
+func newOrderLoader(get func(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error), parts model.OrderParts) *orderLoader {
+	return dataloader.NewBatchedLoader(func(ctx context.Context, orderUIDs []string) []*dataloader.Result[*model.Order] {
+		orders, err := get(ctx, orderUIDs, parts)
+		results := make([]*dataloader.Result[*model.Order], len(orderUIDs))
+		for i, orderUID := range orderUIDs {
+			results[i] = &dataloader.Result[*model.Order]{Data: orders[orderUID], Error: err}
+		}
+		return results
+	}, dataloader.WithBatchCapacity[string, *model.Order](maxPageSize))
+}
+
+// requestState is what resolvers of a request share
+type requestState struct {
+	sugar   *zap.SugaredLogger
+	loaders *loaders
+	mask    bool
+	// cost is spent by the top-level fields resolved so far, see spend
+	cost atomic.Int32
+}
+
+type requestStateKey struct{}
+
+func withRequestState(ctx context.Context, state *requestState) context.Context {
+	return context.WithValue(ctx, requestStateKey{}, state)
+}
+
+// stateFrom returns the state stored by Execute
+func stateFrom(ctx context.Context) *requestState {
+	return ctx.Value(requestStateKey{}).(*requestState)
+}
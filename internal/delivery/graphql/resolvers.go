@@ -0,0 +1,410 @@
+package graphql
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/pii"
+	"MockOrderService/internal/service"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/graph-gophers/graphql-go"
+	"time"
+)
+
+// maxPageSize limits first of the orders query
+const maxPageSize = 100
+
+// Error codes sent in extensions.code of errors
+const (
+	codeBadUserInput     = "BAD_USER_INPUT"
+	codeForbidden        = "FORBIDDEN"
+	codeTimeout          = "TIMEOUT"
+	codeCacheUnavailable = "CACHE_UNAVAILABLE"
+	codeDBUnavailable    = "DB_UNAVAILABLE"
+	codeInternal         = "INTERNAL"
+)
+
+// resolverError is a field error with a code clients can tell errors apart by
+type resolverError struct {
+	code    string
+	message string
+}
+
+func (e *resolverError) Error() string {
+	return e.message
+}
+
+func (e *resolverError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// storageError logs err and turns it into an error without internal details
+func storageError(ctx context.Context, err error, msg string) error {
+	stateFrom(ctx).sugar.Errorw(msg, "error", err)
+	err = service.ClassifyDBError(err)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &resolverError{codeTimeout, msg + ": timed out"}
+	case errors.Is(err, service.ErrCacheUnavailable):
+		return &resolverError{codeCacheUnavailable, fmt.Sprintf("%s: %v", msg, service.ErrCacheUnavailable)}
+	case errors.Is(err, service.ErrDBUnavailable):
+		return &resolverError{codeDBUnavailable, fmt.Sprintf("%s: %v", msg, service.ErrDBUnavailable)}
+	default:
+		return &resolverError{codeInternal, msg}
+	}
+}
+
+// spend charges cost to the request before a top-level field reads anything, the rest of the fields fail once maxCost is spent
+func spend(ctx context.Context, cost int32) error {
+	if stateFrom(ctx).cost.Add(cost) > maxCost {
+		return &resolverError{codeBadUserInput, fmt.Sprintf(
+			"query is too expensive, at most %d may be spent: orders costs first, order 1, orderStats %d", maxCost, statsCost)}
+	}
+	return nil
+}
+
+type queryResolver struct {
+	reader    OrderReader
+	orderRepo OrderRepository
+}
+
+func (r *queryResolver) Order(ctx context.Context, args struct{ OrderUid string }) (*orderResolver, error) {
+	if args.OrderUid == "" {
+		return nil, &resolverError{codeBadUserInput, "orderUid is empty"}
+	}
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	order, err := stateFrom(ctx).loaders.order.Load(ctx, args.OrderUid)()
+	if err != nil {
+		return nil, storageError(ctx, err, "couldn't get order")
+	}
+	if order == nil {
+		return nil, nil
+	}
+	return &orderResolver{order: order, complete: true}, nil
+}
+
+type orderFilterInput struct {
+	CreatedFrom     *graphql.Time
+	CreatedTo       *graphql.Time
+	CustomerId      *string
+	DeliveryService *string
+	Locale          *string
+	Phone           *string
+	Email           *string
+}
+
+// parseFilter turns the filter argument into a model filter, nil doesn't filter
+func parseFilter(ctx context.Context, filter *orderFilterInput) (model.OrderFilter, error) {
+	var f model.OrderFilter
+	if filter == nil {
+		return f, nil
+	}
+	if filter.CreatedFrom != nil {
+		f.CreatedFrom = &filter.CreatedFrom.Time
+	}
+	if filter.CreatedTo != nil {
+		f.CreatedTo = &filter.CreatedTo.Time
+	}
+	if f.CreatedFrom != nil && f.CreatedTo != nil && !f.CreatedFrom.Before(*f.CreatedTo) {
+		return f, &resolverError{codeBadUserInput, "createdFrom must be before createdTo"}
+	}
+	f.CustomerID = deref(filter.CustomerId)
+	f.DeliveryService = deref(filter.DeliveryService)
+	f.Locale = deref(filter.Locale)
+	f.Phone = deref(filter.Phone)
+	f.Email = deref(filter.Email)
+	// otherwise masked personal data could be guessed by filtering
+	if (f.Phone != "" || f.Email != "") && stateFrom(ctx).mask {
+		return f, &resolverError{codeForbidden, "unmasked personal data is required to filter by phone or email"}
+	}
+	return f, nil
+}
+
+func (r *queryResolver) Orders(ctx context.Context, args struct {
+	Filter *orderFilterInput
+	First  int32
+	After  *string
+}) (*orderConnectionResolver, error) {
+	first := args.First
+	if first < 0 || first > maxPageSize {
+		return nil, &resolverError{codeBadUserInput, fmt.Sprintf("first must be between 0 and %d", maxPageSize)}
+	}
+	filter, err := parseFilter(ctx, args.Filter)
+	if err != nil {
+		return nil, err
+	}
+	var after *model.OrderCursor
+	if args.After != nil {
+		if after, err = model.ParseOrderCursor(*args.After); err != nil {
+			return nil, &resolverError{codeBadUserInput, "invalid after cursor"}
+		}
+	}
+	conn := &orderConnectionResolver{}
+	if first == 0 {
+		return conn, nil
+	}
+	if err = spend(ctx, first); err != nil {
+		return nil, err
+	}
+
+	// one more order tells if there is a next page
+	orders, err := r.orderRepo.ListOrders(ctx, filter, after, int(first)+1)
+	if err != nil {
+		return nil, storageError(ctx, err, "couldn't list orders")
+	}
+	if len(orders) > int(first) {
+		orders = orders[:first]
+		conn.hasNextPage = true
+	}
+	for _, order := range orders {
+		conn.edges = append(conn.edges, &orderEdgeResolver{node: &orderResolver{order: order}})
+	}
+	return conn, nil
+}
+
+func (r *queryResolver) OrderStats(ctx context.Context, args struct{ Filter *orderFilterInput }) (*orderStatsResolver, error) {
+	filter, err := parseFilter(ctx, args.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if err = spend(ctx, statsCost); err != nil {
+		return nil, err
+	}
+	stats, err := r.orderRepo.OrderStats(ctx, filter)
+	if err != nil {
+		return nil, storageError(ctx, err, "couldn't aggregate orders")
+	}
+	return &orderStatsResolver{stats: stats}, nil
+}
+
+type orderConnectionResolver struct {
+	edges       []*orderEdgeResolver
+	hasNextPage bool
+}
+
+func (c *orderConnectionResolver) Edges() []*orderEdgeResolver {
+	return c.edges
+}
+
+func (c *orderConnectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNextPage: c.hasNextPage}
+	if len(c.edges) > 0 {
+		cursor := c.edges[len(c.edges)-1].Cursor()
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+type orderEdgeResolver struct {
+	node *orderResolver
+}
+
+func (e *orderEdgeResolver) Cursor() string {
+	return model.CursorOf(e.node.order).String()
+}
+
+func (e *orderEdgeResolver) Node() *orderResolver {
+	return e.node
+}
+
+type pageInfoResolver struct {
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (p *pageInfoResolver) HasNextPage() bool {
+	return p.hasNextPage
+}
+
+func (p *pageInfoResolver) EndCursor() *string {
+	return p.endCursor
+}
+
+// orderResolver resolves an order, sub-resources of incomplete (listed) orders are loaded on demand
+type orderResolver struct {
+	order    *model.Order
+	complete bool
+}
+
+func (o *orderResolver) OrderUid() string          { return o.order.OrderUID }
+func (o *orderResolver) TrackNumber() string       { return o.order.TrackNumber }
+func (o *orderResolver) Entry() string             { return o.order.Entry }
+func (o *orderResolver) Locale() string            { return o.order.Locale }
+func (o *orderResolver) InternalSignature() string { return o.order.InternalSignature }
+func (o *orderResolver) CustomerId() string        { return o.order.CustomerID }
+func (o *orderResolver) DeliveryService() string   { return o.order.DeliveryService }
+func (o *orderResolver) Shardkey() string          { return o.order.Shardkey }
+func (o *orderResolver) SmId() *int32              { return o.order.SmID }
+func (o *orderResolver) DateCreated() *graphql.Time {
+	return timeOf(o.order.DateCreated)
+}
+func (o *orderResolver) OofShard() string { return o.order.OofShard }
+func (o *orderResolver) CreatedAt() *graphql.Time {
+	return timeOf(o.order.CreatedAt)
+}
+
+// load returns the order with the sub-resource of loader
+func (o *orderResolver) load(ctx context.Context, loader *orderLoader) (*model.Order, error) {
+	if o.complete {
+		return o.order, nil
+	}
+	order, err := loader.Load(ctx, o.order.OrderUID)()
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		// erased after it was listed
+		return &model.Order{}, nil
+	}
+	return order, nil
+}
+
+func (o *orderResolver) Delivery(ctx context.Context) (*deliveryResolver, error) {
+	state := stateFrom(ctx)
+	order, err := o.load(ctx, state.loaders.delivery)
+	if err != nil {
+		return nil, storageError(ctx, err, "couldn't get delivery")
+	}
+	if order.Delivery == nil {
+		return nil, nil
+	}
+	delivery := order.Delivery
+	if state.mask {
+		delivery = pii.MaskDelivery(delivery)
+	}
+	return &deliveryResolver{delivery}, nil
+}
+
+func (o *orderResolver) Payment(ctx context.Context) (*paymentResolver, error) {
+	order, err := o.load(ctx, stateFrom(ctx).loaders.payment)
+	if err != nil {
+		return nil, storageError(ctx, err, "couldn't get payment")
+	}
+	if order.Payment == nil {
+		return nil, nil
+	}
+	return &paymentResolver{order.Payment}, nil
+}
+
+func (o *orderResolver) Items(ctx context.Context) ([]*itemResolver, error) {
+	order, err := o.load(ctx, stateFrom(ctx).loaders.items)
+	if err != nil {
+		return nil, storageError(ctx, err, "couldn't get items")
+	}
+	items := make([]*itemResolver, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, &itemResolver{item})
+	}
+	return items, nil
+}
+
+type deliveryResolver struct {
+	d *model.Delivery
+}
+
+func (d *deliveryResolver) Name() string    { return d.d.Name }
+func (d *deliveryResolver) Phone() string   { return d.d.Phone }
+func (d *deliveryResolver) Zip() string     { return d.d.Zip }
+func (d *deliveryResolver) City() string    { return d.d.City }
+func (d *deliveryResolver) Address() string { return d.d.Address }
+func (d *deliveryResolver) Region() string  { return d.d.Region }
+func (d *deliveryResolver) Email() string   { return d.d.Email }
+
+type paymentResolver struct {
+	p *model.Payment
+}
+
+func (p *paymentResolver) TransactionId() string { return p.p.TransactionID }
+func (p *paymentResolver) RequestId() string     { return p.p.RequestID }
+func (p *paymentResolver) Currency() string      { return p.p.Currency }
+func (p *paymentResolver) Provider() string      { return p.p.Provider }
+func (p *paymentResolver) Amount() *Int64        { return int64Of(p.p.Amount) }
+func (p *paymentResolver) PaymentDt() *Int64     { return int64Of(p.p.PaymentDt) }
+func (p *paymentResolver) Bank() string          { return p.p.Bank }
+func (p *paymentResolver) DeliveryCost() *Int64  { return int64Of(p.p.DeliveryCost) }
+func (p *paymentResolver) GoodsTotal() *Int64    { return int64Of(p.p.GoodsTotal) }
+func (p *paymentResolver) CustomFee() *Int64     { return int64Of(p.p.CustomFee) }
+
+type itemResolver struct {
+	i *model.Item
+}
+
+func (i *itemResolver) ChrtId() *Int64      { return int64Of(i.i.ChrtID) }
+func (i *itemResolver) TrackNumber() string { return i.i.TrackNumber }
+func (i *itemResolver) Price() *Int64       { return int64Of(i.i.Price) }
+func (i *itemResolver) Rid() string         { return i.i.Rid }
+func (i *itemResolver) Name() string        { return i.i.Name }
+func (i *itemResolver) Sale() *int32        { return i.i.Sale }
+func (i *itemResolver) Size() string        { return i.i.Size }
+func (i *itemResolver) TotalPrice() *Int64  { return int64Of(i.i.TotalPrice) }
+func (i *itemResolver) NmId() *Int64        { return int64Of(i.i.NmID) }
+func (i *itemResolver) Brand() string       { return i.i.Brand }
+func (i *itemResolver) Status() *int32      { return i.i.Status }
+
+type orderStatsResolver struct {
+	stats *model.OrderStats
+}
+
+func (s *orderStatsResolver) Orders() Int64 { return Int64(s.stats.Orders) }
+func (s *orderStatsResolver) FirstDateCreated() *graphql.Time {
+	return timeOf(s.stats.FirstDateCreated)
+}
+func (s *orderStatsResolver) LastDateCreated() *graphql.Time {
+	return timeOf(s.stats.LastDateCreated)
+}
+
+func (s *orderStatsResolver) ByDeliveryService() []*deliveryServiceStatsResolver {
+	stats := make([]*deliveryServiceStatsResolver, 0, len(s.stats.ByDeliveryService))
+	for i := range s.stats.ByDeliveryService {
+		stats = append(stats, &deliveryServiceStatsResolver{&s.stats.ByDeliveryService[i]})
+	}
+	return stats
+}
+
+func (s *orderStatsResolver) ByCurrency() []*currencyStatsResolver {
+	stats := make([]*currencyStatsResolver, 0, len(s.stats.ByCurrency))
+	for i := range s.stats.ByCurrency {
+		stats = append(stats, &currencyStatsResolver{&s.stats.ByCurrency[i]})
+	}
+	return stats
+}
+
+type deliveryServiceStatsResolver struct {
+	s *model.DeliveryServiceStats
+}
+
+func (s *deliveryServiceStatsResolver) DeliveryService() string { return s.s.DeliveryService }
+func (s *deliveryServiceStatsResolver) Orders() Int64           { return Int64(s.s.Orders) }
+
+type currencyStatsResolver struct {
+	s *model.CurrencyStats
+}
+
+func (s *currencyStatsResolver) Currency() string       { return s.s.Currency }
+func (s *currencyStatsResolver) Orders() Int64          { return Int64(s.s.Orders) }
+func (s *currencyStatsResolver) Amount() Int64          { return Int64(s.s.Amount) }
+func (s *currencyStatsResolver) AverageAmount() float64 { return s.s.AverageAmount }
+
+func timeOf(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+func int64Of(v *int64) *Int64 {
+	if v == nil {
+		return nil
+	}
+	i := Int64(*v)
+	return &i
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,93 @@
+// Package graphql serves read-only order queries over GraphQL, see schema.graphql.
+// Nested deliveries, payments and items of listed orders are fetched with per-request dataloaders,
+// so a page of orders costs one batch per requested sub-resource instead of a query per order.
+package graphql
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"go.uber.org/zap"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+const (
+	// maxDepth limits nesting of queries, orders > edges > node > items > name is 5
+	maxDepth = 8
+	// maxParallelism limits resolvers of a request running at once
+	maxParallelism = 20
+	// maxCost limits what the top-level fields of a request may read, aliases included:
+	// orders costs its first, order 1 and orderStats statsCost
+	maxCost   = 500
+	statsCost = 50
+)
+
+type OrderReader interface {
+	GetOrders(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error)
+}
+
+type OrderRepository interface {
+	GetOrdersByOrderUIDs(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error)
+	ListOrders(ctx context.Context, filter model.OrderFilter, after *model.OrderCursor, limit int) ([]*model.Order, error)
+	OrderStats(ctx context.Context, filter model.OrderFilter) (*model.OrderStats, error)
+}
+
+// Request is a GraphQL request as sent over http
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is the result of a request, errors of single fields don't fail the whole request
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []*QueryError   `json:"errors,omitempty"`
+}
+
+// QueryError is an error of a request or of a single field, with its path in the query
+type QueryError = gqlerrors.QueryError
+
+// Schema executes queries against orders
+type Schema struct {
+	sugar    *zap.SugaredLogger
+	schema   *graphql.Schema
+	resolver *queryResolver
+}
+
+// NewSchema parses the schema. Single orders are read with the cache-then-db reader, listings and their sub-resources with orderRepo.
+func NewSchema(sugar *zap.SugaredLogger, reader OrderReader, orderRepo OrderRepository) (*Schema, error) {
+	resolver := &queryResolver{reader: reader, orderRepo: orderRepo}
+	schema, err := graphql.ParseSchema(schemaSDL, resolver,
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(maxDepth),
+		graphql.MaxParallelism(maxParallelism),
+		graphql.Logger(panicLogger{sugar: sugar}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("graphql schema: %w", err)
+	}
+	return &Schema{sugar: sugar, schema: schema, resolver: resolver}, nil
+}
+
+// Execute runs a request. mask hides personal data of deliveries and forbids filtering by phone or email.
+func (s *Schema) Execute(ctx context.Context, req Request, mask bool) *Response {
+	ctx = withRequestState(ctx, &requestState{sugar: s.sugar, loaders: s.resolver.newLoaders(), mask: mask})
+	resp := s.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	return &Response{Data: resp.Data, Errors: resp.Errors}
+}
+
+// panicLogger logs panics of resolvers, the request gets an error for the field
+type panicLogger struct {
+	sugar *zap.SugaredLogger
+}
+
+func (l panicLogger) LogPanic(ctx context.Context, value any) {
+	l.sugar.Errorw("panic in graphql resolver", "panic", fmt.Sprint(value))
+}
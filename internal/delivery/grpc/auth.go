@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"MockOrderService/api/orderpb"
+	"MockOrderService/internal/auth"
+	"MockOrderService/internal/service"
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+type Authenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error)
+	AuthenticateBearer(token string) (*auth.Principal, error)
+}
+
+const apiKeyMetadata = "x-api-key"
+
+// anonymousAdmin is the principal of every call when authentication is disabled
+var anonymousAdmin = &auth.Principal{Subject: "anonymous", Role: auth.RoleAdmin, Method: auth.MethodNone}
+
+// unmaskedRole is the role needed to see personal data of orders verbatim, the same as over http
+const unmaskedRole = auth.RoleSupport
+
+// isPublic tells if a method is served without credentials: health checks and reflection
+func isPublic(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/") ||
+		strings.HasPrefix(fullMethod, "/grpc.reflection.")
+}
+
+func (s *Server) authenticateUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authenticateStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate resolves the x-api-key or the bearer token of the call to a principal.
+// Every method of the order service requires the viewer role.
+func (s *Server) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if isPublic(fullMethod) {
+		return ctx, nil
+	}
+	if s.authenticator == nil {
+		return auth.WithPrincipal(ctx, anonymousAdmin), nil
+	}
+
+	principal, err := s.credentials(ctx)
+	if err != nil {
+		if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+			s.sugar.Infow("grpc call is not authenticated", "method", fullMethod, "reason", err)
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		s.sugar.Errorw("couldn't authenticate grpc call", "method", fullMethod, "error", err)
+		return nil, statusOf(service.ClassifyDBError(err), "couldn't check credentials")
+	}
+	if !principal.Role.Allows(auth.RoleViewer) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s role is required", auth.RoleViewer)
+	}
+	return auth.WithPrincipal(ctx, principal), nil
+}
+
+// credentials authenticates the api key if present, the bearer token otherwise
+func (s *Server) credentials(ctx context.Context) (*auth.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(apiKeyMetadata); len(keys) > 0 && keys[0] != "" {
+		return s.authenticator.AuthenticateAPIKey(ctx, keys[0])
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		scheme, token, ok := strings.Cut(values[0], " ")
+		if ok && strings.EqualFold(scheme, "Bearer") && token != "" {
+			return s.authenticator.AuthenticateBearer(strings.TrimSpace(token))
+		}
+	}
+	return nil, auth.ErrNoCredentials
+}
+
+// hasRole tells if the principal of the call has at least the given role
+func hasRole(ctx context.Context, role auth.Role) bool {
+	principal := auth.PrincipalFrom(ctx)
+	return principal != nil && principal.Role.Allows(role)
+}
+
+// maskPII tells if personal data must be masked in the response, following the rules of the http api:
+// callers below unmaskedRole always get it masked and asking them for unmasked data is an error
+func maskPII(ctx context.Context, mode orderpb.MaskMode) (bool, error) {
+	allowed := hasRole(ctx, unmaskedRole)
+	switch mode {
+	case orderpb.MaskMode_MASK_MODE_MASKED:
+		return true, nil
+	case orderpb.MaskMode_MASK_MODE_UNMASKED:
+		if !allowed {
+			return false, status.Errorf(codes.PermissionDenied, "%s role is required to see unmasked personal data", unmaskedRole)
+		}
+		return false, nil
+	case orderpb.MaskMode_MASK_MODE_UNSPECIFIED:
+		return !allowed, nil
+	default:
+		return true, status.Errorf(codes.InvalidArgument, "unknown mask mode: %v", mode)
+	}
+}
+
+// contextStream replaces the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (cs *contextStream) Context() context.Context {
+	return cs.ctx
+}
@@ -0,0 +1,148 @@
+package grpc
+
+import (
+	"MockOrderService/api/orderpb"
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/service"
+	"fmt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// parseParts turns the include field of a request into order parts, all of them if it's empty
+func parseParts(include []orderpb.Part) (model.OrderParts, error) {
+	if len(include) == 0 {
+		return model.AllOrderParts, nil
+	}
+	var parts model.OrderParts
+	for _, part := range include {
+		switch part {
+		case orderpb.Part_PART_DELIVERY:
+			parts.Delivery = true
+		case orderpb.Part_PART_PAYMENT:
+			parts.Payment = true
+		case orderpb.Part_PART_ITEMS:
+			parts.Items = true
+		default:
+			return parts, fmt.Errorf("unknown part: %v", part)
+		}
+	}
+	return parts, nil
+}
+
+// parseFilter turns a request filter into a model filter, nil doesn't filter
+func parseFilter(filter *orderpb.OrderFilter) (model.OrderFilter, error) {
+	if filter == nil {
+		return model.OrderFilter{}, nil
+	}
+	f := model.OrderFilter{
+		CustomerID:      filter.GetCustomerId(),
+		DeliveryService: filter.GetDeliveryService(),
+		Locale:          filter.GetLocale(),
+		Phone:           filter.GetPhone(),
+		Email:           filter.GetEmail(),
+	}
+	if ts := filter.GetCreatedFrom(); ts != nil {
+		if err := ts.CheckValid(); err != nil {
+			return f, fmt.Errorf("invalid created_from: %w", err)
+		}
+		from := ts.AsTime()
+		f.CreatedFrom = &from
+	}
+	if ts := filter.GetCreatedTo(); ts != nil {
+		if err := ts.CheckValid(); err != nil {
+			return f, fmt.Errorf("invalid created_to: %w", err)
+		}
+		to := ts.AsTime()
+		f.CreatedTo = &to
+	}
+	if f.CreatedFrom != nil && f.CreatedTo != nil && !f.CreatedFrom.Before(*f.CreatedTo) {
+		return f, fmt.Errorf("created_from must be before created_to")
+	}
+	return f, nil
+}
+
+// toProtoOrder converts an order, sub-resources not in parts are left out
+func toProtoOrder(order *model.Order, parts model.OrderParts) *orderpb.Order {
+	pb := &orderpb.Order{
+		OrderUid:          order.OrderUID,
+		TrackNumber:       order.TrackNumber,
+		Entry:             order.Entry,
+		Locale:            order.Locale,
+		InternalSignature: order.InternalSignature,
+		CustomerId:        order.CustomerID,
+		DeliveryService:   order.DeliveryService,
+		Shardkey:          order.Shardkey,
+		SmId:              order.SmID,
+		DateCreated:       timestamp(order.DateCreated),
+		OofShard:          order.OofShard,
+		CreatedAt:         timestamp(order.CreatedAt),
+	}
+	if parts.Delivery && order.Delivery != nil {
+		d := order.Delivery
+		pb.Delivery = &orderpb.Delivery{
+			Name:    d.Name,
+			Phone:   d.Phone,
+			Zip:     d.Zip,
+			City:    d.City,
+			Address: d.Address,
+			Region:  d.Region,
+			Email:   d.Email,
+		}
+	}
+	if parts.Payment && order.Payment != nil {
+		p := order.Payment
+		pb.Payment = &orderpb.Payment{
+			TransactionId: p.TransactionID,
+			RequestId:     p.RequestID,
+			Currency:      p.Currency,
+			Provider:      p.Provider,
+			Amount:        p.Amount,
+			PaymentDt:     p.PaymentDt,
+			Bank:          p.Bank,
+			DeliveryCost:  p.DeliveryCost,
+			GoodsTotal:    p.GoodsTotal,
+			CustomFee:     p.CustomFee,
+		}
+	}
+	if parts.Items {
+		for _, item := range order.Items {
+			pb.Items = append(pb.Items, &orderpb.Item{
+				ChrtId:      item.ChrtID,
+				TrackNumber: item.TrackNumber,
+				Price:       item.Price,
+				Rid:         item.Rid,
+				Name:        item.Name,
+				Sale:        item.Sale,
+				Size:        item.Size,
+				TotalPrice:  item.TotalPrice,
+				NmId:        item.NmID,
+				Brand:       item.Brand,
+				Status:      item.Status,
+			})
+		}
+	}
+	return pb
+}
+
+// toProtoEvent converts a feed event, the order is already masked if needed
+func toProtoEvent(ev service.OrderEvent, order *model.Order) *orderpb.OrderEvent {
+	pb := &orderpb.OrderEvent{Id: ev.ID, OrderUid: ev.OrderUID, Time: timestamppb.New(ev.At)}
+	switch ev.Type {
+	case service.OrderStored:
+		pb.Type = orderpb.OrderEvent_TYPE_STORED
+	case service.OrderErased:
+		pb.Type = orderpb.OrderEvent_TYPE_ERASED
+	}
+	if order != nil {
+		pb.Order = toProtoOrder(order, model.AllOrderParts)
+	}
+	return pb
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
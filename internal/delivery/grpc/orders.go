@@ -0,0 +1,175 @@
+package grpc
+
+import (
+	"MockOrderService/api/orderpb"
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/pii"
+	"MockOrderService/internal/service"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBatchSize limits the amount of order_uids in a single BatchGetOrders call, the same as over http
+const maxBatchSize = 100
+
+// GetOrder returns an order from cache or db
+func (s *Server) GetOrder(ctx context.Context, req *orderpb.GetOrderRequest) (*orderpb.Order, error) {
+	if req.GetOrderUid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_uid is empty")
+	}
+	parts, err := parseParts(req.GetInclude())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	mask, err := maskPII(ctx, req.GetMask())
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.reader.GetOrder(ctx, req.GetOrderUid(), parts)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			s.sugar.Errorw("couldn't get order", "orderUID", req.GetOrderUid(), "error", err)
+		}
+		return nil, statusOf(err, "couldn't get order")
+	}
+	if mask {
+		order = pii.MaskOrder(order)
+	}
+	return toProtoOrder(order, parts), nil
+}
+
+// BatchGetOrders returns several orders at once, results keep the request order
+func (s *Server) BatchGetOrders(ctx context.Context, req *orderpb.BatchGetOrdersRequest) (*orderpb.BatchGetOrdersResponse, error) {
+	if len(req.GetOrderUids()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "order_uids is empty")
+	}
+	if len(req.GetOrderUids()) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "too many order_uids, max is %d", maxBatchSize)
+	}
+	parts, err := parseParts(req.GetInclude())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	mask, err := maskPII(ctx, req.GetMask())
+	if err != nil {
+		return nil, err
+	}
+
+	// duplicates are looked up once
+	unique := make([]string, 0, len(req.GetOrderUids()))
+	seen := make(map[string]struct{}, len(req.GetOrderUids()))
+	for _, orderUID := range req.GetOrderUids() {
+		if _, ok := seen[orderUID]; ok || orderUID == "" {
+			continue
+		}
+		seen[orderUID] = struct{}{}
+		unique = append(unique, orderUID)
+	}
+
+	orders, err := s.reader.GetOrders(ctx, unique, parts)
+	if err != nil {
+		s.sugar.Errorw("couldn't get orders", "count", len(unique), "error", err)
+		return nil, statusOf(err, "couldn't get orders")
+	}
+
+	resp := &orderpb.BatchGetOrdersResponse{Results: make([]*orderpb.BatchGetResult, 0, len(req.GetOrderUids()))}
+	for _, orderUID := range req.GetOrderUids() {
+		result := &orderpb.BatchGetResult{OrderUid: orderUID}
+		if order, ok := orders[orderUID]; ok {
+			if mask {
+				order = pii.MaskOrder(order)
+			}
+			result.Found = true
+			result.Order = toProtoOrder(order, parts)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+// ListOrders streams stored orders matching the filter, like the http export does
+func (s *Server) ListOrders(req *orderpb.ListOrdersRequest, stream orderpb.OrderService_ListOrdersServer) error {
+	ctx := stream.Context()
+	filter, err := parseFilter(req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	mask, err := maskPII(ctx, req.GetMask())
+	if err != nil {
+		return err
+	}
+	// otherwise masked personal data could be guessed by filtering
+	if (filter.Phone != "" || filter.Email != "") && !hasRole(ctx, unmaskedRole) {
+		return status.Errorf(codes.PermissionDenied, "%s role is required to filter by phone or email", unmaskedRole)
+	}
+
+	listed := 0
+	var sendErr error
+	err = s.orderRepo.ExportOrders(ctx, filter, func(order *model.Order) error {
+		if mask {
+			order = pii.MaskOrder(order)
+		}
+		if sendErr = stream.Send(toProtoOrder(order, model.AllOrderParts)); sendErr != nil {
+			return sendErr
+		}
+		listed++
+		return nil
+	})
+	if err != nil {
+		if sendErr != nil {
+			// the client is gone, the status is already decided by the transport
+			return sendErr
+		}
+		s.sugar.Errorw("couldn't list orders", "orders", listed, "error", err)
+		return statusOf(service.ClassifyDBError(err), "couldn't list orders")
+	}
+	s.sugar.Infow("orders listed", "orders", listed, "masked", mask)
+	return nil
+}
+
+// WatchOrders streams events of the order feed matching the filter until the client cancels the call
+func (s *Server) WatchOrders(req *orderpb.WatchOrdersRequest, stream orderpb.OrderService_WatchOrdersServer) error {
+	ctx := stream.Context()
+	filter := service.OrderEventFilter{
+		CustomerID:      req.GetFilter().GetCustomerId(),
+		DeliveryService: req.GetFilter().GetDeliveryService(),
+		Locale:          req.GetFilter().GetLocale(),
+		ItemStatus:      req.ItemStatus,
+	}
+	mask, err := maskPII(ctx, req.GetMask())
+	if err != nil {
+		return err
+	}
+	if s.feed == nil {
+		return status.Error(codes.Unimplemented, "order feed is disabled")
+	}
+
+	events, unsubscribe := s.feed.Subscribe(s.cfg.WatchBuffer)
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case ev, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell behind, events were dropped")
+			}
+			if !filter.Match(ev) {
+				continue
+			}
+			order := ev.Order
+			if mask && order != nil {
+				order = pii.MaskOrder(order)
+			}
+			if err := stream.Send(toProtoEvent(ev, order)); err != nil {
+				return err
+			}
+		}
+	}
+}
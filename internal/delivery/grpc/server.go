@@ -0,0 +1,211 @@
+// Package grpc serves the order API over gRPC next to the http api, see api/proto/orders/v1/orders.proto.
+package grpc
+
+import (
+	"MockOrderService/api/orderpb"
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/service"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"net"
+	"time"
+)
+
+type OrderReader interface {
+	GetOrder(ctx context.Context, orderUID string, parts model.OrderParts) (*model.Order, error)
+	GetOrders(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error)
+}
+
+type OrderRepository interface {
+	ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(order *model.Order) error) error
+}
+
+type OrderFeed interface {
+	Subscribe(buffer int) (<-chan service.OrderEvent, func())
+}
+
+// ServerConfig holds grpc server settings
+type ServerConfig struct {
+	// Addr is the listen address, e.g. ":9090"
+	Addr string
+	// Timeout limits unary calls unless the client sets a shorter deadline, 0 disables it.
+	// Streams only follow the deadline of the client.
+	Timeout time.Duration
+	// WatchBuffer is the amount of events a watcher may fall behind before it's disconnected
+	WatchBuffer int
+}
+
+// DefaultWatchBuffer is used if ServerConfig.WatchBuffer isn't set
+const DefaultWatchBuffer = 256
+
+type Server struct {
+	orderpb.UnimplementedOrderServiceServer
+
+	sugar         *zap.SugaredLogger
+	cfg           ServerConfig
+	reader        OrderReader
+	orderRepo     OrderRepository
+	feed          OrderFeed
+	authenticator Authenticator
+	health        *health.Server
+	server        *grpc.Server
+	// done is closed on shutdown, so watchers end and graceful stop doesn't wait for them forever
+	done chan struct{}
+}
+
+// NewServer creates grpc server with the order, health and reflection services.
+// Without authenticator authentication is disabled and every call is served as admin.
+func NewServer(sugar *zap.SugaredLogger, reader OrderReader, orderRepo OrderRepository, feed OrderFeed, authenticator Authenticator, cfg ServerConfig) *Server {
+	if cfg.WatchBuffer <= 0 {
+		cfg.WatchBuffer = DefaultWatchBuffer
+	}
+	s := &Server{
+		sugar:         sugar,
+		cfg:           cfg,
+		reader:        reader,
+		orderRepo:     orderRepo,
+		feed:          feed,
+		authenticator: authenticator,
+		health:        health.NewServer(),
+		done:          make(chan struct{}),
+	}
+	s.server = grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(s.logUnary, s.recoverUnary, s.authenticateUnary, s.timeoutUnary),
+		grpc.ChainStreamInterceptor(s.logStream, s.recoverStream, s.authenticateStream),
+	)
+	orderpb.RegisterOrderServiceServer(s.server, s)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	reflection.Register(s.server)
+	return s
+}
+
+// Start listens on the configured address and serves calls until Shutdown
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	s.health.SetServingStatus(orderpb.OrderService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	s.sugar.Infow("starting grpc server", "addr", s.cfg.Addr)
+	if err := s.server.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown reports NOT_SERVING, ends watchers and waits for running calls until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+	close(s.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// statusOf maps storage errors to grpc codes, the way the http api maps them to problems
+func statusOf(err error, msg string) error {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return status.Error(codes.NotFound, msg)
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, msg)
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, msg)
+	case errors.Is(err, service.ErrCacheUnavailable):
+		return status.Errorf(codes.Unavailable, "%s: %v", msg, service.ErrCacheUnavailable)
+	case errors.Is(err, service.ErrDBUnavailable):
+		return status.Errorf(codes.Unavailable, "%s: %v", msg, service.ErrDBUnavailable)
+	default:
+		return status.Error(codes.Internal, msg)
+	}
+}
+
+func (s *Server) timeoutUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.cfg.Timeout <= 0 {
+		return handler(ctx, req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+func (s *Server) logUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.logCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func (s *Server) logStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	s.logCall(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+// logCall logs every call with its code and latency, server errors as warnings.
+// Health checks are only logged if they fail.
+func (s *Server) logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	if isPublic(method) && code == codes.OK {
+		return
+	}
+	fields := []any{"method", method, "code", code.String(), "duration", time.Since(start)}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields = append(fields, "traceID", spanContext.TraceID().String())
+	}
+	switch code {
+	case codes.Internal, codes.Unavailable, codes.Unknown, codes.DataLoss:
+		s.sugar.Warnw("grpc call", fields...)
+	default:
+		s.sugar.Infow("grpc call", fields...)
+	}
+}
+
+func (s *Server) recoverUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = s.recovered(info.FullMethod, rec)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func (s *Server) recoverStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = s.recovered(info.FullMethod, rec)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// recovered turns a handler panic into an INTERNAL status
+func (s *Server) recovered(method string, rec any) error {
+	// the logger adds the stack trace of error entries, it includes the panicking frame
+	s.sugar.Errorw("panic in grpc handler", "method", method, "panic", fmt.Sprint(rec))
+	return status.Error(codes.Internal, "internal error")
+}
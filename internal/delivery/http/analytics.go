@@ -0,0 +1,221 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/service"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBreakdownLimit   = 50
+	maxBreakdownLimit       = 500
+	defaultTopProductsLimit = 10
+	maxTopProductsLimit     = 100
+)
+
+type OrderAnalytics interface {
+	AnalyticsRefreshedAt(ctx context.Context) (time.Time, error)
+	RefreshAnalytics(ctx context.Context, maxAge time.Duration) (bool, error)
+	OrderVolume(ctx context.Context, interval string, filter model.AnalyticsFilter) ([]model.VolumeRow, error)
+	OrderBreakdown(ctx context.Context, dimension string, filter model.AnalyticsFilter, limit int) ([]model.BreakdownRow, error)
+	BasketStats(ctx context.Context, filter model.AnalyticsFilter) ([]model.BasketStats, error)
+	TopProducts(ctx context.Context, sortBy string, filter model.AnalyticsFilter, limit int) ([]model.TopProduct, error)
+	TopBrands(ctx context.Context, sortBy string, filter model.AnalyticsFilter, limit int) ([]model.TopBrand, error)
+}
+
+// analyticsResponse is a report, RefreshedAt tells how stale the aggregates behind it are
+type analyticsResponse struct {
+	RefreshedAt time.Time `json:"refreshed_at"`
+	Rows        any       `json:"rows"`
+}
+
+type analyticsRefreshResponse struct {
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+// handleOrderVolume returns orders, revenue and items per day or week
+func (as *ApiServer) handleOrderVolume(w http.ResponseWriter, r *http.Request) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = model.IntervalDay
+	}
+	if interval != model.IntervalDay && interval != model.IntervalWeek {
+		writeProblem(w, r, problemInvalidRequest, "interval must be day or week", as.sugar)
+		return
+	}
+	filter, ok := as.parseAnalyticsFilter(w, r)
+	if !ok {
+		return
+	}
+	as.writeReport(w, r, func(ctx context.Context) (any, error) {
+		return as.cfg.Analytics.OrderVolume(ctx, interval, filter)
+	})
+}
+
+// handleOrderBreakdown returns the volume per delivery service, payment provider, bank, city or region
+func (as *ApiServer) handleOrderBreakdown(w http.ResponseWriter, r *http.Request) {
+	dimension := r.URL.Query().Get("by")
+	switch dimension {
+	case model.DimensionDeliveryService, model.DimensionProvider, model.DimensionBank, model.DimensionCity, model.DimensionRegion:
+	default:
+		writeProblem(w, r, problemInvalidRequest, "by must be one of delivery_service, provider, bank, city, region", as.sugar)
+		return
+	}
+	filter, ok := as.parseAnalyticsFilter(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := as.parseAnalyticsLimit(w, r, defaultBreakdownLimit, maxBreakdownLimit)
+	if !ok {
+		return
+	}
+	as.writeReport(w, r, func(ctx context.Context) (any, error) {
+		return as.cfg.Analytics.OrderBreakdown(ctx, dimension, filter, limit)
+	})
+}
+
+// handleBasketStats returns the average order amount and size per currency
+func (as *ApiServer) handleBasketStats(w http.ResponseWriter, r *http.Request) {
+	filter, ok := as.parseAnalyticsFilter(w, r)
+	if !ok {
+		return
+	}
+	as.writeReport(w, r, func(ctx context.Context) (any, error) {
+		return as.cfg.Analytics.BasketStats(ctx, filter)
+	})
+}
+
+// handleTopProducts returns the best selling products by revenue or by sold items
+func (as *ApiServer) handleTopProducts(w http.ResponseWriter, r *http.Request) {
+	sortBy, filter, limit, ok := as.parseTopParams(w, r)
+	if !ok {
+		return
+	}
+	as.writeReport(w, r, func(ctx context.Context) (any, error) {
+		return as.cfg.Analytics.TopProducts(ctx, sortBy, filter, limit)
+	})
+}
+
+// handleTopBrands returns the best selling brands by revenue or by sold items
+func (as *ApiServer) handleTopBrands(w http.ResponseWriter, r *http.Request) {
+	sortBy, filter, limit, ok := as.parseTopParams(w, r)
+	if !ok {
+		return
+	}
+	as.writeReport(w, r, func(ctx context.Context) (any, error) {
+		return as.cfg.Analytics.TopBrands(ctx, sortBy, filter, limit)
+	})
+}
+
+// parseTopParams parses sort, limit and the filter of the top reports, it writes a problem if they are invalid
+func (as *ApiServer) parseTopParams(w http.ResponseWriter, r *http.Request) (string, model.AnalyticsFilter, int, bool) {
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = "revenue"
+	}
+	if sortBy != "revenue" && sortBy != "items" {
+		writeProblem(w, r, problemInvalidRequest, "sort must be revenue or items", as.sugar)
+		return "", model.AnalyticsFilter{}, 0, false
+	}
+	filter, ok := as.parseAnalyticsFilter(w, r)
+	if !ok {
+		return "", model.AnalyticsFilter{}, 0, false
+	}
+	limit, ok := as.parseAnalyticsLimit(w, r, defaultTopProductsLimit, maxTopProductsLimit)
+	if !ok {
+		return "", model.AnalyticsFilter{}, 0, false
+	}
+	return sortBy, filter, limit, true
+}
+
+// handleAnalyticsRefresh refreshes the aggregates right away, 409 if another replica is refreshing them
+func (as *ApiServer) handleAnalyticsRefresh(w http.ResponseWriter, r *http.Request) {
+	refreshed, err := as.cfg.Analytics.RefreshAnalytics(r.Context(), 0)
+	if err != nil {
+		as.sugar.Errorw("ANALYTICS: refresh failed", "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "analytics refresh failed")
+		return
+	}
+	if !refreshed {
+		writeProblem(w, r, problemRequestInProgress, "analytics is being refreshed by another instance", as.sugar)
+		return
+	}
+	refreshedAt, err := as.cfg.Analytics.AnalyticsRefreshedAt(r.Context())
+	if err != nil {
+		as.sugar.Errorw("couldn't get analytics refresh time", "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't get analytics refresh time")
+		return
+	}
+	as.sugar.Infow("ANALYTICS: aggregates refreshed on request", "refreshed_at", refreshedAt)
+	w.Header().Set("Cache-Control", as.cacheControl(RouteAdmin))
+	writeJSON(w, http.StatusOK, analyticsRefreshResponse{RefreshedAt: refreshedAt}, as.sugar)
+}
+
+// writeReport builds a report and writes it with Last-Modified set to the refresh time of the aggregates
+func (as *ApiServer) writeReport(w http.ResponseWriter, r *http.Request, build func(ctx context.Context) (any, error)) {
+	refreshedAt, err := as.cfg.Analytics.AnalyticsRefreshedAt(r.Context())
+	if err != nil {
+		as.sugar.Errorw("couldn't get analytics refresh time", "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't build report")
+		return
+	}
+	rows, err := build(r.Context())
+	if err != nil {
+		as.sugar.Errorw("couldn't build report", "path", r.URL.Path, "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't build report")
+		return
+	}
+	as.writeCacheableJSON(w, r, RouteAnalytics, analyticsResponse{RefreshedAt: refreshedAt, Rows: rows}, &refreshedAt)
+}
+
+// parseAnalyticsFilter reads from and to (dates, to is exclusive) and currency, writing a problem if they are invalid
+func (as *ApiServer) parseAnalyticsFilter(w http.ResponseWriter, r *http.Request) (model.AnalyticsFilter, bool) {
+	query := r.URL.Query()
+	var filter model.AnalyticsFilter
+	for _, param := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			writeProblem(w, r, problemInvalidRequest, param.name+" must be a date like 2021-11-26", as.sugar)
+			return filter, false
+		}
+		*param.dst = &date
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		writeProblem(w, r, problemInvalidRequest, "to must be after from", as.sugar)
+		return filter, false
+	}
+	if currency := query.Get("currency"); currency != "" {
+		if len(currency) != 3 {
+			writeProblem(w, r, problemInvalidRequest, "currency must be a three-letter code", as.sugar)
+			return filter, false
+		}
+		filter.Currency = strings.ToUpper(currency)
+	}
+	return filter, true
+}
+
+// parseAnalyticsLimit reads ?limit=, writing a problem if it is out of range
+func (as *ApiServer) parseAnalyticsLimit(w http.ResponseWriter, r *http.Request, def, max int) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		writeProblem(w, r, problemInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", max), as.sugar)
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"MockOrderService/internal/auth"
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/service"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// createdAPIKey is the only response which contains the key itself
+type createdAPIKey struct {
+	*model.APIKey
+	Key string `json:"key"`
+}
+
+type apiKeysResponse struct {
+	APIKeys []*model.APIKey `json:"api_keys"`
+}
+
+// handleListAPIKeys returns all api keys without their values
+func (as *ApiServer) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := as.access.APIKeys.ListAPIKeys(r.Context())
+	if err != nil {
+		as.sugar.Errorw("couldn't list api keys", "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't list api keys")
+		return
+	}
+	w.Header().Set("Cache-Control", as.cacheControl(RouteAdmin))
+	writeJSON(w, http.StatusOK, &apiKeysResponse{APIKeys: keys}, as.sugar)
+}
+
+// handleCreateAPIKey generates a key. Only its hash is stored, the key is returned once.
+func (as *ApiServer) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, problemInvalidRequest, "invalid request body", as.sugar)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeProblem(w, r, problemInvalidRequest, "name is required", as.sugar)
+		return
+	}
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		as.sugar.Errorw("couldn't generate api key", "error", err)
+		writeProblem(w, r, problemInternal, "couldn't generate api key", as.sugar)
+		return
+	}
+	stored := &model.APIKey{Name: req.Name, Role: string(role), Prefix: prefix, KeyHash: hash}
+	if err = as.access.APIKeys.CreateAPIKey(r.Context(), stored); err != nil {
+		as.sugar.Errorw("couldn't save api key", "name", req.Name, "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't save api key")
+		return
+	}
+	as.sugar.Infow("api key created", "id", stored.ID, "name", stored.Name, "role", stored.Role,
+		"by", auth.PrincipalFrom(r.Context()).Subject)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, &createdAPIKey{APIKey: stored, Key: key}, as.sugar)
+}
+
+// handleRevokeAPIKey revokes a key, it stops working on other instances within the key cache TTL
+func (as *ApiServer) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, "invalid api key id", as.sugar)
+		return
+	}
+	if err = as.access.APIKeys.RevokeAPIKey(r.Context(), int32(id)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeProblem(w, r, problemNotFound, "no active api key found", as.sugar)
+			return
+		}
+		as.sugar.Errorw("couldn't revoke api key", "id", id, "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't revoke api key")
+		return
+	}
+	if as.access.Authenticator != nil {
+		as.access.Authenticator.ForgetAPIKeys()
+	}
+	as.sugar.Infow("api key revoked", "id", id, "by", auth.PrincipalFrom(r.Context()).Subject)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,45 +1,151 @@
 package http
 
 import (
+	"MockOrderService/internal/auth"
+	"MockOrderService/internal/delivery/graphql"
 	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/pii"
+	"MockOrderService/internal/ratelimit"
+	"MockOrderService/internal/service"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
-	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"net/http"
 	"time"
 )
 
 type OrderRepository interface {
-	GetOrderByOrderUID(ctx context.Context, orderUID string) (*model.Order, error)
+	GetOrderByOrderUID(ctx context.Context, orderUID string, parts model.OrderParts) (*model.Order, error)
+	GetOrdersByOrderUIDs(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error)
+	ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(order *model.Order) error) error
+	SearchOrders(ctx context.Context, search model.OrderSearch) ([]*model.OrderSearchHit, error)
+	ListOrders(ctx context.Context, filter model.OrderFilter, after *model.OrderCursor, limit int) ([]*model.Order, error)
+	EraseCustomer(ctx context.Context, customerID string, erasure *model.Erasure) ([]string, error)
+	ListErasures(ctx context.Context, customerID string, limit int) ([]*model.Erasure, error)
 }
 
 type CacheRepository interface {
 	GetOrder(ctx context.Context, orderUID string) (*model.Order, error)
+	GetOrders(ctx context.Context, orderUIDs []string) (map[string]*model.Order, error)
+	DeleteOrder(ctx context.Context, orderUID string) error
+}
+
+type OrderFeed interface {
+	Publish(ev service.OrderEvent)
+	Subscribe(buffer int) (<-chan service.OrderEvent, func())
+	Replay(ctx context.Context, afterID int64) ([]service.OrderEvent, error)
+}
+
+type OrderQueries interface {
+	Execute(ctx context.Context, req graphql.Request, mask bool) *graphql.Response
+}
+
+type OrderSpool interface {
+	Pending() int
+}
+
+// SpoolRegistry knows the pending records of the spools of all replicas
+type SpoolRegistry interface {
+	PendingSpools(ctx context.Context) (map[string]int, error)
+}
+
+type Reconciler interface {
+	Stats() service.ReconcileStats
+	Run(ctx context.Context) (*service.ReconcileReport, error)
+}
+
+// ApiServerConfig holds optional api server settings
+type ApiServerConfig struct {
+	// ValidateResponses logs responses which don't match the OpenAPI document
+	ValidateResponses bool
+	// CacheControl maps route names (RouteOrder, ...) to Cache-Control policies, see DefaultCacheControl
+	CacheControl map[string]string
+	// RateLimiter enforces rate limits per client and route, nil disables rate limiting
+	RateLimiter RateLimiter
+	// RateLimits maps route names to limits like "100/1m,burst=20" or "off", see DefaultRateLimits
+	RateLimits map[string]string
+	// TrustProxy takes the client ip of anonymous requests from X-Forwarded-For
+	TrustProxy bool
+	// Timeouts maps route names to request deadlines, 0 disables the deadline, see DefaultTimeouts
+	Timeouts map[string]time.Duration
+	// Feed streams order events to /api/orders/stream and /api/orders/ws and is told about erasures, nil disables streaming
+	Feed OrderFeed
+	// GraphQL serves order queries at /api/graphql, nil disables it
+	GraphQL OrderQueries
+	// Analytics serves reports under /api/analytics, nil disables them
+	Analytics OrderAnalytics
+	// Rejections serves rejected messages at /api/rejections and loses the customer's ones on erasure, nil disables it
+	Rejections RejectionLog
+	// Operations serves live pipeline metrics at /api/operations, nil disables them
+	Operations Operations
+	// Spool holds orders received while the database was down, customers aren't erased until it's flushed
+	Spool OrderSpool
+	// Spools tells about pending orders in spools of other replicas, customers aren't erased until they're flushed
+	Spools SpoolRegistry
+	// EncryptedDeliveries tells that delivery data is encrypted at rest, so addresses can't be searched
+	EncryptedDeliveries bool
 }
 
 type ApiServer struct {
-	sugar     *zap.SugaredLogger
-	ctx       context.Context
-	orderRepo OrderRepository
-	cacheRepo CacheRepository
-	server    *http.Server
+	sugar      *zap.SugaredLogger
+	ctx        context.Context
+	cfg        ApiServerConfig
+	rateLimits map[string]ratelimit.Limit
+	validator  *openAPIValidator
+	orderRepo  OrderRepository
+	cacheRepo  CacheRepository
+	reader     *service.OrderReader
+	reconciler Reconciler
+	ingestion  OrderIngestion
+	access     AccessControl
+	server     *http.Server
 }
 
-type apiError struct {
-	Error string `json:"Error"`
+// maxBatchSize limits the amount of orderUIDs in a single batchGet request
+const maxBatchSize = 100
+
+type batchGetRequest struct {
+	OrderUIDs []string `json:"order_uids"`
 }
 
-func NewApiServer(sugar *zap.SugaredLogger, ctx context.Context, orderRepo OrderRepository, cacheRepo CacheRepository) *ApiServer {
-	return &ApiServer{
-		sugar:     sugar,
-		ctx:       ctx,
-		orderRepo: orderRepo,
-		cacheRepo: cacheRepo,
+type batchGetResult struct {
+	OrderUID string `json:"order_uid"`
+	Found    bool   `json:"found"`
+	// Order is *model.Order or its sparse representation
+	Order any `json:"order,omitempty"`
+}
+
+type batchGetResponse struct {
+	Results []batchGetResult `json:"results"`
+}
+
+// NewApiServer creates api server. Requests are authenticated and validated against the OpenAPI document.
+func NewApiServer(sugar *zap.SugaredLogger, ctx context.Context, orderRepo OrderRepository, cacheRepo CacheRepository, reconciler Reconciler, ingestion OrderIngestion, access AccessControl, cfg ApiServerConfig) (*ApiServer, error) {
+	validator, err := newOpenAPIValidator(sugar, cfg.ValidateResponses)
+	if err != nil {
+		return nil, err
 	}
+	rateLimits, err := parseRateLimits(cfg.RateLimits)
+	if err != nil {
+		return nil, err
+	}
+	return &ApiServer{
+		sugar:      sugar,
+		ctx:        ctx,
+		cfg:        cfg,
+		rateLimits: rateLimits,
+		validator:  validator,
+		orderRepo:  orderRepo,
+		cacheRepo:  cacheRepo,
+		reader:     service.NewOrderReader(sugar, orderRepo, cacheRepo),
+		reconciler: reconciler,
+		ingestion:  ingestion,
+		access:     access,
+	}, nil
 }
 
 // StartApiServer starts api server in a separate goroutine.
@@ -47,11 +153,49 @@ func NewApiServer(sugar *zap.SugaredLogger, ctx context.Context, orderRepo Order
 // If server fails to start or shutdown, logs error.
 func (as *ApiServer) StartApiServer() error {
 	r := mux.NewRouter()
-	r.HandleFunc("/api/order/{orderUID}", as.handleOrder)
+	r.NotFoundHandler = problemHandler(problemNotFound, as.sugar)
+	r.MethodNotAllowedHandler = problemHandler(problemMethodNotAllowed, as.sugar)
+	r.Use(nameSpan, as.authenticate, as.validator.Middleware)
+	r.HandleFunc("/api/openapi.json", as.handleOpenAPI).Methods(http.MethodGet)
+	r.HandleFunc("/api/order/{orderUID}", as.route(RouteOrder, auth.RoleViewer, as.handleOrder))
+	r.HandleFunc("/api/orders:batchGet", as.route(RouteBatch, auth.RoleViewer, as.handleBatchGet)).Methods(http.MethodPost)
+	r.HandleFunc("/api/orders", as.route(RouteIngest, auth.RoleSupport, as.handleIngest)).Methods(http.MethodPost)
+	r.HandleFunc("/api/orders", as.route(RouteList, auth.RoleViewer, as.handleListOrders)).Methods(http.MethodGet)
+	r.HandleFunc("/api/orders/export", as.route(RouteExport, auth.RoleViewer, as.handleExport)).Methods(http.MethodGet)
+	r.HandleFunc("/api/orders/search", as.route(RouteSearch, auth.RoleViewer, as.handleSearch)).Methods(http.MethodGet)
+	if as.cfg.Feed != nil {
+		r.HandleFunc("/api/orders/stream", as.route(RouteStream, auth.RoleViewer, as.handleStream)).Methods(http.MethodGet)
+		r.HandleFunc("/api/orders/ws", as.route(RouteStream, auth.RoleViewer, as.handleWebSocket)).Methods(http.MethodGet)
+	}
+	if as.cfg.GraphQL != nil {
+		r.HandleFunc("/api/graphql", as.route(RouteGraphQL, auth.RoleViewer, as.handleGraphQL)).Methods(http.MethodPost)
+	}
+	if as.cfg.Rejections != nil {
+		r.HandleFunc("/api/rejections", as.route(RouteList, auth.RoleViewer, as.handleListRejections)).Methods(http.MethodGet)
+	}
+	if as.cfg.Operations != nil {
+		r.HandleFunc("/api/operations", as.route(RouteOperations, auth.RoleViewer, as.handleOperations)).Methods(http.MethodGet)
+	}
+	if as.cfg.Analytics != nil {
+		r.HandleFunc("/api/analytics/volume", as.route(RouteAnalytics, auth.RoleViewer, as.handleOrderVolume)).Methods(http.MethodGet)
+		r.HandleFunc("/api/analytics/breakdown", as.route(RouteAnalytics, auth.RoleViewer, as.handleOrderBreakdown)).Methods(http.MethodGet)
+		r.HandleFunc("/api/analytics/basket", as.route(RouteAnalytics, auth.RoleViewer, as.handleBasketStats)).Methods(http.MethodGet)
+		r.HandleFunc("/api/analytics/top-products", as.route(RouteAnalytics, auth.RoleViewer, as.handleTopProducts)).Methods(http.MethodGet)
+		r.HandleFunc("/api/analytics/top-brands", as.route(RouteAnalytics, auth.RoleViewer, as.handleTopBrands)).Methods(http.MethodGet)
+		r.HandleFunc("/api/admin/analytics/refresh", as.route(RouteAdmin, auth.RoleAdmin, as.handleAnalyticsRefresh)).Methods(http.MethodPost)
+	}
+	r.HandleFunc("/api/admin/reconciliation", as.route(RouteAdmin, auth.RoleAdmin, as.handleReconciliationStats)).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/reconciliation", as.route(RouteAdmin, auth.RoleAdmin, as.handleReconciliationRun)).Methods(http.MethodPost)
+	r.HandleFunc("/api/admin/api-keys", as.route(RouteAdmin, auth.RoleAdmin, as.handleListAPIKeys)).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/api-keys", as.route(RouteAdmin, auth.RoleAdmin, as.handleCreateAPIKey)).Methods(http.MethodPost)
+	r.HandleFunc("/api/admin/api-keys/{id}", as.route(RouteAdmin, auth.RoleAdmin, as.handleRevokeAPIKey)).Methods(http.MethodDelete)
+	r.HandleFunc("/api/admin/customers/{customerID}/export", as.route(RouteAdmin, auth.RoleAdmin, as.handleCustomerExport)).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/customers/{customerID}/erase", as.route(RouteAdmin, auth.RoleAdmin, as.handleCustomerErase)).Methods(http.MethodPost)
+	r.HandleFunc("/api/admin/erasures", as.route(RouteAdmin, auth.RoleAdmin, as.handleListErasures)).Methods(http.MethodGet)
 
 	srv := &http.Server{
 		Addr:    ":8081",
-		Handler: r,
+		Handler: withMiddleware(r, "api", as.sugar),
 	}
 
 	go func() {
@@ -76,6 +220,11 @@ func (as *ApiServer) StartApiServer() error {
 
 }
 
+// route wraps a handler with the middleware of its route: rate limit, request deadline and the required role
+func (as *ApiServer) route(route string, role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return as.limit(route, as.timeout(route, as.require(role, next)))
+}
+
 func (as *ApiServer) Shutdown(ctx context.Context) error {
 	if as.server != nil {
 		return as.server.Shutdown(ctx)
@@ -87,58 +236,149 @@ func (as *ApiServer) handleOrder(w http.ResponseWriter, r *http.Request) {
 	orderUID := mux.Vars(r)["orderUID"]
 	if orderUID == "" {
 		as.sugar.Infow("empty orderUID")
-
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(&apiError{
-			Error: "empty orderUID",
-		}); err != nil {
-			as.sugar.Errorw("couldn't encode error", "orderUID", orderUID, "error", err)
-		}
+		writeProblem(w, r, problemInvalidRequest, "empty orderUID", as.sugar)
 		return
 	}
-	order, err := as.getOrder(orderUID)
+	projection, err := parseOrderProjection(r)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	mask, err := maskPII(r)
+	if err != nil {
+		writeProblem(w, r, problemForbidden, err.Error(), as.sugar)
+		return
+	}
+	order, err := as.reader.GetOrder(r.Context(), orderUID, projection.parts)
 	if err != nil {
-		as.sugar.Errorw("couldn't get order", "orderUID", orderUID, "error", err)
 		if errors.Is(err, pgx.ErrNoRows) {
-			w.WriteHeader(http.StatusNotFound)
-			if err := json.NewEncoder(w).Encode(&apiError{
-				Error: "no order found",
-			}); err != nil {
-				as.sugar.Errorw("couldn't encode error", "orderUID", orderUID, "error", err)
-			}
-			return
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(&apiError{
-				Error: "couldn't get order",
-			}); err != nil {
-				as.sugar.Errorw("couldn't encode error", "orderUID", orderUID, "error", err)
-			}
+			as.sugar.Infow("order not found", "orderUID", orderUID)
+			writeProblem(w, r, problemNotFound, "no order found", as.sugar)
 			return
 		}
+		as.sugar.Errorw("couldn't get order", "orderUID", orderUID, "error", err)
+		as.writeStorageProblem(w, r, err, "couldn't get order")
+		return
+	}
 
+	if mask {
+		order = pii.MaskOrder(order)
 	}
-	if err = json.NewEncoder(w).Encode(order); err != nil {
-		as.sugar.Errorw("couldn't encode order", "orderUID", orderUID, "error", err)
+	resp, err := projection.apply(order)
+	if err != nil {
+		as.sugar.Errorw("couldn't select order fields", "orderUID", orderUID, "error", err)
+		writeProblem(w, r, problemInternal, "couldn't encode response", as.sugar)
+		return
+	}
+	// the representation depends on the caller's role.
+	// There's no Last-Modified: erasure and key rotation change orders without a modification time,
+	// and cached and stored copies don't know the same times, so only the ETag validates.
+	w.Header().Set("Vary", "Authorization, "+apiKeyHeader)
+	as.writeCacheableJSON(w, r, RouteOrder, resp, nil)
+}
+
+// writeStorageProblem tells timeouts, cache and database outages apart from other internal errors
+func (as *ApiServer) writeStorageProblem(w http.ResponseWriter, r *http.Request, err error, detail string) {
+	switch {
+	case timedOut(r) || errors.Is(err, context.DeadlineExceeded):
+		writeProblem(w, r, problemTimeout, detail, as.sugar)
+	case errors.Is(err, service.ErrCacheUnavailable):
+		writeProblem(w, r, problemCacheUnavailable, detail, as.sugar)
+	case errors.Is(err, service.ErrDBUnavailable):
+		writeProblem(w, r, problemDBUnavailable, detail, as.sugar)
+	default:
+		writeProblem(w, r, problemInternal, detail, as.sugar)
 	}
 }
 
-func (as *ApiServer) getOrder(orderUID string) (*model.Order, error) {
-	// try redis first
-	val, err := as.cacheRepo.GetOrder(as.ctx, orderUID)
+// handleBatchGet returns several orders at once.
+// Cache is read with a single pipeline, misses are fetched from db with a single batch.
+// Results keep the request order, unknown orders are marked with found=false.
+func (as *ApiServer) handleBatchGet(w http.ResponseWriter, r *http.Request) {
+	projection, err := parseOrderProjection(r)
 	if err != nil {
-		// key no found
-		if errors.Is(err, redis.Nil) {
-			// try from db
-			order, err := as.orderRepo.GetOrderByOrderUID(as.ctx, orderUID)
-			if err != nil {
-				return nil, err
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	mask, err := maskPII(r)
+	if err != nil {
+		writeProblem(w, r, problemForbidden, err.Error(), as.sugar)
+		return
+	}
+	var req batchGetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, problemInvalidRequest, "invalid request body", as.sugar)
+		return
+	}
+	if len(req.OrderUIDs) == 0 {
+		writeProblem(w, r, problemInvalidRequest, "order_uids is empty", as.sugar)
+		return
+	}
+	if len(req.OrderUIDs) > maxBatchSize {
+		writeProblem(w, r, problemInvalidRequest, fmt.Sprintf("too many order_uids, max is %d", maxBatchSize), as.sugar)
+		return
+	}
+
+	// duplicates are looked up once
+	unique := make([]string, 0, len(req.OrderUIDs))
+	seen := make(map[string]struct{}, len(req.OrderUIDs))
+	for _, orderUID := range req.OrderUIDs {
+		if _, ok := seen[orderUID]; ok || orderUID == "" {
+			continue
+		}
+		seen[orderUID] = struct{}{}
+		unique = append(unique, orderUID)
+	}
+
+	orders, err := as.reader.GetOrders(r.Context(), unique, projection.parts)
+	if err != nil {
+		as.sugar.Errorw("couldn't get orders", "count", len(unique), "error", err)
+		as.writeStorageProblem(w, r, err, "couldn't get orders")
+		return
+	}
+
+	resp := batchGetResponse{Results: make([]batchGetResult, 0, len(req.OrderUIDs))}
+	for _, orderUID := range req.OrderUIDs {
+		result := batchGetResult{OrderUID: orderUID}
+		if order, ok := orders[orderUID]; ok {
+			result.Found = true
+			if mask {
+				order = pii.MaskOrder(order)
+			}
+			if result.Order, err = projection.apply(order); err != nil {
+				as.sugar.Errorw("couldn't select order fields", "orderUID", orderUID, "error", err)
+				writeProblem(w, r, problemInternal, "couldn't encode response", as.sugar)
+				return
 			}
-			return order, nil
-		} else {
-			return nil, err
 		}
+		resp.Results = append(resp.Results, result)
 	}
-	return val, nil
+	writeJSON(w, http.StatusOK, &resp, as.sugar)
+}
 
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any, sugar *zap.SugaredLogger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		sugar.Errorw("couldn't encode response", "error", err)
+	}
+}
+
+// handleReconciliationStats returns cache/db drift statistics
+func (as *ApiServer) handleReconciliationStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", as.cacheControl(RouteAdmin))
+	writeJSON(w, http.StatusOK, as.reconciler.Stats(), as.sugar)
+}
+
+// handleReconciliationRun runs reconciliation right away and returns its report
+func (as *ApiServer) handleReconciliationRun(w http.ResponseWriter, r *http.Request) {
+	report, err := as.reconciler.Run(r.Context())
+	if err != nil {
+		as.sugar.Errorw("reconciliation failed", "error", err)
+		as.writeStorageProblem(w, r, err, "reconciliation failed")
+		return
+	}
+	w.Header().Set("Cache-Control", as.cacheControl(RouteAdmin))
+	writeJSON(w, http.StatusOK, report, as.sugar)
 }
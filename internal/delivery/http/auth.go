@@ -0,0 +1,123 @@
+package http
+
+import (
+	"MockOrderService/internal/auth"
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/service"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Authenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error)
+	AuthenticateBearer(token string) (*auth.Principal, error)
+	ForgetAPIKeys()
+}
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *model.APIKey) error
+	ListAPIKeys(ctx context.Context) ([]*model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int32) error
+}
+
+// AccessControl is what the api server needs to authenticate and authorize requests.
+// Without Authenticator authentication is disabled and every request is served as admin.
+type AccessControl struct {
+	Authenticator Authenticator
+	APIKeys       APIKeyRepository
+}
+
+const apiKeyHeader = "X-API-Key"
+
+// publicPaths are served without credentials
+var publicPaths = map[string]bool{
+	"/api/openapi.json": true,
+}
+
+// anonymousAdmin is the principal of every request when authentication is disabled
+var anonymousAdmin = &auth.Principal{Subject: "anonymous", Role: auth.RoleAdmin, Method: auth.MethodNone}
+
+// authenticate resolves the X-API-Key header or the bearer token to a principal and stores it in the request context
+func (as *ApiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if as.access.Authenticator == nil {
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), anonymousAdmin)))
+			return
+		}
+
+		principal, err := as.credentials(r)
+		if err != nil {
+			if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+				as.sugar.Infow("request is not authenticated", "path", r.URL.Path, "reason", err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				writeProblem(w, r, problemUnauthorized, err.Error(), as.sugar)
+				return
+			}
+			as.sugar.Errorw("couldn't authenticate request", "path", r.URL.Path, "error", err)
+			as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't check credentials")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// credentials authenticates the api key if present, the bearer token otherwise
+func (as *ApiServer) credentials(r *http.Request) (*auth.Principal, error) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return as.access.Authenticator.AuthenticateAPIKey(r.Context(), key)
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") && token != "" {
+		return as.access.Authenticator.AuthenticateBearer(strings.TrimSpace(token))
+	}
+	return nil, auth.ErrNoCredentials
+}
+
+// hasRole tells if the principal of the request has at least the given role
+func hasRole(r *http.Request, role auth.Role) bool {
+	principal := auth.PrincipalFrom(r.Context())
+	return principal != nil && principal.Role.Allows(role)
+}
+
+// require serves the request only if the principal has at least the given role
+func (as *ApiServer) require(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasRole(r, role) {
+			writeProblem(w, r, problemForbidden, fmt.Sprintf("%s role is required", role), as.sugar)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// unmaskedRole is the role needed to see personal data of orders verbatim
+const unmaskedRole = auth.RoleSupport
+
+// maskPII tells if personal data must be masked in the response.
+// ?mask=true masks it for any caller, callers below unmaskedRole always get it masked
+// and asking for unmasked data with ?mask=false is an error for them.
+func maskPII(r *http.Request) (bool, error) {
+	allowed := hasRole(r, unmaskedRole)
+
+	value := r.URL.Query().Get("mask")
+	if value == "" {
+		return !allowed, nil
+	}
+	mask, err := strconv.ParseBool(value)
+	if err != nil {
+		// the validator rejects such values already, masking is the safe choice anyway
+		return true, nil
+	}
+	if !mask && !allowed {
+		return false, fmt.Errorf("%s role is required to see unmasked personal data", unmaskedRole)
+	}
+	return mask, nil
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Route names used to look up Cache-Control policies and rate limits
+const (
+	RouteOrder      = "order"
+	RouteBatch      = "batch"
+	RouteIngest     = "ingest"
+	RouteExport     = "export"
+	RouteOpenAPI    = "openapi"
+	RouteAdmin      = "admin"
+	RouteStream     = "stream"
+	RouteGraphQL    = "graphql"
+	RouteSearch     = "search"
+	RouteAnalytics  = "analytics"
+	RouteList       = "list"
+	RouteOperations = "operations"
+)
+
+// DefaultCacheControl is used for routes without a configured policy.
+// Orders contain personal data, so shared caches must not store them.
+// Analytics only changes when the aggregates are refreshed.
+var DefaultCacheControl = map[string]string{
+	RouteOrder:     "private, max-age=60",
+	RouteOpenAPI:   "public, max-age=3600",
+	RouteAdmin:     "no-store",
+	RouteAnalytics: "private, max-age=60",
+}
+
+// cacheControl returns the Cache-Control policy of a route
+func (as *ApiServer) cacheControl(route string) string {
+	if policy, ok := as.cfg.CacheControl[route]; ok {
+		return policy
+	}
+	return DefaultCacheControl[route]
+}
+
+// writeCacheableJSON writes v with a strong ETag (hash of the body), Last-Modified and Cache-Control.
+// Conditional requests (If-None-Match, If-Modified-Since) matching the current representation get 304.
+func (as *ApiServer) writeCacheableJSON(w http.ResponseWriter, r *http.Request, route string, v any, lastModified *time.Time) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		as.sugar.Errorw("couldn't encode response", "error", err)
+		writeProblem(w, r, problemInternal, "couldn't encode response", as.sugar)
+		return
+	}
+	body = append(body, '\n')
+	writeCacheable(w, r, "application/json", body, etagOf(body), lastModified, as.cacheControl(route), as.sugar)
+}
+
+// writeCacheable writes a prepared body with validators, or 304 if the client's copy is fresh
+func writeCacheable(w http.ResponseWriter, r *http.Request, contentType string, body []byte, etag string, lastModified *time.Time, cacheControl string, sugar *zap.SugaredLogger) {
+	h := w.Header()
+	h.Set("ETag", etag)
+	if cacheControl != "" {
+		h.Set("Cache-Control", cacheControl)
+	}
+	if lastModified != nil && !lastModified.IsZero() {
+		h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		sugar.Errorw("couldn't write response", "error", err)
+	}
+}
+
+// etagOf returns a strong ETag for the body
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified evaluates conditional headers as RFC 9110 describes for GET:
+// If-None-Match takes precedence, If-Modified-Since is used only without it.
+func notModified(r *http.Request, etag string, lastModified *time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified == nil || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	// http dates have second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// etagMatches does the weak comparison of an If-None-Match list with etag
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
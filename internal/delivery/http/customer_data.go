@@ -0,0 +1,172 @@
+package http
+
+import (
+	"MockOrderService/internal/auth"
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/export"
+	"MockOrderService/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of the erasure log listing
+const (
+	defaultErasuresLimit = 100
+	maxErasuresLimit     = 1000
+)
+
+type eraseCustomerRequest struct {
+	Reason string `json:"reason"`
+}
+
+type eraseCustomerResponse struct {
+	*model.Erasure
+	OrderUIDs []string `json:"order_uids"`
+	// CachePurged is false if some cached orders couldn't be deleted, they expire on their own
+	CachePurged bool `json:"cache_purged"`
+	// RejectionsPurged is false if the customer's rejected messages couldn't be deleted
+	RejectionsPurged bool `json:"rejections_purged"`
+}
+
+type erasuresResponse struct {
+	Erasures []*model.Erasure `json:"erasures"`
+}
+
+// handleCustomerExport streams every order of a customer, unmasked, as a single JSON document
+func (as *ApiServer) handleCustomerExport(w http.ResponseWriter, r *http.Request) {
+	customerID := mux.Vars(r)["customerID"]
+	exportedAt := time.Now().UTC()
+	ew := &exportResponseWriter{w: w, contentType: "application/json", filename: exportFilename("customer", ".json")}
+	writer := export.NewJSONArchiveWriter(ew, map[string]any{
+		"customer_id": customerID,
+		"exported_at": exportedAt,
+	})
+
+	exported, err := as.exportOrders(r, writer, model.OrderFilter{CustomerID: customerID}, false)
+	if err != nil {
+		as.sugar.Errorw("customer export failed", "customerID", customerID, "orders", exported, "error", err)
+		if ew.started {
+			panic(http.ErrAbortHandler)
+		}
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "export failed")
+		return
+	}
+	as.sugar.Infow("customer data exported", "customerID", customerID, "orders", exported,
+		"by", auth.PrincipalFrom(r.Context()).Subject)
+}
+
+// spoolRetryAfter is suggested to erasure requests refused because of pending spooled orders, in seconds
+const spoolRetryAfter = 30
+
+// handleCustomerErase anonymises personal data of a customer and purges the cached orders.
+// It's refused while orders wait in the spool of any replica: they could belong to the customer
+// and would be stored with personal data after the erasure.
+func (as *ApiServer) handleCustomerErase(w http.ResponseWriter, r *http.Request) {
+	customerID := mux.Vars(r)["customerID"]
+	var req eraseCustomerRequest
+	// the body is optional
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeProblem(w, r, problemInvalidRequest, "invalid request body", as.sugar)
+		return
+	}
+	if as.cfg.Spool != nil {
+		if pending := as.cfg.Spool.Pending(); pending > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(spoolRetryAfter))
+			writeProblem(w, r, problemSpoolPending, fmt.Sprintf("%d orders are waiting in the spool, retry once they are stored", pending), as.sugar)
+			return
+		}
+	}
+	erasure := &model.Erasure{RequestedBy: auth.PrincipalFrom(r.Context()).Subject, Reason: req.Reason}
+	if as.cfg.Spools != nil {
+		spools, err := as.cfg.Spools.PendingSpools(r.Context())
+		if err != nil {
+			as.sugar.Errorw("couldn't check spools of replicas", "error", err)
+			// the registry lives in redis next to the cache
+			as.writeStorageProblem(w, r, fmt.Errorf("%w: %w", service.ErrCacheUnavailable, err), "couldn't check spools of replicas")
+			return
+		}
+		if len(spools) > 0 {
+			pending := 0
+			ids := make([]string, 0, len(spools))
+			for id, n := range spools {
+				pending += n
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			w.Header().Set("Retry-After", strconv.Itoa(spoolRetryAfter))
+			writeProblem(w, r, problemSpoolPending, fmt.Sprintf("%d orders are waiting in spools %s, retry once they are stored",
+				pending, strings.Join(ids, ", ")), as.sugar)
+			return
+		}
+		erasure.SpoolsChecked = true
+	}
+
+	orderUIDs, err := as.orderRepo.EraseCustomer(r.Context(), customerID, erasure)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeProblem(w, r, problemNotFound, "no orders found for the customer", as.sugar)
+			return
+		}
+		as.sugar.Errorw("couldn't erase customer data", "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't erase customer data")
+		return
+	}
+
+	resp := &eraseCustomerResponse{Erasure: erasure, OrderUIDs: orderUIDs, CachePurged: true, RejectionsPurged: true}
+	for _, orderUID := range orderUIDs {
+		if err = as.cacheRepo.DeleteOrder(r.Context(), orderUID); err != nil {
+			as.sugar.Errorw("couldn't purge erased order from cache", "orderUID", orderUID, "error", err)
+			resp.CachePurged = false
+		}
+		if as.cfg.Feed != nil {
+			as.cfg.Feed.Publish(service.OrderEvent{Type: service.OrderErased, OrderUID: orderUID})
+		}
+	}
+	// rejections are found by the blind index, without a keyring they don't keep the customer id at all
+	var rejections int
+	if as.cfg.Rejections != nil && erasure.CustomerHash != "" {
+		if rejections, err = as.cfg.Rejections.DeleteCustomerRejections(r.Context(), erasure.CustomerHash); err != nil {
+			as.sugar.Errorw("couldn't purge rejections of erased customer", "erasure", erasure.ID, "error", err)
+			resp.RejectionsPurged = false
+		}
+	}
+	// the customer id isn't logged, the erasure id leads to the audit record
+	as.sugar.Infow("customer data erased", "erasure", erasure.ID, "orders", erasure.Orders,
+		"by", erasure.RequestedBy, "cachePurged", resp.CachePurged, "rejections", rejections)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp, as.sugar)
+}
+
+// handleListErasures returns the erasure log, ?customer_id= checks whether a particular customer was erased
+func (as *ApiServer) handleListErasures(w http.ResponseWriter, r *http.Request) {
+	limit := defaultErasuresLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxErasuresLimit {
+			writeProblem(w, r, problemInvalidRequest, "limit must be between 1 and 1000", as.sugar)
+			return
+		}
+		limit = n
+	}
+	erasures, err := as.orderRepo.ListErasures(r.Context(), r.URL.Query().Get("customer_id"), limit)
+	if errors.Is(err, model.ErrNoCustomerIndex) {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	if err != nil {
+		as.sugar.Errorw("couldn't list erasures", "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't list erasures")
+		return
+	}
+	w.Header().Set("Cache-Control", as.cacheControl(RouteAdmin))
+	writeJSON(w, http.StatusOK, &erasuresResponse{Erasures: erasures}, as.sugar)
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/export"
+	"MockOrderService/internal/pii"
+	"MockOrderService/internal/service"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// handleExport streams orders matching the filters as CSV, NDJSON or XLSX (?format=, csv by default).
+// Headers are sent with the first written bytes, so failures before that still get a problem response.
+// Failures after that abort the connection, a truncated file mustn't look complete.
+func (as *ApiServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = export.FormatCSV
+	}
+	format, err := export.LookupFormat(name)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	mask, err := maskPII(r)
+	if err != nil {
+		writeProblem(w, r, problemForbidden, err.Error(), as.sugar)
+		return
+	}
+	// otherwise masked personal data could be guessed by filtering
+	if (filter.Phone != "" || filter.Email != "") && !hasRole(r, unmaskedRole) {
+		writeProblem(w, r, problemForbidden, fmt.Sprintf("%s role is required to filter by phone or email", unmaskedRole), as.sugar)
+		return
+	}
+
+	ew := &exportResponseWriter{w: w, contentType: format.ContentType, filename: exportFilename("orders", format.Extension)}
+	writer, err := format.NewWriter(ew)
+	if err != nil {
+		as.sugar.Errorw("couldn't create export writer", "format", format.Name, "error", err)
+		writeProblem(w, r, problemInternal, "export failed", as.sugar)
+		return
+	}
+	exported, err := as.exportOrders(r, writer, filter, mask)
+	if err != nil {
+		as.sugar.Errorw("export failed", "format", format.Name, "orders", exported, "error", err)
+		if ew.started {
+			panic(http.ErrAbortHandler)
+		}
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "export failed")
+		return
+	}
+	// an empty export may have no bytes at all
+	ew.start()
+	as.sugar.Infow("orders exported", "format", format.Name, "orders", exported, "masked", mask)
+}
+
+// exportOrders writes matching orders with the writer, closes it and returns the amount of exported orders
+func (as *ApiServer) exportOrders(r *http.Request, writer export.Writer, filter model.OrderFilter, mask bool) (int, error) {
+	exported := 0
+	err := as.orderRepo.ExportOrders(r.Context(), filter, func(order *model.Order) error {
+		exported++
+		if mask {
+			order = pii.MaskOrder(order)
+		}
+		return writer.WriteOrder(order)
+	})
+	if err != nil {
+		return exported, err
+	}
+	return exported, writer.Close()
+}
+
+// exportResponseWriter sends export headers right before the first bytes of the file
+type exportResponseWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+// exportFilename names an export file by its kind and the current time
+func exportFilename(kind string, extension string) string {
+	return fmt.Sprintf("%s-%s%s", kind, time.Now().UTC().Format("20060102T150405Z"), extension)
+}
+
+func (ew *exportResponseWriter) start() {
+	if ew.started {
+		return
+	}
+	ew.started = true
+	h := ew.w.Header()
+	h.Set("Content-Type", ew.contentType)
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, ew.filename))
+	h.Set("Cache-Control", "no-store")
+	ew.w.WriteHeader(http.StatusOK)
+}
+
+func (ew *exportResponseWriter) Write(b []byte) (int, error) {
+	ew.start()
+	return ew.w.Write(b)
+}
+
+// parseOrderFilter reads order filters from the query: from, to (RFC 3339 or YYYY-MM-DD), customer_id, delivery_service, locale,
+// phone, email
+func parseOrderFilter(r *http.Request) (model.OrderFilter, error) {
+	query := r.URL.Query()
+	filter := model.OrderFilter{
+		CustomerID:      query.Get("customer_id"),
+		DeliveryService: query.Get("delivery_service"),
+		Locale:          query.Get("locale"),
+		Phone:           query.Get("phone"),
+		Email:           query.Get("email"),
+	}
+	for param, dst := range map[string]**time.Time{"from": &filter.CreatedFrom, "to": &filter.CreatedTo} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, value); err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 time or a date (YYYY-MM-DD)", param)
+			}
+		}
+		*dst = &t
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+	return filter, nil
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Sub-resources of an order which can be requested with ?include=
+const (
+	includeDelivery = "delivery"
+	includePayment  = "payment"
+	includeItems    = "items"
+)
+
+// Field names accepted by ?fields=, taken from json tags of the model
+var (
+	orderFieldNames   = jsonFieldNames(reflect.TypeOf(model.Order{}))
+	subresourceFields = map[string]map[string]struct{}{
+		includeDelivery: jsonFieldNames(reflect.TypeOf(model.Delivery{})),
+		includePayment:  jsonFieldNames(reflect.TypeOf(model.Payment{})),
+		includeItems:    jsonFieldNames(reflect.TypeOf(model.Item{})),
+	}
+)
+
+// orderProjection is a sparse representation of orders requested with ?fields= and ?include=
+type orderProjection struct {
+	parts model.OrderParts
+	// fields maps kept order fields to the kept fields of a sub-resource (nil keeps all of them).
+	// nil fields keeps every order field.
+	fields map[string]map[string]struct{}
+}
+
+// parseOrderProjection reads ?include=delivery,payment,items and ?fields=order_uid,delivery.city,...
+// Without include all sub-resources are embedded, with fields only the referenced ones are.
+// order_uid is always kept.
+func parseOrderProjection(r *http.Request) (*orderProjection, error) {
+	query := r.URL.Query()
+	p := &orderProjection{parts: model.AllOrderParts}
+
+	if query.Has("include") {
+		p.parts = model.OrderParts{}
+		for _, name := range splitList(query.Get("include")) {
+			switch name {
+			case includeDelivery:
+				p.parts.Delivery = true
+			case includePayment:
+				p.parts.Payment = true
+			case includeItems:
+				p.parts.Items = true
+			default:
+				return nil, fmt.Errorf("unknown sub-resource %q in include, expected delivery, payment or items", name)
+			}
+		}
+	}
+
+	if !query.Has("fields") {
+		return p, nil
+	}
+	p.fields = map[string]map[string]struct{}{"order_uid": nil}
+	for _, name := range splitList(query.Get("fields")) {
+		field, sub, nested := strings.Cut(name, ".")
+		if _, ok := orderFieldNames[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		known, isSubresource := subresourceFields[field]
+		if !nested {
+			// the whole value is kept
+			p.fields[field] = nil
+			continue
+		}
+		if !isSubresource {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		if _, ok := known[sub]; !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		kept, ok := p.fields[field]
+		if ok && kept == nil {
+			continue
+		}
+		if !ok {
+			kept = make(map[string]struct{})
+			p.fields[field] = kept
+		}
+		kept[sub] = struct{}{}
+	}
+
+	// sub-resources which aren't among the fields are not loaded at all
+	for name := range subresourceFields {
+		requested := p.part(name)
+		_, inFields := p.fields[name]
+		if inFields && !*requested {
+			return nil, fmt.Errorf("field %q requires %s in include", name, name)
+		}
+		*requested = inFields
+	}
+	return p, nil
+}
+
+// part returns the flag of a sub-resource in parts
+func (p *orderProjection) part(name string) *bool {
+	switch name {
+	case includeDelivery:
+		return &p.parts.Delivery
+	case includePayment:
+		return &p.parts.Payment
+	default:
+		return &p.parts.Items
+	}
+}
+
+// full is true if the projection keeps the whole order
+func (p *orderProjection) full() bool {
+	return p.fields == nil && p.parts == model.AllOrderParts
+}
+
+// apply returns the representation of an order with only the requested fields
+func (p *orderProjection) apply(order *model.Order) (any, error) {
+	if p.full() {
+		return order, nil
+	}
+
+	// orders from the cache are always complete
+	trimmed := *order
+	if !p.parts.Delivery {
+		trimmed.Delivery = nil
+	}
+	if !p.parts.Payment {
+		trimmed.Payment = nil
+	}
+	if !p.parts.Items {
+		trimmed.Items = nil
+	}
+	if p.fields == nil {
+		return &trimmed, nil
+	}
+
+	data, err := json.Marshal(&trimmed)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	if err = json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	for name, value := range values {
+		kept, ok := p.fields[name]
+		if !ok {
+			delete(values, name)
+			continue
+		}
+		if kept == nil {
+			continue
+		}
+		if values[name], err = keepFields(value, kept); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// keepFields removes fields which aren't kept from a JSON object or from every object of a JSON array
+func keepFields(value json.RawMessage, kept map[string]struct{}) (json.RawMessage, error) {
+	if strings.HasPrefix(strings.TrimSpace(string(value)), "[") {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(value, &elems); err != nil {
+			return nil, err
+		}
+		for i := range elems {
+			elem, err := keepFields(elems[i], kept)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return json.Marshal(elems)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return nil, err
+	}
+	for name := range fields {
+		if _, ok := kept[name]; !ok {
+			delete(fields, name)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// jsonFieldNames returns json names of the struct fields
+func jsonFieldNames(t reflect.Type) map[string]struct{} {
+	names := make(map[string]struct{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
+
+// splitList splits a comma separated query parameter, empty elements are skipped
+func splitList(s string) []string {
+	var list []string
+	for _, elem := range strings.Split(s, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+	return list
+}
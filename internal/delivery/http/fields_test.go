@@ -0,0 +1,108 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseOrderProjection(t *testing.T) {
+	tests := []struct {
+		query  string
+		parts  model.OrderParts
+		fields map[string][]string
+		err    bool
+	}{
+		{query: "", parts: model.AllOrderParts},
+		{query: "include=", parts: model.OrderParts{}},
+		{query: "include=payment,+items", parts: model.OrderParts{Payment: true, Items: true}},
+		{query: "include=customer", err: true},
+		{query: "fields=track_number", fields: map[string][]string{"order_uid": nil, "track_number": nil}},
+		{
+			query:  "fields=delivery.city,delivery.zip,items.price",
+			parts:  model.OrderParts{Delivery: true, Items: true},
+			fields: map[string][]string{"order_uid": nil, "delivery": {"city", "zip"}, "items": {"price"}},
+		},
+		{
+			// the whole sub-resource wins over its single fields
+			query:  "fields=delivery.city,delivery,delivery.zip",
+			parts:  model.OrderParts{Delivery: true},
+			fields: map[string][]string{"order_uid": nil, "delivery": nil},
+		},
+		{
+			query:  "include=delivery,payment&fields=payment.amount",
+			parts:  model.OrderParts{Payment: true},
+			fields: map[string][]string{"order_uid": nil, "payment": {"amount"}},
+		},
+		{query: "include=delivery&fields=payment.amount", err: true},
+		{query: "fields=secret", err: true},
+		{query: "fields=track_number.value", err: true},
+		{query: "fields=delivery.secret", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			p, err := parseOrderProjection(httptest.NewRequest("GET", "/api/orders?"+tt.query, nil))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.parts != tt.parts {
+				t.Fatalf("expected parts %+v, got %+v", tt.parts, p.parts)
+			}
+			var fields map[string][]string
+			if p.fields != nil {
+				fields = make(map[string][]string)
+				for name, kept := range p.fields {
+					fields[name] = nil
+					for sub := range kept {
+						fields[name] = append(fields[name], sub)
+					}
+				}
+			}
+			for _, kept := range fields {
+				sort.Strings(kept)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Fatalf("expected fields %v, got %v", tt.fields, fields)
+			}
+		})
+	}
+}
+
+func TestOrderProjectionApply(t *testing.T) {
+	order := &model.Order{
+		OrderUID:    "a",
+		TrackNumber: "WBILMTESTTRACK",
+		Delivery:    &model.Delivery{City: "Moskva", Zip: "263980"},
+		Items:       []*model.Item{{Rid: "r1", Price: ptrOf[int64](1)}, {Rid: "r2", Price: ptrOf[int64](2)}},
+	}
+	p, err := parseOrderProjection(httptest.NewRequest("GET", "/api/orders?fields=delivery.city,items.price", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := p.apply(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"delivery":{"city":"Moskva"},"items":[{"price":1},{"price":2}],"order_uid":"a"}`
+	if string(data) != expected {
+		t.Fatalf("expected %s, got %s", expected, data)
+	}
+	if order.Delivery.Zip != "263980" || order.Items[0].Rid != "r1" {
+		t.Fatal("the order itself was modified")
+	}
+}
+
+func ptrOf[T any](v T) *T { return &v }
@@ -0,0 +1,38 @@
+package http
+
+import (
+	"MockOrderService/internal/delivery/graphql"
+	"encoding/json"
+	"net/http"
+)
+
+// maxGraphQLBodySize limits GraphQL requests, queries are small
+const maxGraphQLBodySize = 64 << 10
+
+// handleGraphQL executes a GraphQL query against orders, see internal/delivery/graphql/schema.graphql.
+// Malformed requests get a problem, errors of the query itself are reported in the errors of a 200 response as GraphQL expects.
+func (as *ApiServer) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	mask, err := maskPII(r)
+	if err != nil {
+		writeProblem(w, r, problemForbidden, err.Error(), as.sugar)
+		return
+	}
+	var req graphql.Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodySize)).Decode(&req); err != nil {
+		writeProblem(w, r, problemInvalidRequest, "invalid request body", as.sugar)
+		return
+	}
+	if req.Query == "" {
+		writeProblem(w, r, problemInvalidRequest, "query is empty", as.sugar)
+		return
+	}
+
+	resp := as.cfg.GraphQL.Execute(r.Context(), req, mask)
+	if clientGone(r) {
+		return
+	}
+	// the representation depends on the caller's role
+	w.Header().Set("Vary", "Authorization, "+apiKeyHeader)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp, as.sugar)
+}
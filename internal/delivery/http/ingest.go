@@ -0,0 +1,350 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/service"
+	"MockOrderService/internal/tracing"
+	"MockOrderService/internal/validation"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxIngestBodySize limits the size of a single ingestion request
+	maxIngestBodySize = 10 << 20
+	// maxIngestBulkSize limits the amount of orders in a single NDJSON request
+	maxIngestBulkSize = 1000
+
+	ndjsonContentType = "application/x-ndjson"
+
+	// idempotencyPendingMargin is added to the ingest timeout for the marker of a request in progress
+	idempotencyPendingMargin = 30 * time.Second
+	// idempotencyPendingTTL marks requests in progress if ingestion has no timeout
+	idempotencyPendingTTL = 5 * time.Minute
+)
+
+type OrderProcessor interface {
+	ProcessOrder(ctx context.Context, order *model.Order) error
+}
+
+type OrderPublisher interface {
+	Publish(ctx context.Context, order *model.Order) error
+}
+
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key string, fingerprint string, pendingTTL time.Duration) (*model.IdempotentResponse, bool, error)
+	Complete(ctx context.Context, key string, resp *model.IdempotentResponse) error
+	Release(ctx context.Context, key string) error
+	Lines(ctx context.Context, key string, fingerprint string) (map[int][]byte, error)
+	SaveLines(ctx context.Context, key string, fingerprint string, lines map[int][]byte) error
+}
+
+// OrderIngestion is what handleIngest needs to accept orders.
+// If Publisher is set, orders are published to Kafka instead of being saved directly.
+type OrderIngestion struct {
+	Processor   OrderProcessor
+	Publisher   OrderPublisher
+	Idempotency IdempotencyStore
+}
+
+const (
+	ingestStatusCreated  = "created"
+	ingestStatusAccepted = "accepted"
+	ingestStatusInvalid  = "invalid"
+	ingestStatusFailed   = "failed"
+)
+
+type ingestResult struct {
+	Line     int            `json:"line,omitempty"`
+	OrderUID string         `json:"order_uid,omitempty"`
+	Status   string         `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Problems []FieldProblem `json:"problems,omitempty"`
+	// problem is the kind of internal failure for status "failed"
+	problem problemType
+}
+
+type ingestBulkResponse struct {
+	Total     int            `json:"total"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Results   []ingestResult `json:"results"`
+}
+
+// handleIngest accepts a single order (JSON) or many orders (NDJSON, one order per line).
+// Orders go through the same validation and processing as orders consumed from Kafka.
+// Requests with an Idempotency-Key header are processed once, repeated requests get the stored response.
+// A bulk request with failed lines can be retried with the same key, lines ingested before aren't ingested again.
+func (as *ApiServer) handleIngest(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBodySize))
+	if err != nil {
+		writeProblem(w, r, problemPayloadTooLarge, "request body is too large", as.sugar)
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	sum := sha256.Sum256(body)
+	fingerprint := hex.EncodeToString(sum[:])
+	if key != "" {
+		stored, reserved, err := as.ingestion.Idempotency.Reserve(r.Context(), key, fingerprint, as.idempotencyPendingTTL())
+		if err != nil {
+			as.sugar.Errorw("couldn't reserve idempotency key", "key", key, "error", err)
+			writeProblem(w, r, problemCacheUnavailable, "couldn't check idempotency key", as.sugar)
+			return
+		}
+		if !reserved {
+			switch {
+			case stored.Fingerprint != fingerprint:
+				writeProblem(w, r, problemIdempotencyKeyReuse, "Idempotency-Key was already used for another request", as.sugar)
+			case stored.Pending:
+				writeProblem(w, r, problemRequestInProgress, "request with this Idempotency-Key is in progress", as.sugar)
+			default:
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.Header().Set("Content-Type", stored.ContentType)
+				w.WriteHeader(stored.Status)
+				if _, err := w.Write(stored.Body); err != nil {
+					as.sugar.Errorw("couldn't write stored response", "key", key, "error", err)
+				}
+			}
+			return
+		}
+		// a panic must not leave the key in progress, the recovery middleware still gets it
+		defer func() {
+			if p := recover(); p != nil {
+				_ = as.ingestion.Idempotency.Release(context.WithoutCancel(r.Context()), key)
+				panic(p)
+			}
+		}()
+	}
+
+	// lines ingested by an earlier attempt of the request
+	var done map[int][]byte
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); key != "" && mediaType == ndjsonContentType {
+		if done, err = as.ingestion.Idempotency.Lines(r.Context(), key, fingerprint); err != nil {
+			as.sugar.Errorw("couldn't read ingested lines", "key", key, "error", err)
+			_ = as.ingestion.Idempotency.Release(context.WithoutCancel(r.Context()), key)
+			writeProblem(w, r, problemCacheUnavailable, "couldn't check idempotency key", as.sugar)
+			return
+		}
+	}
+
+	status, resp, retryable := as.ingest(r.Context(), r, body, done)
+	// the key must be released or completed even if the request ran out of time
+	keyCtx := context.WithoutCancel(r.Context())
+	contentType := "application/json"
+	if _, ok := resp.(*Problem); ok {
+		contentType = problemContentType
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		as.sugar.Errorw("couldn't encode ingestion response", "error", err)
+		if key != "" {
+			_ = as.ingestion.Idempotency.Release(keyCtx, key)
+		}
+		writeProblem(w, r, problemInternal, "couldn't encode response", as.sugar)
+		return
+	}
+	data = append(data, '\n')
+
+	if key != "" {
+		// failed requests must be retryable with the same key
+		if retryable {
+			if bulk, ok := resp.(*ingestBulkResponse); ok {
+				if err = as.ingestion.Idempotency.SaveLines(keyCtx, key, fingerprint, bulk.ingested()); err != nil {
+					as.sugar.Errorw("couldn't store ingested lines", "key", key, "error", err)
+				}
+			}
+			err = as.ingestion.Idempotency.Release(keyCtx, key)
+		} else {
+			err = as.ingestion.Idempotency.Complete(keyCtx, key, &model.IdempotentResponse{
+				Fingerprint: fingerprint,
+				Status:      status,
+				ContentType: contentType,
+				Body:        data,
+			})
+		}
+		if err != nil {
+			as.sugar.Errorw("couldn't store idempotent response", "key", key, "error", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if _, err = w.Write(data); err != nil {
+		as.sugar.Errorw("couldn't write ingestion response", "error", err)
+	}
+}
+
+// idempotencyPendingTTL is how long a key is marked in progress, a bit longer than ingestion may take
+func (as *ApiServer) idempotencyPendingTTL() time.Duration {
+	timeout := as.routeTimeout(RouteIngest)
+	if timeout <= 0 {
+		return idempotencyPendingTTL
+	}
+	return timeout + idempotencyPendingMargin
+}
+
+// ingest processes the request body and returns response status and body.
+// retryable is true if the request failed because of an internal error.
+// Lines of a bulk request found in done aren't ingested, their stored results are returned instead.
+func (as *ApiServer) ingest(ctx context.Context, r *http.Request, body []byte, done map[int][]byte) (int, any, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != ndjsonContentType {
+		var order model.Order
+		if err := json.Unmarshal(body, &order); err != nil {
+			return http.StatusBadRequest, newProblem(r, problemInvalidRequest, "invalid order json"), false
+		}
+		res := as.ingestOrder(ctx, &order)
+		switch res.Status {
+		case ingestStatusInvalid:
+			problem := newProblem(r, problemValidationFailed, res.Error)
+			problem.Errors = res.Problems
+			return problem.Status, problem, false
+		case ingestStatusFailed:
+			problem := newProblem(r, res.problem, res.Error)
+			return problem.Status, problem, true
+		case ingestStatusAccepted:
+			return http.StatusAccepted, &res, false
+		default:
+			return http.StatusCreated, &res, false
+		}
+	}
+
+	resp := ingestBulkResponse{Results: []ingestResult{}}
+	retryable := false
+	var failure *ingestResult
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), maxIngestBodySize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if resp.Total == maxIngestBulkSize {
+			return http.StatusRequestEntityTooLarge, newProblem(r, problemPayloadTooLarge, fmt.Sprintf("too many orders, max is %d", maxIngestBulkSize)), false
+		}
+		resp.Total++
+
+		var res ingestResult
+		var order model.Order
+		if stored, ok := done[line]; ok && json.Unmarshal(stored, &res) == nil {
+			// already ingested by an earlier attempt
+		} else if err := json.Unmarshal(raw, &order); err != nil {
+			res = ingestResult{Status: ingestStatusInvalid, Error: "invalid order json"}
+		} else {
+			res = as.ingestOrder(ctx, &order)
+		}
+		res.Line = line
+
+		switch res.Status {
+		case ingestStatusCreated, ingestStatusAccepted:
+			resp.Succeeded++
+		case ingestStatusFailed:
+			retryable = true
+			resp.Failed++
+			if failure == nil {
+				failure = &res
+			}
+		default:
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	if err := scanner.Err(); err != nil {
+		return http.StatusBadRequest, newProblem(r, problemInvalidRequest, "couldn't read NDJSON body"), false
+	}
+	if resp.Total == 0 {
+		return http.StatusBadRequest, newProblem(r, problemInvalidRequest, "no orders in request"), false
+	}
+	if resp.Succeeded == 0 {
+		// nothing was ingested, so a client checking only the status doesn't take the request as done
+		if failure != nil {
+			return failure.problem.status, newProblem(r, failure.problem,
+				fmt.Sprintf("no orders were ingested, %d of %d failed: %s", resp.Failed, resp.Total, failure.Error)), true
+		}
+		return http.StatusUnprocessableEntity, &resp, false
+	}
+	return http.StatusOK, &resp, retryable
+}
+
+// ingested returns the encoded results of the lines which were ingested, by line number
+func (resp *ingestBulkResponse) ingested() map[int][]byte {
+	lines := make(map[int][]byte)
+	for _, res := range resp.Results {
+		if res.Status != ingestStatusCreated && res.Status != ingestStatusAccepted {
+			continue
+		}
+		if data, err := json.Marshal(&res); err == nil {
+			lines[res.Line] = data
+		}
+	}
+	return lines
+}
+
+// ingestOrder validates an order and either processes or publishes it
+func (as *ApiServer) ingestOrder(ctx context.Context, order *model.Order) ingestResult {
+	res := ingestResult{OrderUID: order.OrderUID}
+
+	_, span := tracing.Tracer().Start(ctx, "validation.ValidateOrder")
+	err := validation.ValidateOrder(order)
+	tracing.End(span, err)
+	if err != nil {
+		as.sugar.Warnw("invalid order received over http", "orderUID", order.OrderUID, "error", err)
+		res.Status = ingestStatusInvalid
+		res.Error = "order validation failed"
+		res.Problems = validationProblems(validation.Problems(err))
+		if len(res.Problems) == 0 {
+			res.Problems = []FieldProblem{{Detail: err.Error()}}
+		}
+		return res
+	}
+
+	if as.ingestion.Publisher != nil {
+		if err := as.ingestion.Publisher.Publish(ctx, order); err != nil {
+			as.sugar.Errorw("couldn't publish order", "orderUID", order.OrderUID, "error", err)
+			res.Status = ingestStatusFailed
+			res.Error = "couldn't publish order"
+			res.problem = problemUpstreamUnavailable
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				res.problem = problemTimeout
+			}
+			return res
+		}
+		res.Status = ingestStatusAccepted
+		return res
+	}
+
+	if err := as.ingestion.Processor.ProcessOrder(ctx, order); err != nil {
+		if errors.Is(err, context.Canceled) {
+			as.sugar.Warnw("order processing canceled", "orderUID", order.OrderUID)
+		} else {
+			as.sugar.Errorw("couldn't process order", "orderUID", order.OrderUID, "error", err)
+		}
+		res.Status = ingestStatusFailed
+		res.Error = "couldn't process order"
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			res.problem = problemTimeout
+		case errors.Is(service.ClassifyDBError(err), service.ErrDBUnavailable):
+			res.problem = problemDBUnavailable
+		default:
+			res.problem = problemInternal
+		}
+		return res
+	}
+	as.sugar.Infow("order received over http", "orderUID", order.OrderUID)
+	res.Status = ingestStatusCreated
+	return res
+}
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProcessor fails or panics on orders by orderUID and counts processed orders
+type fakeProcessor struct {
+	mu     sync.Mutex
+	fail   map[string]error
+	panics map[string]bool
+	calls  map[string]int
+}
+
+func (p *fakeProcessor) ProcessOrder(_ context.Context, order *model.Order) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls[order.OrderUID]++
+	if p.panics[order.OrderUID] {
+		panic("processing " + order.OrderUID)
+	}
+	return p.fail[order.OrderUID]
+}
+
+// fakeIdempotency keeps keys in memory, pending ttl isn't tracked
+type fakeIdempotency struct {
+	responses map[string]*model.IdempotentResponse
+	lines     map[string]map[int][]byte
+}
+
+func newFakeIdempotency() *fakeIdempotency {
+	return &fakeIdempotency{responses: make(map[string]*model.IdempotentResponse), lines: make(map[string]map[int][]byte)}
+}
+
+func (s *fakeIdempotency) Reserve(_ context.Context, key string, fingerprint string, _ time.Duration) (*model.IdempotentResponse, bool, error) {
+	if stored, ok := s.responses[key]; ok {
+		return stored, false, nil
+	}
+	s.responses[key] = &model.IdempotentResponse{Fingerprint: fingerprint, Pending: true}
+	return nil, true, nil
+}
+
+func (s *fakeIdempotency) Complete(_ context.Context, key string, resp *model.IdempotentResponse) error {
+	s.responses[key] = resp
+	delete(s.lines, key+resp.Fingerprint)
+	return nil
+}
+
+func (s *fakeIdempotency) Release(_ context.Context, key string) error {
+	delete(s.responses, key)
+	return nil
+}
+
+func (s *fakeIdempotency) Lines(_ context.Context, key string, fingerprint string) (map[int][]byte, error) {
+	return s.lines[key+fingerprint], nil
+}
+
+func (s *fakeIdempotency) SaveLines(_ context.Context, key string, fingerprint string, lines map[int][]byte) error {
+	if s.lines[key+fingerprint] == nil {
+		s.lines[key+fingerprint] = make(map[int][]byte)
+	}
+	for line, result := range lines {
+		s.lines[key+fingerprint][line] = result
+	}
+	return nil
+}
+
+func orderJSON(orderUID string) string {
+	return fmt.Sprintf(`{"order_uid":%q,"track_number":"WBILMTESTTRACK",`+
+		`"delivery":{"name":"Test Testov","phone":"+79720000000","zip":"263980","city":"Kiryat Mozkin","address":"Ploshad Mira 15","email":"test@gmail.com"},`+
+		`"payment":{"amount":1817,"goods_total":317,"delivery_cost":1500},`+
+		`"items":[{"rid":"ab4219087a764ae0btest","price":453,"total_price":317}]}`, orderUID)
+}
+
+type ingestRequest struct {
+	contentType string
+	body        string
+}
+
+type ingestResponse struct {
+	status    int
+	replayed  bool
+	succeeded int
+	failed    int
+	// lines maps line numbers of a bulk response to their statuses
+	lines map[int]string
+}
+
+func TestHandleIngest(t *testing.T) {
+	bulk := func(lines ...string) ingestRequest {
+		return ingestRequest{ndjsonContentType, strings.Join(lines, "\n")}
+	}
+	single := func(order string) ingestRequest {
+		return ingestRequest{"application/json", order}
+	}
+
+	tests := []struct {
+		name      string
+		fail      map[string]error
+		requests  []ingestRequest
+		responses []ingestResponse
+		// pending tells whether the key is left reserved or released
+		pending bool
+		// processed is how many times each order was processed over all requests
+		processed map[string]int
+	}{
+		{
+			name:     "single order replayed",
+			requests: []ingestRequest{single(orderJSON("a")), single(orderJSON("a"))},
+			responses: []ingestResponse{
+				{status: http.StatusCreated},
+				{status: http.StatusCreated, replayed: true},
+			},
+			pending:   true,
+			processed: map[string]int{"a": 1},
+		},
+		{
+			name:     "key reused for another order",
+			requests: []ingestRequest{single(orderJSON("a")), single(orderJSON("b"))},
+			responses: []ingestResponse{
+				{status: http.StatusCreated},
+				{status: http.StatusUnprocessableEntity},
+			},
+			pending:   true,
+			processed: map[string]int{"a": 1},
+		},
+		{
+			name:     "invalid order isn't retried",
+			requests: []ingestRequest{single(`{"order_uid":"a"}`), single(`{"order_uid":"a"}`)},
+			responses: []ingestResponse{
+				{status: http.StatusUnprocessableEntity},
+				{status: http.StatusUnprocessableEntity, replayed: true},
+			},
+			pending:   true,
+			processed: map[string]int{},
+		},
+		{
+			name:     "failed order releases the key",
+			fail:     map[string]error{"a": errors.New("db is down")},
+			requests: []ingestRequest{single(orderJSON("a")), single(orderJSON("a"))},
+			responses: []ingestResponse{
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusServiceUnavailable},
+			},
+			processed: map[string]int{"a": 2},
+		},
+		{
+			name: "partially accepted bulk is retried without ingested lines",
+			fail: map[string]error{"c": errors.New("db is down")},
+			requests: []ingestRequest{
+				bulk(orderJSON("a"), "{", "", orderJSON("c")),
+				bulk(orderJSON("a"), "{", "", orderJSON("c")),
+			},
+			responses: []ingestResponse{
+				{status: http.StatusOK, succeeded: 1, failed: 2, lines: map[int]string{1: "created", 2: "invalid", 4: "failed"}},
+				{status: http.StatusOK, succeeded: 1, failed: 2, lines: map[int]string{1: "created", 2: "invalid", 4: "failed"}},
+			},
+			processed: map[string]int{"a": 1, "c": 2},
+		},
+		{
+			name: "invalid bulk is rejected and not retried",
+			requests: []ingestRequest{
+				bulk("{", `{"order_uid":"b"}`),
+				bulk("{", `{"order_uid":"b"}`),
+			},
+			responses: []ingestResponse{
+				{status: http.StatusUnprocessableEntity, failed: 2, lines: map[int]string{1: "invalid", 2: "invalid"}},
+				{status: http.StatusUnprocessableEntity, replayed: true, failed: 2, lines: map[int]string{1: "invalid", 2: "invalid"}},
+			},
+			pending:   true,
+			processed: map[string]int{},
+		},
+		{
+			name: "failed bulk is a problem",
+			fail: map[string]error{"a": errors.New("db is down")},
+			requests: []ingestRequest{
+				bulk(orderJSON("a"), "{"),
+			},
+			responses: []ingestResponse{
+				{status: http.StatusServiceUnavailable},
+			},
+			processed: map[string]int{"a": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := &fakeProcessor{fail: tt.fail, calls: make(map[string]int)}
+			store := newFakeIdempotency()
+			as := &ApiServer{sugar: zap.NewNop().Sugar(), ingestion: OrderIngestion{Processor: processor, Idempotency: store}}
+
+			var first []byte
+			for i, req := range tt.requests {
+				rec := serveIngest(as, req)
+				got := ingestResponse{status: rec.Code, replayed: rec.Header().Get("Idempotent-Replayed") == "true"}
+				if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") && len(tt.responses[i].lines) > 0 {
+					var resp struct {
+						Succeeded int            `json:"succeeded"`
+						Failed    int            `json:"failed"`
+						Results   []ingestResult `json:"results"`
+					}
+					if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+						t.Fatal(err)
+					}
+					got.succeeded, got.failed, got.lines = resp.Succeeded, resp.Failed, make(map[int]string)
+					for _, res := range resp.Results {
+						got.lines[res.Line] = res.Status
+					}
+				}
+				if !reflect.DeepEqual(got, tt.responses[i]) {
+					t.Fatalf("request %d: expected %+v, got %+v: %s", i, tt.responses[i], got, rec.Body)
+				}
+				if got.replayed && rec.Body.String() != string(first) {
+					t.Fatalf("request %d: replayed %s instead of %s", i, rec.Body, first)
+				}
+				if i == 0 {
+					first = rec.Body.Bytes()
+				}
+			}
+			if _, pending := store.responses["key"]; pending != tt.pending {
+				t.Fatalf("expected the key to be stored %v, got %+v", tt.pending, store.responses)
+			}
+			if !reflect.DeepEqual(processor.calls, tt.processed) {
+				t.Fatalf("expected orders to be processed %v times, got %v", tt.processed, processor.calls)
+			}
+		})
+	}
+}
+
+func TestHandleIngestReleasesKeyOnPanic(t *testing.T) {
+	processor := &fakeProcessor{panics: map[string]bool{"a": true}, calls: make(map[string]int)}
+	store := newFakeIdempotency()
+	as := &ApiServer{sugar: zap.NewNop().Sugar(), ingestion: OrderIngestion{Processor: processor, Idempotency: store}}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the panic to reach the recovery middleware")
+			}
+		}()
+		serveIngest(as, ingestRequest{"application/json", orderJSON("a")})
+	}()
+	if stored, ok := store.responses["key"]; ok {
+		t.Fatalf("expected the key to be released, got %+v", stored)
+	}
+}
+
+func serveIngest(as *ApiServer, req ingestRequest) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(req.body))
+	r.Header.Set("Content-Type", req.contentType)
+	r.Header.Set("Idempotency-Key", "key")
+	rec := httptest.NewRecorder()
+	as.handleIngest(rec, r)
+	return rec
+}
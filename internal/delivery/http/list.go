@@ -0,0 +1,174 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/pii"
+	"MockOrderService/internal/service"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+type RejectionLog interface {
+	ListRejections(ctx context.Context, beforeID int64, limit int) ([]*model.Rejection, error)
+	DeleteCustomerRejections(ctx context.Context, customerIndex string) (int, error)
+}
+
+type listOrdersResponse struct {
+	// Orders are *model.Order or their sparse representations
+	Orders []any `json:"orders"`
+	// NextCursor is the after parameter of the next page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type listRejectionsResponse struct {
+	Rejections []*model.Rejection `json:"rejections"`
+	// NextBefore is the before parameter of the next page, 0 on the last page
+	NextBefore int64 `json:"next_before,omitempty"`
+}
+
+// handleListOrders returns a page of stored orders matching the filters of the export, newest first.
+// Pages are addressed by keyset cursors, so inserted orders don't shift them.
+func (as *ApiServer) handleListOrders(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	limit, err := parseListLimit(r)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	var after *model.OrderCursor
+	if value := r.URL.Query().Get("after"); value != "" {
+		if after, err = model.ParseOrderCursor(value); err != nil {
+			writeProblem(w, r, problemInvalidRequest, "invalid after cursor", as.sugar)
+			return
+		}
+	}
+	projection, err := parseOrderProjection(r)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	mask, err := maskPII(r)
+	if err != nil {
+		writeProblem(w, r, problemForbidden, err.Error(), as.sugar)
+		return
+	}
+	// otherwise masked personal data could be guessed by filtering
+	if (filter.Phone != "" || filter.Email != "") && !hasRole(r, unmaskedRole) {
+		writeProblem(w, r, problemForbidden, fmt.Sprintf("%s role is required to filter by phone or email", unmaskedRole), as.sugar)
+		return
+	}
+
+	// one more order tells if there is a next page
+	page, err := as.orderRepo.ListOrders(r.Context(), filter, after, limit+1)
+	if err != nil {
+		as.sugar.Errorw("couldn't list orders", "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "couldn't list orders")
+		return
+	}
+	resp := listOrdersResponse{Orders: make([]any, 0, min(len(page), limit))}
+	if len(page) > limit {
+		page = page[:limit]
+		resp.NextCursor = model.CursorOf(page[limit-1]).String()
+	}
+	orderUIDs := make([]string, 0, len(page))
+	for _, order := range page {
+		orderUIDs = append(orderUIDs, order.OrderUID)
+	}
+	orders, err := as.reader.GetOrders(r.Context(), orderUIDs, projection.parts)
+	if err != nil {
+		as.sugar.Errorw("couldn't get listed orders", "count", len(orderUIDs), "error", err)
+		as.writeStorageProblem(w, r, err, "couldn't get listed orders")
+		return
+	}
+	for _, orderUID := range orderUIDs {
+		order, ok := orders[orderUID]
+		if !ok {
+			// erased after it was listed
+			continue
+		}
+		if mask {
+			order = pii.MaskOrder(order)
+		}
+		v, err := projection.apply(order)
+		if err != nil {
+			as.sugar.Errorw("couldn't select order fields", "orderUID", orderUID, "error", err)
+			writeProblem(w, r, problemInternal, "couldn't encode response", as.sugar)
+			return
+		}
+		resp.Orders = append(resp.Orders, v)
+	}
+	w.Header().Set("Vary", "Authorization, "+apiKeyHeader)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, &resp, as.sugar)
+}
+
+// handleListRejections returns a page of the latest rejected messages with their validation problems, newest first.
+// Values of personal fields quoted in the problems are redacted for masked callers.
+func (as *ApiServer) handleListRejections(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseListLimit(r)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	var before int64
+	if value := r.URL.Query().Get("before"); value != "" {
+		if before, err = strconv.ParseInt(value, 10, 64); err != nil || before < 1 {
+			writeProblem(w, r, problemInvalidRequest, "before must be a positive rejection id", as.sugar)
+			return
+		}
+	}
+	mask, err := maskPII(r)
+	if err != nil {
+		writeProblem(w, r, problemForbidden, err.Error(), as.sugar)
+		return
+	}
+
+	rejections, err := as.cfg.Rejections.ListRejections(r.Context(), before, limit+1)
+	if err != nil {
+		as.sugar.Errorw("couldn't list rejections", "error", err)
+		// the log lives in redis next to the cache
+		as.writeStorageProblem(w, r, fmt.Errorf("%w: %w", service.ErrCacheUnavailable, err), "couldn't list rejections")
+		return
+	}
+	resp := listRejectionsResponse{Rejections: rejections}
+	if len(rejections) > limit {
+		resp.Rejections = rejections[:limit]
+		resp.NextBefore = rejections[limit-1].ID
+	}
+	// values are redacted before rejections are saved, older entries of the log may still quote them
+	if mask {
+		for _, rejection := range resp.Rejections {
+			for i, p := range rejection.Problems {
+				rejection.Problems[i].Message = pii.RedactProblem(p.Field, p.Message)
+			}
+		}
+	}
+	w.Header().Set("Vary", "Authorization, "+apiKeyHeader)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, &resp, as.sugar)
+}
+
+// parseListLimit reads the page size from ?limit=
+func parseListLimit(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.URL.Query().Get("limit"))
+	if value == "" {
+		return defaultListLimit, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxListLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+	return n, nil
+}
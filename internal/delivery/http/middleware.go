@@ -0,0 +1,196 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength limits ids taken from clients, longer ones are replaced
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// withMiddleware wraps a server handler with the middleware shared by api and web servers:
+// request ids, tracing, access logs and panic recovery
+func withMiddleware(next http.Handler, server string, sugar *zap.SugaredLogger) http.Handler {
+	return assignRequestID(traceRequest(logAccess(recoverPanic(next, sugar), server, sugar), server))
+}
+
+// assignRequestID keeps the X-Request-ID of the client or generates a new one.
+// The id is stored in the request context and echoed in the response.
+func assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID accepts printable ASCII ids without spaces, they end up in logs and headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestIDFrom returns the request id stored by assignRequestID
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestID returns the id of the request.
+// Outside of assignRequestID a new id is generated and stored in the request, so it stays the same.
+func requestID(r *http.Request) string {
+	if id := requestIDFrom(r.Context()); id != "" {
+		return id
+	}
+	if id := r.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	id := newRequestID()
+	r.Header.Set(requestIDHeader, id)
+	return id
+}
+
+// statusRecorder remembers the status and the size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over to websocket handlers, the response counts as 101 Switching Protocols
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(sr.ResponseWriter).Hijack()
+	if err == nil && sr.status == 0 {
+		sr.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// recordStatus wraps w unless an outer middleware did it already
+func recordStatus(w http.ResponseWriter) *statusRecorder {
+	if sr, ok := w.(*statusRecorder); ok {
+		return sr
+	}
+	return &statusRecorder{ResponseWriter: w}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// logAccess logs every request with its status, size and latency, server errors as warnings
+func logAccess(next http.Handler, server string, sugar *zap.SugaredLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := recordStatus(w)
+		aborted := true
+		defer func() {
+			status := sr.status
+			if status == 0 && !aborted {
+				status = http.StatusOK
+			}
+			fields := []any{
+				"server", server,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", status,
+				"bytes", sr.bytes,
+				"duration", time.Since(start),
+				"requestID", requestIDFrom(r.Context()),
+				"remote", r.RemoteAddr,
+			}
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+				fields = append(fields, "traceID", spanContext.TraceID().String())
+			}
+			switch {
+			case aborted:
+				sugar.Warnw("http request aborted", fields...)
+			case status >= http.StatusInternalServerError:
+				sugar.Warnw("http request", fields...)
+			default:
+				sugar.Infow("http request", fields...)
+			}
+		}()
+		next.ServeHTTP(sr, r)
+		aborted = false
+	})
+}
+
+// recoverPanic turns a handler panic into a 500 problem, or aborts the connection if the response has already started.
+// http.ErrAbortHandler is passed on, handlers use it to abort on purpose.
+func recoverPanic(next http.Handler, sugar *zap.SugaredLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			// the logger adds the stack trace of error entries, it includes the panicking frame
+			sugar.Errorw("panic in http handler", "path", r.URL.Path, "requestID", requestID(r), "panic", fmt.Sprint(rec))
+			if sr, ok := w.(*statusRecorder); ok && sr.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			writeProblem(w, r, problemInternal, "", sugar)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
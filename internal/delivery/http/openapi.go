@@ -0,0 +1,160 @@
+package http
+
+import (
+	"MockOrderService/api"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	// NDJSON bodies are validated as opaque strings, every line is validated by the handler
+	openapi3filter.RegisterBodyDecoder(ndjsonContentType, func(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (any, error) {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	})
+}
+
+// openAPIValidator checks requests and responses against api.OpenAPI
+type openAPIValidator struct {
+	sugar             *zap.SugaredLogger
+	router            routers.Router
+	validateResponses bool
+}
+
+// newOpenAPIValidator loads the document and builds a router over its paths.
+// If validateResponses is set, responses not matching the document are logged (they're still sent).
+func newOpenAPIValidator(sugar *zap.SugaredLogger, validateResponses bool) (*openAPIValidator, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(api.OpenAPI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openapi document: %w", err)
+	}
+	if err = doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+	// match paths regardless of the host the server is reached by
+	doc.Servers = nil
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build openapi router: %w", err)
+	}
+	return &openAPIValidator{sugar: sugar, router: router, validateResponses: validateResponses}, nil
+}
+
+// Middleware rejects requests which don't match the document with 400.
+// Routes missing from the document are passed through untouched.
+func (v *openAPIValidator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError: true,
+				// credentials are checked by ApiServer.authenticate
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err = openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			v.sugar.Infow("request doesn't match openapi document", "path", r.URL.Path, "error", err)
+			problem := newProblem(r, problemSchemaMismatch, "")
+			problem.Errors = schemaProblems(err)
+			writeProblemDetails(w, problem, v.sugar)
+			return
+		}
+
+		// streamed responses (x-streaming operations) are never buffered
+		if !v.validateResponses || route.Operation.Extensions["x-streaming"] == true {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.status,
+			Header:                 w.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(rec.body.Bytes())),
+			Options:                &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true},
+		})
+		if err != nil {
+			v.sugar.Warnw("response doesn't match openapi document", "path", r.URL.Path, "status", rec.status, "error", err)
+		}
+		w.WriteHeader(rec.status)
+		if _, err = w.Write(rec.body.Bytes()); err != nil {
+			v.sugar.Errorw("couldn't write response", "error", err)
+		}
+	})
+}
+
+// schemaProblems flattens validation errors into field problems
+func schemaProblems(err error) []FieldProblem {
+	var schemaErr *openapi3.SchemaError
+	// checked before unwrapping, parameter errors may wrap a MultiError of their own
+	if reqErr, ok := err.(*openapi3filter.RequestError); ok && reqErr.Parameter != nil {
+		reason := reqErr.Reason
+		if errors.As(reqErr.Err, &schemaErr) {
+			reason = schemaErr.Reason
+		}
+		if reason == "" && reqErr.Err != nil {
+			reason = reqErr.Err.Error()
+		}
+		return []FieldProblem{{Detail: fmt.Sprintf("parameter %q: %s", reqErr.Parameter.Name, reason)}}
+	}
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		problems := make([]FieldProblem, 0, len(multi))
+		for _, e := range multi {
+			problems = append(problems, schemaProblems(e)...)
+		}
+		return problems
+	}
+	if errors.As(err, &schemaErr) {
+		return []FieldProblem{{Field: "/" + strings.Join(schemaErr.JSONPointer(), "/"), Detail: schemaErr.Reason}}
+	}
+	return []FieldProblem{{Detail: err.Error()}}
+}
+
+// responseRecorder buffers the response so it can be validated before sending
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	return rr.body.Write(b)
+}
+
+// openAPIETag is computed once, the document is embedded into the binary
+var openAPIETag = etagOf(api.OpenAPI)
+
+// handleOpenAPI serves the OpenAPI document
+func (as *ApiServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeCacheable(w, r, "application/json", api.OpenAPI, openAPIETag, nil, as.cacheControl(RouteOpenAPI), as.sugar)
+}
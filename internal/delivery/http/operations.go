@@ -0,0 +1,17 @@
+package http
+
+import (
+	"MockOrderService/internal/monitoring"
+	"context"
+	"net/http"
+)
+
+type Operations interface {
+	Snapshot(ctx context.Context) *monitoring.OperationsSnapshot
+}
+
+// handleOperations returns the health of db, redis and kafka, the consumer lag and the pipeline metrics of this instance
+func (as *ApiServer) handleOperations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, as.cfg.Operations.Snapshot(r.Context()), as.sugar)
+}
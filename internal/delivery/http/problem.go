@@ -0,0 +1,99 @@
+package http
+
+import (
+	"MockOrderService/internal/validation"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:mockorderservice:problem:"
+)
+
+// Problem is an RFC 7807 problem details response
+type Problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	Errors    []FieldProblem `json:"errors,omitempty"`
+}
+
+// FieldProblem points to a single invalid field of the request
+type FieldProblem struct {
+	Field  string `json:"field,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// problemType describes a kind of problem: its type URI suffix, title and status
+type problemType struct {
+	slug   string
+	title  string
+	status int
+}
+
+var (
+	problemInvalidRequest      = problemType{"invalid-request", "Invalid request", http.StatusBadRequest}
+	problemSchemaMismatch      = problemType{"schema-mismatch", "Request doesn't match API schema", http.StatusBadRequest}
+	problemUnauthorized        = problemType{"unauthorized", "Authentication required", http.StatusUnauthorized}
+	problemForbidden           = problemType{"forbidden", "Access denied", http.StatusForbidden}
+	problemNotFound            = problemType{"not-found", "Resource not found", http.StatusNotFound}
+	problemMethodNotAllowed    = problemType{"method-not-allowed", "Method not allowed", http.StatusMethodNotAllowed}
+	problemRequestInProgress   = problemType{"request-in-progress", "Request is in progress", http.StatusConflict}
+	problemSpoolPending        = problemType{"spool-pending", "Orders are waiting to be stored", http.StatusConflict}
+	problemPayloadTooLarge     = problemType{"payload-too-large", "Payload too large", http.StatusRequestEntityTooLarge}
+	problemValidationFailed    = problemType{"validation-failed", "Order validation failed", http.StatusUnprocessableEntity}
+	problemIdempotencyKeyReuse = problemType{"idempotency-key-reused", "Idempotency-Key reused", http.StatusUnprocessableEntity}
+	problemTooManyRequests     = problemType{"rate-limited", "Too many requests", http.StatusTooManyRequests}
+	problemInternal            = problemType{"internal", "Internal error", http.StatusInternalServerError}
+	problemUpstreamUnavailable = problemType{"upstream-unavailable", "API is unavailable", http.StatusBadGateway}
+	problemTimeout             = problemType{"timeout", "Request timed out", http.StatusGatewayTimeout}
+	problemCacheUnavailable    = problemType{"cache-unavailable", "Cache is unavailable", http.StatusServiceUnavailable}
+	problemDBUnavailable       = problemType{"database-unavailable", "Database is unavailable", http.StatusServiceUnavailable}
+)
+
+// newProblem creates a problem of the given type for the request
+func newProblem(r *http.Request, pt problemType, detail string) *Problem {
+	return &Problem{
+		Type:      problemTypePrefix + pt.slug,
+		Title:     pt.title,
+		Status:    pt.status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestID(r),
+	}
+}
+
+// writeProblem writes a problem details response
+func writeProblem(w http.ResponseWriter, r *http.Request, pt problemType, detail string, sugar *zap.SugaredLogger) {
+	writeProblemDetails(w, newProblem(r, pt, detail), sugar)
+}
+
+// writeProblemDetails writes a prepared problem, e.g. with field-level errors
+func writeProblemDetails(w http.ResponseWriter, p *Problem, sugar *zap.SugaredLogger) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		sugar.Errorw("couldn't encode problem", "type", p.Type, "error", err)
+	}
+}
+
+// validationProblems converts business validation problems to field problems
+func validationProblems(problems []validation.FieldProblem) []FieldProblem {
+	fields := make([]FieldProblem, 0, len(problems))
+	for _, p := range problems {
+		fields = append(fields, FieldProblem{Field: p.Field, Detail: p.Message})
+	}
+	return fields
+}
+
+// problemHandler responds with a fixed problem, used for unmatched routes
+func problemHandler(pt problemType, sugar *zap.SugaredLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, pt, "", sugar)
+	})
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"MockOrderService/internal/auth"
+	"MockOrderService/internal/ratelimit"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error)
+}
+
+// DefaultRateLimits is used for routes without a configured limit, routes missing here aren't limited.
+// Order reads fall through to the database on cache misses, exports scan it, streams hold a connection each.
+var DefaultRateLimits = map[string]string{
+	RouteOrder:      "50/1s,burst=100",
+	RouteBatch:      "10/1s,burst=20",
+	RouteIngest:     "20/1s,burst=50",
+	RouteExport:     "6/1m,burst=2",
+	RouteAdmin:      "10/1s,burst=20",
+	RouteStream:     "10/1m,burst=10",
+	RouteGraphQL:    "20/1s,burst=40",
+	RouteSearch:     "10/1s,burst=20",
+	RouteAnalytics:  "5/1s,burst=10",
+	RouteList:       "20/1s,burst=40",
+	RouteOperations: "10/1s,burst=20",
+}
+
+// rateLimitOff disables the limit of a route
+const rateLimitOff = "off"
+
+// parseRateLimits merges configured limits over the defaults
+func parseRateLimits(configured map[string]string) (map[string]ratelimit.Limit, error) {
+	limits := make(map[string]ratelimit.Limit, len(DefaultRateLimits))
+	for _, routes := range []map[string]string{DefaultRateLimits, configured} {
+		for route, spec := range routes {
+			if spec == rateLimitOff {
+				delete(limits, route)
+				continue
+			}
+			limit, err := ratelimit.ParseLimit(spec)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit of %s route: %w", route, err)
+			}
+			limits[route] = limit
+		}
+	}
+	return limits, nil
+}
+
+// limit takes a token from the bucket of the client for the route and rejects the request with 429 if there is none.
+// Requests are served anyway if the limiter fails.
+func (as *ApiServer) limit(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := as.rateLimits[route]
+		if as.cfg.RateLimiter == nil || !ok {
+			next(w, r)
+			return
+		}
+		client := as.rateLimitClient(r)
+		res, err := as.cfg.RateLimiter.Allow(r.Context(), route+":"+client, limit)
+		if err != nil {
+			as.sugar.Warnw("rate limiter failed, request is not limited", "route", route, "error", err)
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			as.sugar.Infow("request is rate limited", "route", route, "client", client, "retryAfter", res.RetryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			writeProblem(w, r, problemTooManyRequests, fmt.Sprintf("rate limit of %s exceeded", limit), as.sugar)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rateLimitClient identifies the caller: authenticated callers by their subject, anonymous ones by ip
+func (as *ApiServer) rateLimitClient(r *http.Request) string {
+	principal := auth.PrincipalFrom(r.Context())
+	if principal != nil && principal.Method != auth.MethodNone {
+		return principal.Method + ":" + principal.Subject
+	}
+	return "ip:" + as.clientIP(r)
+}
+
+// clientIP returns the remote address, or the last X-Forwarded-For address if the api server is behind a proxy
+func (as *ApiServer) clientIP(r *http.Request) string {
+	if as.cfg.TrustProxy {
+		// the proxy appends the address it got the request from
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			addrs := strings.Split(values[len(values)-1], ",")
+			if addr := strings.TrimSpace(addrs[len(addrs)-1]); addr != "" {
+				return addr
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ceilSeconds rounds d up to whole seconds as headers carry them
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
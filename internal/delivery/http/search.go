@@ -0,0 +1,123 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/pii"
+	"MockOrderService/internal/service"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// minSearchQuery and maxSearchQuery limit the length of ?q= in characters
+	minSearchQuery = 2
+	maxSearchQuery = 200
+
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+type searchResult struct {
+	OrderUID   string            `json:"order_uid"`
+	Rank       float64           `json:"rank"`
+	Highlights []searchHighlight `json:"highlights"`
+	// Order is *model.Order or its sparse representation
+	Order any `json:"order"`
+}
+
+// searchHighlight is a matched field, the fragment is HTML-escaped with matches enclosed in <mark>
+type searchHighlight struct {
+	Field    string `json:"field"`
+	Fragment string `json:"fragment"`
+}
+
+type searchResponse struct {
+	Results []searchResult `json:"results"`
+	// Warnings tell why the search covered less than the caller may expect
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// handleSearch finds orders by words of item names and brands, delivery cities and addresses and track numbers.
+// Addresses are personal data, so they are searched only for callers who see them unmasked.
+// Encrypted addresses aren't indexed, such callers get a warning that addresses weren't searched.
+func (as *ApiServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if n := utf8.RuneCountInString(q); n < minSearchQuery || n > maxSearchQuery {
+		writeProblem(w, r, problemInvalidRequest, fmt.Sprintf("q must have %d to %d characters", minSearchQuery, maxSearchQuery), as.sugar)
+		return
+	}
+	limit := defaultSearchLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			writeProblem(w, r, problemInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit), as.sugar)
+			return
+		}
+		limit = n
+	}
+	projection, err := parseOrderProjection(r)
+	if err != nil {
+		writeProblem(w, r, problemInvalidRequest, err.Error(), as.sugar)
+		return
+	}
+	mask, err := maskPII(r)
+	if err != nil {
+		writeProblem(w, r, problemForbidden, err.Error(), as.sugar)
+		return
+	}
+
+	hits, err := as.orderRepo.SearchOrders(r.Context(), model.OrderSearch{Query: q, Limit: limit, Addresses: !mask})
+	if err != nil {
+		as.sugar.Errorw("order search failed", "error", err)
+		as.writeStorageProblem(w, r, service.ClassifyDBError(err), "order search failed")
+		return
+	}
+	orderUIDs := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		orderUIDs = append(orderUIDs, hit.OrderUID)
+	}
+	orders, err := as.reader.GetOrders(r.Context(), orderUIDs, projection.parts)
+	if err != nil {
+		as.sugar.Errorw("couldn't get found orders", "count", len(orderUIDs), "error", err)
+		as.writeStorageProblem(w, r, err, "couldn't get found orders")
+		return
+	}
+
+	resp := searchResponse{Results: make([]searchResult, 0, len(hits))}
+	if !mask && as.cfg.EncryptedDeliveries {
+		resp.Warnings = append(resp.Warnings, "delivery addresses are encrypted and weren't searched")
+	}
+	for _, hit := range hits {
+		order, ok := orders[hit.OrderUID]
+		if !ok {
+			// erased after it was found
+			continue
+		}
+		if mask {
+			order = pii.MaskOrder(order)
+		}
+		result := searchResult{OrderUID: hit.OrderUID, Rank: hit.Rank, Highlights: make([]searchHighlight, 0, len(hit.Highlights))}
+		for _, h := range hit.Highlights {
+			result.Highlights = append(result.Highlights, searchHighlight{Field: h.Field, Fragment: highlightHTML(h.Fragment)})
+		}
+		if result.Order, err = projection.apply(order); err != nil {
+			as.sugar.Errorw("couldn't select order fields", "orderUID", hit.OrderUID, "error", err)
+			writeProblem(w, r, problemInternal, "couldn't encode response", as.sugar)
+			return
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	w.Header().Set("Vary", "Authorization, "+apiKeyHeader)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, &resp, as.sugar)
+}
+
+// highlightHTML escapes a fragment and turns highlight markers into <mark> tags, item names may contain markup
+func highlightHTML(fragment string) string {
+	return strings.NewReplacer(model.HighlightStart, "<mark>", model.HighlightStop, "</mark>").Replace(html.EscapeString(fragment))
+}
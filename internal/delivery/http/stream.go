@@ -0,0 +1,287 @@
+package http
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/pii"
+	"MockOrderService/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// streamBuffer is the amount of events a stream may fall behind before it's closed
+	streamBuffer = 256
+	// streamHeartbeat keeps idle streams from being closed by proxies
+	streamHeartbeat = 15 * time.Second
+	// streamWriteTimeout drops clients which stopped reading
+	streamWriteTimeout = 10 * time.Second
+	// streamRetry tells EventSource clients how long to wait before reconnecting, in milliseconds
+	streamRetry = 3000
+
+	lastEventIDHeader = "Last-Event-ID"
+)
+
+// errStreamLagging means the client read too slowly and events were dropped, it should reconnect and resume
+var errStreamLagging = errors.New("stream fell behind")
+
+// streamEvent is an order event as sent to stream clients
+type streamEvent struct {
+	// ID is 0 for events that only this replica knows about, they can't be resumed from
+	ID       int64        `json:"id,omitempty"`
+	Type     string       `json:"type"`
+	OrderUID string       `json:"order_uid"`
+	At       time.Time    `json:"at"`
+	Order    *model.Order `json:"order,omitempty"`
+}
+
+// streamRequest holds the parameters shared by the SSE and websocket streams
+type streamRequest struct {
+	filter      service.OrderEventFilter
+	mask        bool
+	lastEventID int64
+}
+
+// parseStreamRequest reads the filters, masking and the id to resume after.
+// The id comes from Last-Event-ID, which EventSource sends on reconnects, or from ?last_event_id=.
+func parseStreamRequest(r *http.Request) (streamRequest, problemType, error) {
+	query := r.URL.Query()
+	req := streamRequest{filter: service.OrderEventFilter{
+		CustomerID:      query.Get("customer_id"),
+		DeliveryService: query.Get("delivery_service"),
+		Locale:          query.Get("locale"),
+	}}
+	if value := query.Get("status"); value != "" {
+		status, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return req, problemInvalidRequest, fmt.Errorf("status must be an integer")
+		}
+		itemStatus := int32(status)
+		req.filter.ItemStatus = &itemStatus
+	}
+	lastEventID := r.Header.Get(lastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			return req, problemInvalidRequest, fmt.Errorf("last event id must be a non-negative integer")
+		}
+		req.lastEventID = id
+	}
+	mask, err := maskPII(r)
+	if err != nil {
+		return req, problemForbidden, err
+	}
+	req.mask = mask
+	return req, problemType{}, nil
+}
+
+// feedSubscription is a live subscription with the events missed since the last event id of the client
+type feedSubscription struct {
+	events      <-chan service.OrderEvent
+	unsubscribe func()
+	backlog     []service.OrderEvent
+}
+
+// subscribeFeed subscribes before replaying, so no event falls between the backlog and live events
+func (as *ApiServer) subscribeFeed(ctx context.Context, lastEventID int64) (*feedSubscription, error) {
+	events, unsubscribe := as.cfg.Feed.Subscribe(streamBuffer)
+	sub := &feedSubscription{events: events, unsubscribe: unsubscribe}
+	if lastEventID > 0 {
+		backlog, err := as.cfg.Feed.Replay(ctx, lastEventID)
+		if err != nil {
+			unsubscribe()
+			return nil, err
+		}
+		sub.backlog = backlog
+	}
+	return sub, nil
+}
+
+// followFeed passes the backlog and then live events matching the request to send, pinging idle clients.
+// It returns nil once ctx is done or the server shuts down, errStreamLagging if the client fell behind.
+func (as *ApiServer) followFeed(ctx context.Context, sub *feedSubscription, req streamRequest, send func(ev streamEvent) error, ping func() error) error {
+	lastID := req.lastEventID
+	deliver := func(ev service.OrderEvent) error {
+		// replayed events may arrive live as well
+		if ev.ID != 0 && ev.ID <= lastID {
+			return nil
+		}
+		lastID = max(lastID, ev.ID)
+		if !req.filter.Match(ev) {
+			return nil
+		}
+		order := ev.Order
+		if req.mask {
+			order = pii.MaskOrder(order)
+		}
+		return send(streamEvent{ID: ev.ID, Type: ev.Type, OrderUID: ev.OrderUID, At: ev.At, Order: order})
+	}
+
+	for _, ev := range sub.backlog {
+		if err := deliver(ev); err != nil {
+			return err
+		}
+	}
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-as.ctx.Done():
+			return nil
+		case ev, ok := <-sub.events:
+			if !ok {
+				return errStreamLagging
+			}
+			if err := deliver(ev); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleStream sends order events as Server-Sent Events.
+// A client which falls behind is disconnected, EventSource reconnects with Last-Event-ID and gets the missed events.
+func (as *ApiServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	req, problem, err := parseStreamRequest(r)
+	if err != nil {
+		writeProblem(w, r, problem, err.Error(), as.sugar)
+		return
+	}
+	sub, err := as.subscribeFeed(r.Context(), req.lastEventID)
+	if err != nil {
+		as.sugar.Errorw("couldn't replay order events", "lastEventID", req.lastEventID, "error", err)
+		as.writeStorageProblem(w, r, err, "couldn't replay order events")
+		return
+	}
+	defer sub.unsubscribe()
+
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// nginx would buffer the stream otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err = write("retry: %d\n\n", streamRetry); err != nil {
+		return
+	}
+
+	err = as.followFeed(r.Context(), sub, req, func(ev streamEvent) error {
+		data, err := json.Marshal(&ev)
+		if err != nil {
+			return err
+		}
+		if ev.ID == 0 {
+			return write("event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		return write("id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	}, func() error {
+		return write(": ping\n\n")
+	})
+	as.logStreamEnd(r, "sse", err)
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// handleWebSocket sends order events as JSON text messages over a websocket.
+// Clients resume with ?last_event_id=, browsers can't set headers on websockets.
+// A client which falls behind is closed with 1013 (try again later).
+func (as *ApiServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	req, problem, err := parseStreamRequest(r)
+	if err != nil {
+		writeProblem(w, r, problem, err.Error(), as.sugar)
+		return
+	}
+	sub, err := as.subscribeFeed(r.Context(), req.lastEventID)
+	if err != nil {
+		as.sugar.Errorw("couldn't replay order events", "lastEventID", req.lastEventID, "error", err)
+		as.writeStorageProblem(w, r, err, "couldn't replay order events")
+		return
+	}
+	defer sub.unsubscribe()
+
+	upgrader := upgrader
+	upgrader.Error = func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		// cross-origin browsers are refused with 403
+		problem := problemInvalidRequest
+		if status == http.StatusForbidden {
+			problem = problemForbidden
+		}
+		writeProblem(w, r, problem, reason.Error(), as.sugar)
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has responded already
+		return
+	}
+	defer conn.Close()
+
+	// the connection is hijacked, so only reads notice a client going away
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+	go func() {
+		defer cancel()
+		conn.SetReadLimit(512)
+		_ = conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		})
+		// clients aren't expected to send anything, control frames are handled while reading
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = as.followFeed(ctx, sub, req, func(ev streamEvent) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteJSON(&ev)
+	}, func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+	})
+
+	closeCode, reason := websocket.CloseNormalClosure, ""
+	switch {
+	case errors.Is(err, errStreamLagging):
+		closeCode, reason = websocket.CloseTryAgainLater, err.Error()
+	case err == nil && as.ctx.Err() != nil:
+		closeCode, reason = websocket.CloseGoingAway, "server is shutting down"
+	}
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(time.Second))
+	as.logStreamEnd(r, "websocket", err)
+}
+
+func (as *ApiServer) logStreamEnd(r *http.Request, transport string, err error) {
+	switch {
+	case err == nil:
+		as.sugar.Infow("order stream closed", "transport", transport, "requestID", requestIDFrom(r.Context()))
+	case errors.Is(err, errStreamLagging):
+		as.sugar.Warnw("order stream fell behind, closing it", "transport", transport, "requestID", requestIDFrom(r.Context()))
+	default:
+		as.sugar.Infow("order stream broken", "transport", transport, "requestID", requestIDFrom(r.Context()), "error", err)
+	}
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeouts is used for routes without a configured timeout, routes missing here have no deadline.
+// Exports stream the whole table, so they get much longer. Order streams never end on their own and have none.
+var DefaultTimeouts = map[string]time.Duration{
+	RouteOrder:      5 * time.Second,
+	RouteBatch:      10 * time.Second,
+	RouteIngest:     30 * time.Second,
+	RouteExport:     10 * time.Minute,
+	RouteAdmin:      time.Minute,
+	RouteGraphQL:    15 * time.Second,
+	RouteSearch:     10 * time.Second,
+	RouteAnalytics:  30 * time.Second,
+	RouteList:       10 * time.Second,
+	RouteOperations: 10 * time.Second,
+}
+
+// routeTimeout returns the deadline of a route, 0 means none
+func (as *ApiServer) routeTimeout(route string) time.Duration {
+	if timeout, ok := as.cfg.Timeouts[route]; ok {
+		return timeout
+	}
+	return DefaultTimeouts[route]
+}
+
+// timeout serves the request with a context that ends after the route timeout.
+// The request context is also canceled when the client goes away.
+func (as *ApiServer) timeout(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout := as.routeTimeout(route)
+		if timeout <= 0 {
+			next(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// timedOut tells if the request ran out of its deadline, errors of db and cache don't always wrap it
+func timedOut(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.DeadlineExceeded)
+}
+
+// clientGone tells if the client closed the connection, there is nobody to respond to
+func clientGone(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.Canceled)
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"MockOrderService/internal/tracing"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// traceRequest records a server span per request, continuing the trace of the caller if it sent a traceparent.
+// The span is named after the route once it's known, see nameSpan.
+func traceRequest(next http.Handler, server string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path),
+				attribute.String("server", server), attribute.String("http.request.id", requestIDFrom(r.Context()))))
+		sr := recordStatus(w)
+		req := r.WithContext(ctx)
+		defer func() {
+			if rec := recover(); rec != nil {
+				span.SetStatus(codes.Error, "request aborted")
+				span.End()
+				panic(rec)
+			}
+		}()
+		next.ServeHTTP(sr, req)
+
+		// http.ServeMux stores the matched pattern in the request
+		if req.Pattern != "" {
+			span.SetName(req.Pattern)
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(sr.status))
+		if sr.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sr.status))
+		}
+		span.End()
+	})
+}
+
+// nameSpan names the server span after the matched route template, it's a router middleware
+func nameSpan(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + template)
+				span.SetAttributes(semconv.HTTPRoute(template))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"MockOrderService/internal/monitoring"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// operationsRefresh is how often the operations page gets a new snapshot
+const operationsRefresh = 2 * time.Second
+
+var operationsTmpl = template.Must(template.ParseFiles(filepath.Join(getTemplateDir(), "operations.html")))
+
+// operationsData передаётся в шаблон страницы операций, сами метрики приходят по SSE
+type operationsData struct {
+	RefreshSeconds float64
+}
+
+// handleOperationsPage renders the operations page, it subscribes to /operations/events by itself
+func (ws *WebServer) handleOperationsPage(w http.ResponseWriter, r *http.Request, sugar *zap.SugaredLogger) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var buf bytes.Buffer
+	if err := operationsTmpl.Execute(&buf, operationsData{RefreshSeconds: operationsRefresh.Seconds()}); err != nil {
+		sugar.Errorw("failed to execute template", "error", err)
+		writeProblem(w, r, problemInternal, "internal template error", sugar)
+		return
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		sugar.Errorw("failed to write page", "error", err)
+	}
+}
+
+// handleOperationsEvents streams a snapshot of the pipeline every operationsRefresh as SSE.
+// Snapshots are "snapshot" events, failures to get one are "failure" events with the message as a JSON string.
+func (ws *WebServer) handleOperationsEvents(w http.ResponseWriter, r *http.Request, sugar *zap.SugaredLogger) {
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := write("retry: %d\n\n", streamRetry); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(operationsRefresh)
+	defer ticker.Stop()
+	var failure string
+	for {
+		snapshot, msg := ws.fetchOperations(r.Context())
+		// the page is polled, so a failure is logged once until it changes
+		if msg != "" && msg != failure {
+			sugar.Warnw("couldn't get operations snapshot", "error", msg)
+		}
+		failure = msg
+
+		var err error
+		if msg != "" {
+			data, _ := json.Marshal(msg)
+			err = write("event: failure\ndata: %s\n\n", data)
+		} else {
+			var data []byte
+			if data, err = json.Marshal(snapshot); err == nil {
+				err = write("event: snapshot\ndata: %s\n\n", data)
+			}
+		}
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ws.streams.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchOperations reads the operations snapshot from the api
+func (ws *WebServer) fetchOperations(ctx context.Context) (*monitoring.OperationsSnapshot, string) {
+	resp, err := ws.client.GetOperationsWithResponse(ctx)
+	switch {
+	case err != nil:
+		return nil, "failed to reach API: " + err.Error()
+	case resp.JSON200 != nil:
+		return resp.JSON200, ""
+	default:
+		return nil, responseError(resp.HTTPResponse, resp.Body)
+	}
+}
@@ -1,22 +1,76 @@
 package http
 
 import (
+	"MockOrderService/api/orderclient"
 	"MockOrderService/internal/domain/model"
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"go.uber.org/zap"
 	"html/template"
-	"io"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// maxCachedOrders limits the amount of orders the dashboard keeps for conditional requests
+const maxCachedOrders = 256
+
 type WebServer struct {
 	server *http.Server
+	client *orderclient.ClientWithResponses
+	// maskPII asks the api for masked personal data
+	maskPII bool
+
+	// orders fetched from the api with their ETags, so repeated lookups are answered with 304
+	mu     sync.Mutex
+	orders map[string]etaggedOrder
+
+	// streams is canceled on shutdown, so the operations streams don't hold it up
+	streams     context.Context
+	stopStreams context.CancelFunc
+}
+
+type etaggedOrder struct {
+	etag  string
+	order *model.Order
+}
+
+// NewWebServer creates a web server which reads orders from the api at apiURL.
+// apiKey is sent with every request if set, with maskPII orders are shown with masked personal data.
+func NewWebServer(apiURL string, apiKey string, maskPII bool) (*WebServer, error) {
+	client, err := orderclient.NewClientWithResponses(apiURL,
+		orderclient.WithHTTPClient(&http.Client{Timeout: 5 * time.Second}),
+		orderclient.WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+			if apiKey != "" {
+				req.Header.Set(apiKeyHeader, apiKey)
+			}
+			// api logs, problems and traces are linked to the dashboard request
+			if id := requestIDFrom(ctx); id != "" {
+				req.Header.Set(requestIDHeader, id)
+			}
+			otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+			return nil
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api client: %w", err)
+	}
+	streams, stopStreams := context.WithCancel(context.Background())
+	return &WebServer{
+		client:      client,
+		maskPII:     maskPII,
+		orders:      make(map[string]etaggedOrder),
+		streams:     streams,
+		stopStreams: stopStreams,
+	}, nil
 }
 
 // StartWebServer starts client server in a separate goroutine.
@@ -26,12 +80,19 @@ type WebServer struct {
 func (ws *WebServer) StartWebServer(sugar *zap.SugaredLogger) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, sugar)
+		ws.handleRequest(w, r, sugar)
+	})
+	mux.HandleFunc("GET /operations", func(w http.ResponseWriter, r *http.Request) {
+		ws.handleOperationsPage(w, r, sugar)
+	})
+	mux.HandleFunc("GET /operations/events", func(w http.ResponseWriter, r *http.Request) {
+		ws.handleOperationsEvents(w, r, sugar)
 	})
 	srv := &http.Server{
 		Addr:    ":8082",
-		Handler: mux,
+		Handler: withMiddleware(mux, "web", sugar),
 	}
+	srv.RegisterOnShutdown(ws.stopStreams)
 	ws.server = srv
 	sugar.Infow("started client server at :8082")
 	err := srv.ListenAndServe()
@@ -50,9 +111,8 @@ func (ws *WebServer) Shutdown(ctx context.Context) error {
 
 }
 
-type APIError struct {
-	Error string `json:"Error"`
-}
+// dashboardPageSize is the amount of orders and rejections per page of the dashboard
+const dashboardPageSize = 20
 
 // templateData передаётся в HTML-шаблон
 type templateData struct {
@@ -60,6 +120,90 @@ type templateData struct {
 	Order *model.Order
 	Error string
 	Now   time.Time
+
+	// Filter of the order list, dates are inclusive
+	Filter dashboardFilter
+	// After is the cursor of the shown page of orders, empty for the first one
+	After       string
+	Orders      []model.Order
+	NextCursor  string
+	OrdersError string
+
+	// Before is the id the shown page of rejections ends before, 0 for the first one
+	Before          int64
+	Rejections      []model.Rejection
+	NextBefore      int64
+	RejectionsError string
+}
+
+// dashboardFilter is the order list filter of the dashboard form
+type dashboardFilter struct {
+	CustomerID      string
+	DeliveryService string
+	// From and To are dates (YYYY-MM-DD), both inclusive
+	From string
+	To   string
+}
+
+// query returns the filter as dashboard query parameters
+func (f dashboardFilter) query() url.Values {
+	q := url.Values{}
+	for key, value := range map[string]string{"customer": f.CustomerID, "service": f.DeliveryService, "from": f.From, "to": f.To} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	return q
+}
+
+// listQuery returns the query parameters of the shown pages of orders and rejections
+func (d templateData) listQuery() url.Values {
+	q := d.Filter.query()
+	if d.After != "" {
+		q.Set("after", d.After)
+	}
+	if d.Before != 0 {
+		q.Set("before", strconv.FormatInt(d.Before, 10))
+	}
+	return q
+}
+
+// ListURL closes the order keeping the lists as they are
+func (d templateData) ListURL() string {
+	return "/?" + d.listQuery().Encode()
+}
+
+// OrderURL opens an order keeping the lists as they are
+func (d templateData) OrderURL(orderUID string) string {
+	q := d.listQuery()
+	q.Set("orderUID", orderUID)
+	return "/?" + q.Encode()
+}
+
+// NextOrdersURL opens the next page of orders
+func (d templateData) NextOrdersURL() string {
+	q := d.Filter.query()
+	q.Set("after", d.NextCursor)
+	return "/?" + q.Encode()
+}
+
+// FirstOrdersURL opens the first page of orders
+func (d templateData) FirstOrdersURL() string {
+	return "/?" + d.Filter.query().Encode()
+}
+
+// NextRejectionsURL opens the next page of rejections keeping the orders as they are
+func (d templateData) NextRejectionsURL() string {
+	q := d.listQuery()
+	q.Set("before", strconv.FormatInt(d.NextBefore, 10))
+	return "/?" + q.Encode()
+}
+
+// FirstRejectionsURL opens the first page of rejections keeping the orders as they are
+func (d templateData) FirstRejectionsURL() string {
+	q := d.listQuery()
+	q.Del("before")
+	return "/?" + q.Encode()
 }
 
 // getTemplateDir возвращает директорию с HTML-шаблонами
@@ -85,89 +229,197 @@ var dashboardTmpl = template.Must(template.New("dashboard.html").Funcs(template.
 		}
 		return t.Format(time.RFC3339)
 	},
+	"formatDate": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("2006-01-02 15:04")
+	},
 }).ParseFiles(getDashboardTemplate()))
 
-// handleRequest обрабатывает форму и делает запрос к API, парсит JSON и рендерит шаблон.
-func handleRequest(w http.ResponseWriter, r *http.Request, sugar *zap.SugaredLogger) {
+// handleRequest обрабатывает форму, запрашивает заказ, страницу заказов и отклонённые сообщения через клиент API
+// и рендерит шаблон.
+func (ws *WebServer) handleRequest(w http.ResponseWriter, r *http.Request, sugar *zap.SugaredLogger) {
 	ctx := r.Context()
-	q := strings.TrimSpace(r.URL.Query().Get("orderUID"))
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("orderUID"))
 
 	data := templateData{
 		Query: q,
 		Now:   time.Now(),
+		Filter: dashboardFilter{
+			CustomerID:      strings.TrimSpace(query.Get("customer")),
+			DeliveryService: strings.TrimSpace(query.Get("service")),
+			From:            query.Get("from"),
+			To:              query.Get("to"),
+		},
+		After: query.Get("after"),
+	}
+	if before, err := strconv.ParseInt(query.Get("before"), 10, 64); err == nil && before > 0 {
+		data.Before = before
 	}
 
 	if q != "" {
-		// build API URL
-		apiURL := "http://localhost:8081/api/order/" + url.PathEscape(q)
+		data.Order, data.Error = ws.fetchOrder(ctx, q, sugar)
+	}
+	data.Orders, data.NextCursor, data.OrdersError = ws.fetchOrders(ctx, data.Filter, data.After, sugar)
+	data.Rejections, data.NextBefore, data.RejectionsError = ws.fetchRejections(ctx, data.Before, sugar)
 
-		// HTTP client with timeout
-		client := &http.Client{Timeout: 5 * time.Second}
+	// Render template, buffered so that a failure can still be reported as a problem
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var buf bytes.Buffer
+	if err := dashboardTmpl.Execute(&buf, data); err != nil {
+		sugar.Errorw("failed to execute template", "error", err)
+		writeProblem(w, r, problemInternal, "internal template error", sugar)
+		return
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		sugar.Errorw("failed to write page", "error", err)
+	}
+}
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+// fetchOrder reads an order, repeated lookups are conditional. Failures are returned as a message for the page.
+func (ws *WebServer) fetchOrder(ctx context.Context, orderUID string, sugar *zap.SugaredLogger) (*model.Order, string) {
+	params := &orderclient.GetOrderParams{}
+	if ws.maskPII {
+		params.Mask = &ws.maskPII
+	}
+	cached, isCached := ws.cachedOrder(orderUID)
+	if isCached {
+		params.IfNoneMatch = &cached.etag
+	}
+
+	resp, err := ws.client.GetOrderWithResponse(ctx, orderUID, params)
+	switch {
+	case err != nil:
+		sugar.Errorw("request to API failed", "error", err, "orderUID", orderUID)
+		return nil, "failed to reach API: " + err.Error()
+	case resp.StatusCode() == http.StatusNotModified && isCached:
+		return cached.order, ""
+	case resp.JSON200 != nil:
+		ws.cacheOrder(orderUID, resp.HTTPResponse.Header.Get("ETag"), resp.JSON200)
+		return resp.JSON200, ""
+	default:
+		return nil, responseError(resp.HTTPResponse, resp.Body)
+	}
+}
+
+// fetchOrders reads a page of orders matching the filter, the cursor of the next page is empty on the last one
+func (ws *WebServer) fetchOrders(ctx context.Context, filter dashboardFilter, after string, sugar *zap.SugaredLogger) ([]model.Order, string, string) {
+	limit := dashboardPageSize
+	params := &orderclient.ListOrdersParams{Limit: &limit}
+	if ws.maskPII {
+		params.Mask = &ws.maskPII
+	}
+	if filter.CustomerID != "" {
+		params.CustomerId = &filter.CustomerID
+	}
+	if filter.DeliveryService != "" {
+		params.DeliveryService = &filter.DeliveryService
+	}
+	if filter.From != "" {
+		params.From = &filter.From
+	}
+	if filter.To != "" {
+		// the api excludes the end of the range, the dashboard includes the last day
+		to, err := time.Parse(time.DateOnly, filter.To)
 		if err != nil {
-			sugar.Errorw("failed to create request", "error", err)
-			data.Error = "internal: failed to create request"
-			_ = dashboardTmpl.Execute(w, data)
-			return
+			return nil, "", "date must be like 2021-11-26"
 		}
+		next := to.AddDate(0, 0, 1).Format(time.DateOnly)
+		params.To = &next
+	}
+	if after != "" {
+		params.After = &after
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			sugar.Errorw("request to API failed", "error", err, "apiURL", apiURL)
-			data.Error = "failed to reach API: " + err.Error()
-			_ = dashboardTmpl.Execute(w, data)
-			return
+	resp, err := ws.client.ListOrdersWithResponse(ctx, params)
+	switch {
+	case err != nil:
+		sugar.Errorw("request to API failed", "error", err)
+		return nil, "", "failed to reach API: " + err.Error()
+	case resp.JSON200 != nil:
+		var next string
+		if resp.JSON200.NextCursor != nil {
+			next = *resp.JSON200.NextCursor
 		}
-		defer resp.Body.Close()
-
-		// Read and decode into Order (primary) or APIError (fallback)
-		var order model.Order
-		dec := json.NewDecoder(resp.Body)
-		if err := dec.Decode(&order); err == nil && order.OrderUID != "" {
-			// success: we got an order
-			data.Order = &order
-		} else {
-			// try to decode API error (rewind by re-fetching body not possible, so re-request or decode via bytes)
-
-			// reset by reading raw bytes from a fresh request
-			resp.Body.Close()
-			resp2, err2 := client.Get(apiURL)
-			if err2 != nil {
-				sugar.Errorw("request retry failed", "error", err2)
-				data.Error = "failed to read API response"
-				_ = dashboardTmpl.Execute(w, data)
-				return
-			}
-			defer resp2.Body.Close()
-			raw, err3 := io.ReadAll(resp2.Body)
-			if err3 != nil {
-				sugar.Errorw("failed to read body", "error", err3)
-				data.Error = "failed to read API response"
-				_ = dashboardTmpl.Execute(w, data)
-				return
-			}
+		return resp.JSON200.Orders, next, ""
+	default:
+		return nil, "", responseError(resp.HTTPResponse, resp.Body)
+	}
+}
 
-			// try unmarshal into Order one more time
-			if err := json.Unmarshal(raw, &order); err == nil && order.OrderUID != "" {
-				data.Order = &order
-			} else {
-				// try APIError
-				var apiErr APIError
-				if err := json.Unmarshal(raw, &apiErr); err == nil && apiErr.Error != "" {
-					data.Error = apiErr.Error
-				} else {
-					// fallback: show raw body as error
-					data.Error = "unexpected API response: " + string(raw)
-				}
-			}
+// fetchRejections reads a page of rejected messages, the next page starts before the returned id, 0 on the last one
+func (ws *WebServer) fetchRejections(ctx context.Context, before int64, sugar *zap.SugaredLogger) ([]model.Rejection, int64, string) {
+	limit := dashboardPageSize
+	params := &orderclient.ListRejectionsParams{Limit: &limit}
+	if ws.maskPII {
+		params.Mask = &ws.maskPII
+	}
+	if before > 0 {
+		params.Before = &before
+	}
+
+	resp, err := ws.client.ListRejectionsWithResponse(ctx, params)
+	switch {
+	case err != nil:
+		sugar.Errorw("request to API failed", "error", err)
+		return nil, 0, "failed to reach API: " + err.Error()
+	case resp.JSON200 != nil:
+		var next int64
+		if resp.JSON200.NextBefore != nil {
+			next = *resp.JSON200.NextBefore
 		}
+		return resp.JSON200.Rejections, next, ""
+	default:
+		return nil, 0, responseError(resp.HTTPResponse, resp.Body)
 	}
+}
 
-	// Render template
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := dashboardTmpl.Execute(w, data); err != nil {
-		sugar.Errorw("failed to execute template", "error", err)
-		http.Error(w, "internal template error", http.StatusInternalServerError)
+// cachedOrder returns the last fetched version of an order
+func (ws *WebServer) cachedOrder(orderUID string) (etaggedOrder, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	cached, ok := ws.orders[orderUID]
+	return cached, ok
+}
+
+// cacheOrder remembers an order with its ETag, an arbitrary entry is evicted when the cache is full
+func (ws *WebServer) cacheOrder(orderUID string, etag string, order *model.Order) {
+	if etag == "" {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if _, ok := ws.orders[orderUID]; !ok && len(ws.orders) >= maxCachedOrders {
+		for key := range ws.orders {
+			delete(ws.orders, key)
+			break
+		}
+	}
+	ws.orders[orderUID] = etaggedOrder{etag: etag, order: order}
+}
+
+// responseError describes a failed api response for the dashboard
+func responseError(resp *http.Response, body []byte) string {
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), problemContentType) {
+		var p orderclient.Problem
+		if err := json.Unmarshal(body, &p); err == nil {
+			return problemMessage(&p)
+		}
+	}
+	// fallback: show raw body as error
+	return "unexpected API response: " + string(body)
+}
+
+// problemMessage formats problem details for the dashboard
+func problemMessage(p *orderclient.Problem) string {
+	msg := p.Title
+	if p.Detail != nil && *p.Detail != "" {
+		msg += ": " + *p.Detail
+	}
+	if p.RequestId != nil {
+		msg += " (request id " + *p.RequestId + ")"
 	}
+	return msg
 }
@@ -2,13 +2,19 @@ package kafka
 
 import (
 	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/encryption"
+	"MockOrderService/internal/pii"
 	"MockOrderService/internal/service"
+	"MockOrderService/internal/tracing"
 	"MockOrderService/internal/validation"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type consumerClient interface {
@@ -16,16 +22,32 @@ type consumerClient interface {
 	CommitMessages(ctx context.Context, messages ...kafka.Message) error
 }
 
+// RejectionLog keeps rejected messages for operators
+type RejectionLog interface {
+	SaveRejection(ctx context.Context, rejection *model.Rejection) error
+}
+
+// ConsumerMetrics counts consumed messages and rejections by the rules they violated
+type ConsumerMetrics interface {
+	MessageConsumed()
+	MessageRejected(rules []string)
+}
+
 // Consumer represents a Kafka consumer
 type Consumer struct {
 	client      consumerClient
 	service     *service.OrderService
+	rejections  RejectionLog
+	keyring     *encryption.Keyring
+	metrics     ConsumerMetrics
 	sugar       *zap.SugaredLogger
 	errorsCount int
 }
 
-func NewConsumer(client consumerClient, service *service.OrderService, sugar *zap.SugaredLogger) *Consumer {
-	return &Consumer{client: client, service: service, sugar: sugar}
+// NewConsumer creates a consumer, rejections, keyring and metrics are optional: if rejections is set,
+// undecodable and invalid messages are saved to it. With a keyring rejections keep the blind index of the customer id.
+func NewConsumer(client consumerClient, service *service.OrderService, rejections RejectionLog, keyring *encryption.Keyring, metrics ConsumerMetrics, sugar *zap.SugaredLogger) *Consumer {
+	return &Consumer{client: client, service: service, rejections: rejections, keyring: keyring, metrics: metrics, sugar: sugar}
 }
 
 func (c *Consumer) Start(ctx context.Context, stop context.CancelFunc) {
@@ -54,18 +76,37 @@ func (c *Consumer) Start(ctx context.Context, stop context.CancelFunc) {
 	}
 }
 
-func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) error {
+// processMessage continues the trace of the producer, if the message carries one
+func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) (err error) {
+	ctx, span := startProcessSpan(ctx, &msg)
+	defer func() { tracing.End(span, err) }()
+	if c.metrics != nil {
+		c.metrics.MessageConsumed()
+	}
+
 	var order model.Order
-	err := json.Unmarshal(msg.Value, &order)
+	err = json.Unmarshal(msg.Value, &order)
 	if err != nil {
+		c.reject(ctx, msg, &model.Rejection{Reason: model.RejectionInvalidJSON, Error: err.Error()})
 		return fmt.Errorf("failed to unmarshal order: %w", err)
 	}
 	c.sugar.Infow("order consumed", "orderUID", order.OrderUID)
 
+	_, validationSpan := tracing.Tracer().Start(ctx, "validation.ValidateOrder")
 	err = validation.ValidateOrder(&order)
+	tracing.End(validationSpan, err)
 	if err != nil {
 		// edgy case: it's not an error actually, but we can't continue processing
 		c.sugar.Warnw("invalid order", "orderUID", order.OrderUID)
+		// the log is kept in plain text, so it gets neither the customer id nor the quoted personal data
+		rejection := &model.Rejection{OrderUID: order.OrderUID, Reason: model.RejectionValidationFailed}
+		if c.keyring != nil && order.CustomerID != "" {
+			rejection.CustomerIndex = c.keyring.CustomerIndex(order.CustomerID)
+		}
+		for _, p := range validation.Problems(err) {
+			rejection.Problems = append(rejection.Problems, model.RejectionProblem{Field: p.Field, Message: pii.RedactProblem(p.Field, p.Message)})
+		}
+		c.reject(ctx, msg, rejection)
 		return nil
 	}
 	c.sugar.Infow("order is validated", "orderUID", order.OrderUID)
@@ -82,3 +123,44 @@ func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) error
 
 	return nil
 }
+
+// reject saves the rejection of the message, a failure is only logged since the message is skipped either way
+func (c *Consumer) reject(ctx context.Context, msg kafka.Message, rejection *model.Rejection) {
+	if c.metrics != nil {
+		c.metrics.MessageRejected(rejectionRules(rejection))
+	}
+	if c.rejections == nil {
+		return
+	}
+	rejection.At = time.Now()
+	rejection.Topic = msg.Topic
+	rejection.Partition = msg.Partition
+	rejection.Offset = msg.Offset
+	if err := c.rejections.SaveRejection(ctx, rejection); err != nil {
+		c.sugar.Warnw("failed to save rejection", "partition", msg.Partition, "offset", msg.Offset, "error", err)
+	}
+}
+
+// rejectionRules names the rules the message violated: the reason for undecodable messages,
+// otherwise the invalid fields with array indices replaced by "*" like "/items/*/price"
+func rejectionRules(rejection *model.Rejection) []string {
+	if len(rejection.Problems) == 0 {
+		return []string{rejection.Reason}
+	}
+	rules := make([]string, 0, len(rejection.Problems))
+	seen := make(map[string]bool, len(rejection.Problems))
+	for _, p := range rejection.Problems {
+		segments := strings.Split(p.Field, "/")
+		for i, segment := range segments {
+			if _, err := strconv.Atoi(segment); err == nil {
+				segments[i] = "*"
+			}
+		}
+		rule := strings.Join(segments, "/")
+		if !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
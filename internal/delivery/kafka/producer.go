@@ -1,9 +1,12 @@
 package kafka
 
 import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/tracing"
 	"MockOrderService/internal/utils"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
@@ -38,10 +41,14 @@ func (p *Producer) Start(stop context.CancelFunc) {
 			continue
 		}
 
-		err = p.client.WriteMessages(context.Background(), kafka.Message{
+		msg := kafka.Message{
 			Key:   []byte(order.OrderUID),
 			Value: value,
-		})
+		}
+		// every mock order starts its own trace
+		ctx, span := startSendSpan(context.Background(), &msg)
+		err = p.client.WriteMessages(ctx, msg)
+		tracing.End(span, err)
 		if err != nil {
 			p.errorsCount += 1
 			p.sugar.Errorw("failed to write messages", "orderUID", order.OrderUID, "error", err)
@@ -56,3 +63,23 @@ func (p *Producer) Start(stop context.CancelFunc) {
 	}
 	p.sugar.Infow("producer has finished")
 }
+
+// Publish writes a single order to the topic, keyed by orderUID
+func (p *Producer) Publish(ctx context.Context, order *model.Order) error {
+	value, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to marshal order: %w", err)
+	}
+	msg := kafka.Message{
+		Key:   []byte(order.OrderUID),
+		Value: value,
+	}
+	ctx, span := startSendSpan(ctx, &msg)
+	err = p.client.WriteMessages(ctx, msg)
+	tracing.End(span, err)
+	if err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	p.sugar.Infow("order published", "orderUID", order.OrderUID)
+	return nil
+}
@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"MockOrderService/internal/tracing"
+	"context"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"strconv"
+)
+
+// headerCarrier lets the propagator read and write trace context in message headers
+type headerCarrier struct {
+	msg *kafka.Message
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key string, value string) {
+	for i, h := range c.msg.Headers {
+		if h.Key == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// startSendSpan starts a producer span and writes its trace context to the message headers
+func startSendSpan(ctx context.Context, msg *kafka.Message) (context.Context, trace.Span) {
+	ctx, span := tracing.Tracer().Start(ctx, "kafka send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystemKafka, semconv.MessagingOperationTypeSend,
+			semconv.MessagingKafkaMessageKey(string(msg.Key))))
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{msg: msg})
+	return ctx, span
+}
+
+// startProcessSpan starts a consumer span continuing the trace of the producer
+func startProcessSpan(ctx context.Context, msg *kafka.Message) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier{msg: msg})
+	return tracing.Tracer().Start(ctx, "kafka process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(semconv.MessagingSystemKafka, semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(msg.Topic), semconv.MessagingKafkaMessageKey(string(msg.Key)),
+			semconv.MessagingKafkaOffset(int(msg.Offset)), semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition))))
+}
@@ -0,0 +1,74 @@
+package model
+
+import "time"
+
+// Report intervals of order volume
+const (
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+)
+
+// Dimensions orders can be broken down by
+const (
+	DimensionDeliveryService = "delivery_service"
+	DimensionProvider        = "provider"
+	DimensionBank            = "bank"
+	DimensionCity            = "city"
+	DimensionRegion          = "region"
+)
+
+// AnalyticsFilter narrows reports, zero fields don't filter.
+// Reports are built from daily aggregates, so From and To are UTC dates, To is exclusive.
+type AnalyticsFilter struct {
+	From     *time.Time
+	To       *time.Time
+	Currency string
+}
+
+// VolumeRow is the order volume of a day or a week (starting on Monday).
+// Revenue is the sum of payment amounts. Amounts of different currencies are never added up,
+// so every report row belongs to a single currency ("" for orders without a payment).
+type VolumeRow struct {
+	Period   time.Time `json:"period"`
+	Currency string    `json:"currency"`
+	Orders   int64     `json:"orders"`
+	Revenue  int64     `json:"revenue"`
+	Items    int64     `json:"items"`
+}
+
+// BreakdownRow is the order volume of a single value of a dimension, like a delivery service
+type BreakdownRow struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+	Orders   int64  `json:"orders"`
+	Revenue  int64  `json:"revenue"`
+	Items    int64  `json:"items"`
+}
+
+// BasketStats describes an average order
+type BasketStats struct {
+	Currency      string  `json:"currency"`
+	Orders        int64   `json:"orders"`
+	Revenue       int64   `json:"revenue"`
+	AverageAmount float64 `json:"average_amount"`
+	AverageItems  float64 `json:"average_items"`
+}
+
+// TopProduct is a product (nm_id) with its sales, revenue is the sum of total prices of its items
+type TopProduct struct {
+	NmID     int64  `json:"nm_id"`
+	Brand    string `json:"brand"`
+	Currency string `json:"currency"`
+	Items    int64  `json:"items"`
+	Orders   int64  `json:"orders"`
+	Revenue  int64  `json:"revenue"`
+}
+
+// TopBrand is a brand with its sales, Orders counts every order once however many items of the brand it has
+type TopBrand struct {
+	Brand    string `json:"brand"`
+	Currency string `json:"currency"`
+	Items    int64  `json:"items"`
+	Orders   int64  `json:"orders"`
+	Revenue  int64  `json:"revenue"`
+}
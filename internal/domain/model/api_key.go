@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// APIKey is a static api credential. Only the hash of the key is stored.
+type APIKey struct {
+	ID   int32  `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Prefix is the beginning of the key to tell keys apart
+	Prefix    string     `json:"prefix"`
+	KeyHash   string     `json:"-"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,11 @@
+package model
+
+// PartitionLag is how far the consumer group is behind on a partition of the orders topic
+type PartitionLag struct {
+	Partition int `json:"partition"`
+	// Committed is the next offset the group will read, -1 if it hasn't committed yet
+	Committed int64 `json:"committed"`
+	// End is the offset the next produced message will get
+	End int64 `json:"end"`
+	Lag int64 `json:"lag"`
+}
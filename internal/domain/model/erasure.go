@@ -0,0 +1,25 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoCustomerIndex means erasures can't be looked up by customer id, since there is no key to index them with
+var ErrNoCustomerIndex = errors.New("erasures can't be looked up by customer id without an encryption keyfile")
+
+// Erasure is an audit record of anonymised customer data.
+// The customer id itself is not kept, only its keyed blind index to check later whether a customer was erased.
+type Erasure struct {
+	ID int32 `json:"id"`
+	// CustomerHash is empty if there was no encryption keyfile to compute it
+	CustomerHash string `json:"customer_hash"`
+	// Pseudonym is the random customer id the erased orders got
+	Pseudonym   string `json:"pseudonym"`
+	Orders      int    `json:"orders"`
+	RequestedBy string `json:"requested_by"`
+	Reason      string `json:"reason,omitempty"`
+	// SpoolsChecked tells that the spools of all replicas were found empty before erasing
+	SpoolsChecked bool       `json:"spools_checked"`
+	ErasedAt      *time.Time `json:"erased_at,omitempty"`
+}
@@ -0,0 +1,12 @@
+package model
+
+// IdempotentResponse is a stored response for a request made with an Idempotency-Key
+type IdempotentResponse struct {
+	// Fingerprint identifies the request payload, the same key can't be reused for another payload
+	Fingerprint string `json:"fingerprint"`
+	// Pending is true while the first request is still being processed
+	Pending     bool   `json:"pending"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
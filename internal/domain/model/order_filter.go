@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// OrderFilter selects orders for listings and exports, zero fields don't filter
+type OrderFilter struct {
+	// CreatedFrom and CreatedTo limit date_created, CreatedTo is exclusive
+	CreatedFrom     *time.Time
+	CreatedTo       *time.Time
+	CustomerID      string
+	DeliveryService string
+	Locale          string
+	// Phone and Email match deliveries, with encryption regardless of formatting and case
+	Phone string
+	Email string
+}
@@ -0,0 +1,11 @@
+package model
+
+// OrderParts selects which sub-resources of an order are loaded together with it
+type OrderParts struct {
+	Delivery bool
+	Payment  bool
+	Items    bool
+}
+
+// AllOrderParts loads the whole order
+var AllOrderParts = OrderParts{Delivery: true, Payment: true, Items: true}
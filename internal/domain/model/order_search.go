@@ -0,0 +1,29 @@
+package model
+
+// Highlighted parts of search fragments are enclosed in HighlightStart and HighlightStop.
+// They are private use characters, so they can't clash with the text itself.
+const (
+	HighlightStart = "\uE000"
+	HighlightStop  = "\uE001"
+)
+
+// OrderSearch is a full-text search over item names and brands, delivery cities and addresses and track numbers
+type OrderSearch struct {
+	Query string
+	Limit int
+	// Addresses searches delivery addresses too, they are personal data. Encrypted addresses are never searched.
+	Addresses bool
+}
+
+// OrderSearchHit is an order found by a search, hits are sorted by rank, best first
+type OrderSearchHit struct {
+	OrderUID   string
+	Rank       float64
+	Highlights []SearchHighlight
+}
+
+// SearchHighlight is a matched field, like items.name or delivery.city
+type SearchHighlight struct {
+	Field    string
+	Fragment string
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OrderCursor is the position of an order in listings, which are sorted newest first by created_at and order_uid
+type OrderCursor struct {
+	CreatedAt time.Time
+	OrderUID  string
+}
+
+// CursorOf returns the position of the order
+func CursorOf(order *Order) OrderCursor {
+	cursor := OrderCursor{OrderUID: order.OrderUID}
+	if order.CreatedAt != nil {
+		cursor.CreatedAt = *order.CreatedAt
+	}
+	return cursor
+}
+
+// String encodes the cursor for clients, which treat it as opaque: base64 of "<created_at in RFC 3339>|<order_uid>"
+func (c OrderCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.OrderUID))
+}
+
+// ParseOrderCursor decodes a cursor made by OrderCursor.String
+func ParseOrderCursor(cursor string) (*OrderCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, orderUID, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return nil, fmt.Errorf("cursor has no order uid")
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	return &OrderCursor{CreatedAt: t, OrderUID: orderUID}, nil
+}
+
+// OrderStats aggregates orders matching a filter
+type OrderStats struct {
+	Orders int64
+	// FirstDateCreated and LastDateCreated are nil if no order matches
+	FirstDateCreated  *time.Time
+	LastDateCreated   *time.Time
+	ByDeliveryService []DeliveryServiceStats
+	ByCurrency        []CurrencyStats
+}
+
+// DeliveryServiceStats counts orders of a delivery service
+type DeliveryServiceStats struct {
+	DeliveryService string
+	Orders          int64
+}
+
+// CurrencyStats sums payments made in a currency, amounts of different currencies aren't added up
+type CurrencyStats struct {
+	Currency      string
+	Orders        int64
+	Amount        int64
+	AverageAmount float64
+}
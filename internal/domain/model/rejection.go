@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// Reasons a consumed message is rejected
+const (
+	RejectionInvalidJSON      = "invalid_json"
+	RejectionValidationFailed = "validation_failed"
+)
+
+// Rejection is a consumed message which was rejected instead of being stored
+type Rejection struct {
+	// ID is assigned by the rejection log starting with 1, newer rejections have greater ids
+	ID        int64     `json:"id,omitempty"`
+	At        time.Time `json:"at"`
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	// OrderUID is empty if the message couldn't be decoded
+	OrderUID string `json:"order_uid,omitempty"`
+	// CustomerIndex is the blind index of the customer id, the id itself isn't kept.
+	// It's empty without an encryption keyfile, erasures remove the customer's rejections by it.
+	CustomerIndex string `json:"customer_index,omitempty"`
+	Reason        string `json:"reason"`
+	// Error describes messages which couldn't be decoded
+	Error    string             `json:"error,omitempty"`
+	Problems []RejectionProblem `json:"problems,omitempty"`
+}
+
+// RejectionProblem is a failed validation rule, Field is a JSON pointer like "/items/0/price"
+type RejectionProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,56 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// PhoneIndex returns the blind index of a phone number, the same for "+7 (915) 123-45-67" and "89151234567".
+// Empty phones have an empty index.
+func (k *Keyring) PhoneIndex(phone string) string {
+	return k.blindIndex("phone", NormalizePhone(phone))
+}
+
+// EmailIndex returns the blind index of an email, case-insensitive
+func (k *Keyring) EmailIndex(email string) string {
+	return k.blindIndex("email", NormalizeEmail(email))
+}
+
+// NormalizePhone keeps the digits of a phone number, a leading 8 of a Russian number becomes 7: "89151234567" -> "79151234567"
+func NormalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) == 11 && digits[0] == '8' {
+		digits = "7" + digits[1:]
+	}
+	return digits
+}
+
+// NormalizeEmail lowercases an email and trims spaces around it
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// CustomerIndex returns the blind index of a customer id, it identifies erased customers in the erasure log
+func (k *Keyring) CustomerIndex(customerID string) string {
+	return k.blindIndex("customer", customerID)
+}
+
+// blindIndex is the HMAC of a normalized value, kind keeps equal values of different fields apart
+func (k *Keyring) blindIndex(kind string, value string) string {
+	if value == "" {
+		return ""
+	}
+	k.mu.RLock()
+	mac := hmac.New(sha256.New, k.indexKey)
+	k.mu.RUnlock()
+	mac.Write([]byte(kind + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,151 @@
+package encryption
+
+import (
+	"MockOrderService/internal/domain/model"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Envelope is the wrapped data key of an encrypted delivery
+type Envelope struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// SealDelivery returns a copy of the delivery with encrypted name, phone, address and email
+// and the envelope of its new data key. Fields are bound to the order and their names,
+// so a ciphertext copied to another row or field doesn't decrypt.
+func (k *Keyring) SealDelivery(orderUID string, d *model.Delivery) (*model.Delivery, *Envelope, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	env, err := k.wrap(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed := *d
+	for name, field := range deliveryFields(&sealed) {
+		if *field, err = sealField(aead, orderUID, name, *field); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &sealed, env, nil
+}
+
+// OpenDelivery decrypts the fields of a delivery sealed by SealDelivery in place
+func (k *Keyring) OpenDelivery(orderUID string, d *model.Delivery, env *Envelope) error {
+	dataKey, err := k.unwrap(env)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	for name, field := range deliveryFields(d) {
+		if *field, err = openField(aead, orderUID, name, *field); err != nil {
+			return fmt.Errorf("failed to decrypt delivery %s of order %s: %w", name, orderUID, err)
+		}
+	}
+	return nil
+}
+
+// Rewrap wraps the data key of the envelope with the active key, the encrypted fields stay valid
+func (k *Keyring) Rewrap(env *Envelope) (*Envelope, error) {
+	dataKey, err := k.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+	return k.wrap(dataKey)
+}
+
+// deliveryFields are the encrypted fields of a delivery by name
+func deliveryFields(d *model.Delivery) map[string]*string {
+	return map[string]*string{
+		"name":    &d.Name,
+		"phone":   &d.Phone,
+		"address": &d.Address,
+		"email":   &d.Email,
+	}
+}
+
+// wrap encrypts a data key with the active key, the key id is authenticated too
+func (k *Keyring) wrap(dataKey []byte) (*Envelope, error) {
+	id, kek, err := k.kek("")
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(kek, dataKey, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyID: id, WrappedKey: wrapped}, nil
+}
+
+func (k *Keyring) unwrap(env *Envelope) ([]byte, error) {
+	if env == nil || env.KeyID == "" {
+		return nil, errors.New("no encryption key id in envelope")
+	}
+	_, kek, err := k.kek(env.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(kek, env.WrappedKey, []byte(env.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with %q: %w", env.KeyID, err)
+	}
+	return dataKey, nil
+}
+
+// sealField encrypts a non-empty value to base64 of nonce and ciphertext
+func sealField(aead cipher.AEAD, orderUID string, name string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	sealed, err := seal(aead, []byte(value), []byte(orderUID+"/"+name))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openField(aead cipher.AEAD, orderUID string, name string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(aead, sealed, []byte(orderUID+"/"+name))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// seal encrypts with a random nonce prepended to the ciphertext
+func seal(aead cipher.AEAD, plain []byte, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
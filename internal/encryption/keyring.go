@@ -0,0 +1,152 @@
+// Package encryption implements envelope encryption of delivery personal data.
+// Every delivery is encrypted with its own random data key, which is stored wrapped (encrypted)
+// with a key encryption key from the keyfile. Rotating the key encryption key only rewraps data keys.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// keySize is the size of all keys, AES-256 and HMAC-SHA256
+const keySize = 32
+
+// keyfile is the layout of the keyfile, keys are base64 encoded 32 byte values
+type keyfile struct {
+	// ActiveKey is the id of the key new data keys are wrapped with
+	ActiveKey string            `json:"active_key"`
+	Keys      map[string]string `json:"keys"`
+	// IndexKey is the HMAC key of blind indexes, it can't be changed without rebuilding them
+	IndexKey string `json:"index_key"`
+}
+
+// Keyring holds key encryption keys loaded from a keyfile, a stand-in for a KMS
+type Keyring struct {
+	path string
+
+	mu       sync.RWMutex
+	active   string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+	modTime  time.Time
+}
+
+// LoadKeyring reads the keyfile at path
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if _, err := k.load(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload rereads the keyfile if it was modified since the last load and tells if it was.
+// The index key must stay the same, otherwise existing blind indexes would stop matching.
+func (k *Keyring) Reload() (bool, error) {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat keyfile: %w", err)
+	}
+	k.mu.RLock()
+	unchanged := info.ModTime().Equal(k.modTime)
+	k.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	return k.load()
+}
+
+func (k *Keyring) load() (bool, error) {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat keyfile: %w", err)
+	}
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	var file keyfile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("invalid keyfile: %w", err)
+	}
+
+	keys := make(map[string]cipher.AEAD, len(file.Keys))
+	for id, encoded := range file.Keys {
+		if id == "" {
+			return false, errors.New("invalid keyfile: empty key id")
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return false, fmt.Errorf("invalid keyfile: key %q: %w", id, err)
+		}
+		if keys[id], err = newAEAD(key); err != nil {
+			return false, err
+		}
+	}
+	if _, ok := keys[file.ActiveKey]; !ok {
+		return false, fmt.Errorf("invalid keyfile: active key %q is not among the keys", file.ActiveKey)
+	}
+	indexKey, err := decodeKey(file.IndexKey)
+	if err != nil {
+		return false, fmt.Errorf("invalid keyfile: index key: %w", err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.indexKey != nil && !bytes.Equal(k.indexKey, indexKey) {
+		return false, errors.New("invalid keyfile: index key can't be changed")
+	}
+	k.active = file.ActiveKey
+	k.keys = keys
+	k.indexKey = indexKey
+	k.modTime = info.ModTime()
+	return true, nil
+}
+
+// ActiveKeyID returns the id of the key new data keys are wrapped with
+func (k *Keyring) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// kek returns a key encryption key by id, the active one if id is empty
+func (k *Keyring) kek(id string) (string, cipher.AEAD, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if id == "" {
+		id = k.active
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+	return id, aead, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("not base64: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"MockOrderService/internal/domain/model"
+	"encoding/csv"
+	"io"
+)
+
+// csvWriter writes one row per item with order, delivery and payment columns repeated
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (Writer, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	if err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) WriteOrder(order *model.Order) error {
+	record := make([]string, len(columns))
+	return flatRows(order, func(cells []cell) error {
+		for i, c := range cells {
+			record[i] = c.text
+		}
+		return cw.w.Write(record)
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,162 @@
+// Package export writes orders as CSV, NDJSON, JSON or XLSX.
+// Writers are streaming: every order is written as soon as it's passed, nothing is kept in memory.
+package export
+
+import (
+	"MockOrderService/internal/domain/model"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatJSON   = "json"
+	FormatXLSX   = "xlsx"
+)
+
+// Writer writes orders in some format. Close must be called to finish the document.
+type Writer interface {
+	WriteOrder(order *model.Order) error
+	Close() error
+}
+
+// Format describes an export format
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	newWriter   func(w io.Writer) (Writer, error)
+}
+
+var formats = map[string]Format{
+	FormatCSV:    {FormatCSV, "text/csv; charset=utf-8", ".csv", newCSVWriter},
+	FormatNDJSON: {FormatNDJSON, "application/x-ndjson", ".ndjson", newNDJSONWriter},
+	FormatJSON:   {FormatJSON, "application/json", ".json", newJSONWriter},
+	FormatXLSX:   {FormatXLSX, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx", newXLSXWriter},
+}
+
+// LookupFormat returns the format by its name
+func LookupFormat(name string) (Format, error) {
+	f, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("unknown export format %q, expected csv, ndjson, json or xlsx", name)
+	}
+	return f, nil
+}
+
+// NewWriter creates a writer of the format over w
+func (f Format) NewWriter(w io.Writer) (Writer, error) {
+	return f.newWriter(w)
+}
+
+// column is a column of the flat (one row per item) representation used by CSV and XLSX
+type column struct {
+	name string
+	// value is called with non-nil delivery, payment and item
+	value func(o *model.Order, i *model.Item) cell
+}
+
+// cell is a column value, numbers are kept apart so XLSX can store them as numbers
+type cell struct {
+	text    string
+	numeric bool
+}
+
+// textCell keeps spreadsheets from evaluating text as a formula: text starting with
+// =, +, -, @, a tab or a carriage return gets a leading ', item names and addresses come from outside
+func textCell(s string) cell {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		s = "'" + s
+	}
+	return cell{text: s}
+}
+
+func intCell[T int32 | int64](v *T) cell {
+	if v == nil {
+		return cell{}
+	}
+	return cell{text: strconv.FormatInt(int64(*v), 10), numeric: true}
+}
+
+func timeCell(t *time.Time) cell {
+	if t == nil {
+		return cell{}
+	}
+	return cell{text: t.UTC().Format(time.RFC3339)}
+}
+
+// columns of the flat representation: order, delivery, payment and item fields
+var columns = []column{
+	{"order_uid", func(o *model.Order, i *model.Item) cell { return textCell(o.OrderUID) }},
+	{"track_number", func(o *model.Order, i *model.Item) cell { return textCell(o.TrackNumber) }},
+	{"entry", func(o *model.Order, i *model.Item) cell { return textCell(o.Entry) }},
+	{"locale", func(o *model.Order, i *model.Item) cell { return textCell(o.Locale) }},
+	{"customer_id", func(o *model.Order, i *model.Item) cell { return textCell(o.CustomerID) }},
+	{"delivery_service", func(o *model.Order, i *model.Item) cell { return textCell(o.DeliveryService) }},
+	{"shardkey", func(o *model.Order, i *model.Item) cell { return textCell(o.Shardkey) }},
+	{"sm_id", func(o *model.Order, i *model.Item) cell { return intCell(o.SmID) }},
+	{"date_created", func(o *model.Order, i *model.Item) cell { return timeCell(o.DateCreated) }},
+	{"oof_shard", func(o *model.Order, i *model.Item) cell { return textCell(o.OofShard) }},
+
+	{"delivery_name", func(o *model.Order, i *model.Item) cell { return textCell(o.Delivery.Name) }},
+	{"delivery_phone", func(o *model.Order, i *model.Item) cell { return textCell(o.Delivery.Phone) }},
+	{"delivery_zip", func(o *model.Order, i *model.Item) cell { return textCell(o.Delivery.Zip) }},
+	{"delivery_city", func(o *model.Order, i *model.Item) cell { return textCell(o.Delivery.City) }},
+	{"delivery_address", func(o *model.Order, i *model.Item) cell { return textCell(o.Delivery.Address) }},
+	{"delivery_region", func(o *model.Order, i *model.Item) cell { return textCell(o.Delivery.Region) }},
+	{"delivery_email", func(o *model.Order, i *model.Item) cell { return textCell(o.Delivery.Email) }},
+
+	{"payment_transaction_id", func(o *model.Order, i *model.Item) cell { return textCell(o.Payment.TransactionID) }},
+	{"payment_request_id", func(o *model.Order, i *model.Item) cell { return textCell(o.Payment.RequestID) }},
+	{"payment_currency", func(o *model.Order, i *model.Item) cell { return textCell(o.Payment.Currency) }},
+	{"payment_provider", func(o *model.Order, i *model.Item) cell { return textCell(o.Payment.Provider) }},
+	{"payment_amount", func(o *model.Order, i *model.Item) cell { return intCell(o.Payment.Amount) }},
+	{"payment_dt", func(o *model.Order, i *model.Item) cell { return intCell(o.Payment.PaymentDt) }},
+	{"payment_bank", func(o *model.Order, i *model.Item) cell { return textCell(o.Payment.Bank) }},
+	{"payment_delivery_cost", func(o *model.Order, i *model.Item) cell { return intCell(o.Payment.DeliveryCost) }},
+	{"payment_goods_total", func(o *model.Order, i *model.Item) cell { return intCell(o.Payment.GoodsTotal) }},
+	{"payment_custom_fee", func(o *model.Order, i *model.Item) cell { return intCell(o.Payment.CustomFee) }},
+
+	{"item_chrt_id", func(o *model.Order, i *model.Item) cell { return intCell(i.ChrtID) }},
+	{"item_track_number", func(o *model.Order, i *model.Item) cell { return textCell(i.TrackNumber) }},
+	{"item_price", func(o *model.Order, i *model.Item) cell { return intCell(i.Price) }},
+	{"item_rid", func(o *model.Order, i *model.Item) cell { return textCell(i.Rid) }},
+	{"item_name", func(o *model.Order, i *model.Item) cell { return textCell(i.Name) }},
+	{"item_sale", func(o *model.Order, i *model.Item) cell { return intCell(i.Sale) }},
+	{"item_size", func(o *model.Order, i *model.Item) cell { return textCell(i.Size) }},
+	{"item_total_price", func(o *model.Order, i *model.Item) cell { return intCell(i.TotalPrice) }},
+	{"item_nm_id", func(o *model.Order, i *model.Item) cell { return intCell(i.NmID) }},
+	{"item_brand", func(o *model.Order, i *model.Item) cell { return textCell(i.Brand) }},
+	{"item_status", func(o *model.Order, i *model.Item) cell { return intCell(i.Status) }},
+}
+
+// flatRows calls fn with the cells of every item row of the order.
+// An order without items gives a single row with empty item columns.
+func flatRows(order *model.Order, fn func(cells []cell) error) error {
+	flat := *order
+	if flat.Delivery == nil {
+		flat.Delivery = &model.Delivery{}
+	}
+	if flat.Payment == nil {
+		flat.Payment = &model.Payment{}
+	}
+	items := order.Items
+	if len(items) == 0 {
+		items = []*model.Item{{}}
+	}
+
+	cells := make([]cell, len(columns))
+	for _, item := range items {
+		for i, c := range columns {
+			cells[i] = c.value(&flat, item)
+		}
+		if err := fn(cells); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"MockOrderService/internal/domain/model"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// jsonWriter writes orders as a JSON array, or as the "orders" array of an object with extra fields.
+// Nothing is written before the first order or Close, so a failed query can still be reported.
+type jsonWriter struct {
+	w       io.Writer
+	fields  map[string]any
+	started bool
+	count   int
+}
+
+func newJSONWriter(w io.Writer) (Writer, error) {
+	return &jsonWriter{w: w}, nil
+}
+
+// NewJSONArchiveWriter writes a JSON object with the given fields and every order in its "orders" array
+func NewJSONArchiveWriter(w io.Writer, fields map[string]any) Writer {
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	return &jsonWriter{w: w, fields: fields}
+}
+
+func (jw *jsonWriter) start() error {
+	if jw.started {
+		return nil
+	}
+	jw.started = true
+	if jw.fields == nil {
+		_, err := io.WriteString(jw.w, "[")
+		return err
+	}
+	head, err := json.Marshal(jw.fields)
+	if err != nil {
+		return err
+	}
+	// the object is reopened to append the orders array
+	head = bytes.TrimSuffix(head, []byte("}"))
+	if len(jw.fields) > 0 {
+		head = append(head, ',')
+	}
+	_, err = jw.w.Write(append(head, `"orders":[`...))
+	return err
+}
+
+func (jw *jsonWriter) WriteOrder(order *model.Order) error {
+	if err := jw.start(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	if jw.count > 0 {
+		data = append([]byte{','}, data...)
+	}
+	jw.count++
+	_, err = jw.w.Write(data)
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	if err := jw.start(); err != nil {
+		return err
+	}
+	end := "]\n"
+	if jw.fields != nil {
+		end = "]}\n"
+	}
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
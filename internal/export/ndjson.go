@@ -0,0 +1,24 @@
+package export
+
+import (
+	"MockOrderService/internal/domain/model"
+	"encoding/json"
+	"io"
+)
+
+// ndjsonWriter writes every order as a JSON object on its own line
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) (Writer, error) {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+}
+
+func (nw *ndjsonWriter) WriteOrder(order *model.Order) error {
+	return nw.enc.Encode(order)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
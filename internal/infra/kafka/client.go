@@ -1,14 +1,22 @@
 package kafka
 
 import (
+	"MockOrderService/internal/domain/model"
 	"context"
+	"fmt"
 	"github.com/segmentio/kafka-go"
+	"sort"
+	"time"
 )
 
 // Client represents a Kafka client
 type Client struct {
 	reader *kafka.Reader
 	writer *kafka.Writer
+	// admin reads offsets of the consumer group
+	admin   *kafka.Client
+	groupID string
+	topic   string
 }
 
 func NewClient(broker string, groupID string, topic string) *Client {
@@ -24,6 +32,9 @@ func NewClient(broker string, groupID string, topic string) *Client {
 			Topic:    topic,
 			Balancer: &kafka.LeastBytes{},
 		},
+		admin:   &kafka.Client{Addr: kafka.TCP(broker), Timeout: 5 * time.Second},
+		groupID: groupID,
+		topic:   topic,
 	}
 }
 
@@ -39,6 +50,76 @@ func (c *Client) WriteMessages(ctx context.Context, messages ...kafka.Message) e
 	return c.writer.WriteMessages(ctx, messages...)
 }
 
+// ConsumerLag returns how far the consumer group is behind on every partition of the topic.
+// Partitions the group hasn't committed to yet lag by all of their retained messages.
+func (c *Client) ConsumerLag(ctx context.Context) ([]model.PartitionLag, error) {
+	meta, err := c.admin.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{c.topic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get topic metadata: %w", err)
+	}
+	var partitions []int
+	for _, topic := range meta.Topics {
+		if topic.Name != c.topic {
+			continue
+		}
+		if topic.Error != nil {
+			return nil, fmt.Errorf("failed to get topic metadata: %w", topic.Error)
+		}
+		for _, p := range topic.Partitions {
+			partitions = append(partitions, p.ID)
+		}
+	}
+	sort.Ints(partitions)
+
+	committed, err := c.admin.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: c.groupID,
+		Topics:  map[string][]int{c.topic: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	if committed.Error != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", committed.Error)
+	}
+	requests := make([]kafka.OffsetRequest, 0, 2*len(partitions))
+	for _, p := range partitions {
+		requests = append(requests, kafka.FirstOffsetOf(p), kafka.LastOffsetOf(p))
+	}
+	offsets, err := c.admin.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{c.topic: requests}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	commits := make(map[int]int64, len(partitions))
+	for _, p := range committed.Topics[c.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to fetch committed offset of partition %d: %w", p.Partition, p.Error)
+		}
+		commits[p.Partition] = p.CommittedOffset
+	}
+	ranges := make(map[int]kafka.PartitionOffsets, len(partitions))
+	for _, p := range offsets.Topics[c.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets of partition %d: %w", p.Partition, p.Error)
+		}
+		ranges[p.Partition] = p
+	}
+
+	lags := make([]model.PartitionLag, 0, len(partitions))
+	for _, p := range partitions {
+		lag := model.PartitionLag{Partition: p, Committed: -1, End: ranges[p].LastOffset}
+		if offset, ok := commits[p]; ok && offset >= 0 {
+			lag.Committed = offset
+			lag.Lag = lag.End - offset
+		} else {
+			lag.Lag = lag.End - ranges[p].FirstOffset
+		}
+		lag.Lag = max(lag.Lag, 0)
+		lags = append(lags, lag)
+	}
+	return lags, nil
+}
+
 func (c *Client) Close() error {
 	c.reader.Close()
 	return c.writer.Close()
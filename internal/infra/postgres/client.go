@@ -20,7 +20,13 @@ func NewClient(cfg *config.Config, ctx context.Context) (*Client, error) {
 	dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	pool, err := pgxpool.New(dbCtx, dsn)
+	poolCfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pool config: %w", err)
+	}
+	poolCfg.ConnConfig.Tracer = queryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(dbCtx, poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pool: %w", err)
 
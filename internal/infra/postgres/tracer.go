@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"MockOrderService/internal/tracing"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// queryTracer records a span for every statement and batch sent within a trace.
+// Statements outside of traces (health checks, background jobs) aren't recorded.
+// Query arguments aren't recorded either, they may hold personal data.
+type queryTracer struct{}
+
+// querySpanKey marks spans started by queryTracer, so the end hooks never end a span of the caller
+type querySpanKey struct{}
+
+// startSpan starts a client span if ctx belongs to a trace
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	ctx, span := tracing.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+func spanFrom(ctx context.Context) trace.Span {
+	span, _ := ctx.Value(querySpanKey{}).(trace.Span)
+	return span
+}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := operationName(data.SQL)
+	return startSpan(ctx, "postgres "+operation,
+		semconv.DBSystemNamePostgreSQL, semconv.DBOperationName(operation), semconv.DBQueryText(data.SQL))
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if span := spanFrom(ctx); span != nil {
+		span.SetAttributes(attribute.Int64("db.response.rows_affected", data.CommandTag.RowsAffected()))
+		tracing.End(span, data.Err)
+	}
+}
+
+func (queryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	return startSpan(ctx, "postgres batch",
+		semconv.DBSystemNamePostgreSQL, semconv.DBOperationName("BATCH"), attribute.Int("db.operation.batch.size", data.Batch.Len()))
+}
+
+// TraceBatchQuery is called once a statement of the batch is done, statements are recorded as span events
+func (queryTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	attrs := []attribute.KeyValue{semconv.DBQueryText(data.SQL)}
+	if data.Err != nil {
+		attrs = append(attrs, attribute.String("error", data.Err.Error()))
+	}
+	if span := spanFrom(ctx); span != nil {
+		span.AddEvent("query", trace.WithAttributes(attrs...))
+	}
+}
+
+func (queryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	if span := spanFrom(ctx); span != nil {
+		tracing.End(span, data.Err)
+	}
+}
+
+// operationName returns the first keyword of a statement, e.g. SELECT
+func operationName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
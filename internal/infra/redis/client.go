@@ -3,34 +3,103 @@ package redis
 import (
 	"MockOrderService/config"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"time"
 )
 
-// Client represents a Redis client
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// Client represents a Redis client.
+// Client is a redis.UniversalClient, so it may be a single node, a sentinel-backed failover client or a cluster client.
 type Client struct {
-	Client *redis.Client
+	Client redis.UniversalClient
 }
 
-// NewClient creates a new Redis client
+// NewClient creates a new Redis client for the topology selected by cfg.RedisMode
 func NewClient(cfg *config.Config, ctx context.Context) (*Client, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisHost,
-		Password: cfg.RedisPassword,
-		DB:       0,
-	})
+	client, err := newUniversalClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(timeoutCtx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis (%s mode): %w", cfg.RedisMode, err)
 	}
 
+	client.AddHook(tracingHook{})
 	return &Client{Client: client}, nil
 }
 
+// newUniversalClient builds client options for standalone, sentinel or cluster mode
+func newUniversalClient(cfg *config.Config) (redis.UniversalClient, error) {
+	var tlsConfig *tls.Config
+	if cfg.RedisTLS {
+		tlsConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cfg.RedisTLSSkipVerify,
+		}
+	}
+
+	switch cfg.RedisMode {
+	case ModeStandalone, "":
+		return redis.NewClient(&redis.Options{
+			Addr:         cfg.RedisHost,
+			Username:     cfg.RedisUsername,
+			Password:     cfg.RedisPassword,
+			DB:           cfg.RedisDB,
+			TLSConfig:    tlsConfig,
+			PoolSize:     cfg.RedisPoolSize,
+			MinIdleConns: cfg.RedisMinIdleConns,
+		}), nil
+	case ModeSentinel:
+		if cfg.RedisSentinelMasterName == "" {
+			return nil, fmt.Errorf("sentinel mode requires REDIS_SENTINEL_MASTER")
+		}
+		if len(cfg.RedisSentinelAddrs) == 0 {
+			return nil, fmt.Errorf("sentinel mode requires REDIS_SENTINEL_ADDRS")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.RedisSentinelMasterName,
+			SentinelAddrs:    cfg.RedisSentinelAddrs,
+			SentinelPassword: cfg.RedisSentinelPassword,
+			Username:         cfg.RedisUsername,
+			Password:         cfg.RedisPassword,
+			DB:               cfg.RedisDB,
+			TLSConfig:        tlsConfig,
+			PoolSize:         cfg.RedisPoolSize,
+			MinIdleConns:     cfg.RedisMinIdleConns,
+		}), nil
+	case ModeCluster:
+		if len(cfg.RedisClusterAddrs) == 0 {
+			return nil, fmt.Errorf("cluster mode requires REDIS_CLUSTER_ADDRS")
+		}
+		// cluster doesn't support database selection, only DB 0 exists
+		if cfg.RedisDB != 0 {
+			return nil, fmt.Errorf("cluster mode doesn't support REDIS_DB=%d", cfg.RedisDB)
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.RedisClusterAddrs,
+			Username:     cfg.RedisUsername,
+			Password:     cfg.RedisPassword,
+			TLSConfig:    tlsConfig,
+			PoolSize:     cfg.RedisPoolSize,
+			MinIdleConns: cfg.RedisMinIdleConns,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown REDIS_MODE: %q", cfg.RedisMode)
+	}
+}
+
 // Close closes the connection with Redis
 func (c *Client) Close() error {
 	return c.Client.Close()
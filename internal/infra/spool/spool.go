@@ -0,0 +1,352 @@
+package spool
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	logFileName        = "spool.wal"
+	checkpointFileName = "spool.checkpoint"
+	// quarantineFileName keeps corrupt records for manual inspection, they are skipped by replay
+	quarantineFileName = "spool.quarantine"
+	// idFileName names the spool, the name lives as long as the spooled records
+	idFileName = "spool.id"
+
+	// record header: payload length + crc32 of the payload
+	headerSize = 8
+	// guard against reading garbage as a huge length
+	maxRecordSize = 16 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errChecksum means the record is complete but its payload is damaged, so it can be skipped
+var errChecksum = errors.New("record checksum mismatch")
+
+// Spool is a durable append-only local log of records (write-ahead log).
+// Every Append is fsynced before returning, Replay hands records back in the order they were appended
+// and moves a checkpoint forward, so records are never lost or replayed out of order after a restart.
+type Spool struct {
+	sugar *zap.SugaredLogger
+	// replayMu serializes replays, mu guards the log and is not held while records are handed out
+	replayMu sync.Mutex
+	mu       sync.Mutex
+	dir      string
+	id       string
+	file     *os.File
+	offset   int64 // position of the first record that wasn't replayed yet
+	size     int64 // position right after the last complete record
+	pending  int
+}
+
+// Open opens (or creates) a spool in dir.
+// A torn record at the end of the log (e.g. after a crash during a write) is truncated,
+// damaged records in the middle are kept and quarantined by Replay.
+func Open(sugar *zap.SugaredLogger, dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool log: %w", err)
+	}
+
+	s := &Spool{sugar: sugar, dir: dir, file: file}
+	if s.id, err = s.readID(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if s.offset, err = s.readCheckpoint(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err = s.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append writes a record to the end of the log and fsyncs it
+func (s *Spool) Append(data []byte) error {
+	if len(data) > maxRecordSize {
+		return fmt.Errorf("spool record is too large: %d bytes", len(data))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(data, crcTable))
+	copy(buf[headerSize:], data)
+
+	if _, err := s.file.WriteAt(buf, s.size); err != nil {
+		return fmt.Errorf("failed to write spool record: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to fsync spool: %w", err)
+	}
+	s.size += int64(len(buf))
+	s.pending++
+	return nil
+}
+
+// ID returns the name of the spool, it's generated when the spool dir is created and survives restarts
+func (s *Spool) ID() string {
+	return s.id
+}
+
+// Pending returns the amount of records that weren't replayed yet
+func (s *Spool) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Replay calls fn for the records pending when it's called, in append order.
+// It stops at the first error returned by fn, that record stays pending and will be replayed next time.
+// Appends aren't blocked while fn runs, new records go after the replayed ones and wait for the next replay.
+// A damaged record is moved to the quarantine file and logged instead of stopping the replay.
+// Returns the amount of replayed records.
+func (s *Spool) Replay(ctx context.Context, fn func(data []byte) error) (int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	left := s.pending
+	s.mu.Unlock()
+
+	replayed := 0
+	for ; left > 0; left-- {
+		if err := ctx.Err(); err != nil {
+			return replayed, err
+		}
+		s.mu.Lock()
+		offset, size, pending := s.offset, s.size, s.pending
+		s.mu.Unlock()
+
+		// records before size are complete, so they can be read while appends write after them
+		data, err := readRecord(io.NewSectionReader(s.file, offset, size-offset))
+		if errors.Is(err, errChecksum) {
+			if err = s.quarantine(offset, int64(headerSize+len(data)), 1, err); err != nil {
+				return replayed, err
+			}
+			continue
+		}
+		if err != nil {
+			// the header is damaged, there's no telling where the next record starts
+			if err = s.quarantine(offset, size-offset, pending, err); err != nil {
+				return replayed, err
+			}
+			break
+		}
+
+		if err = fn(data); err != nil {
+			return replayed, err
+		}
+		if err = s.advance(offset+int64(headerSize+len(data)), 1); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending > 0 {
+		return replayed, nil
+	}
+	// everything is replayed, start over with an empty log. The checkpoint is reset first:
+	// a crash before the truncation replays the records again, which is harmless, while a checkpoint
+	// beyond the end of the log wouldn't let the spool open.
+	if err := s.writeCheckpoint(0); err != nil {
+		return replayed, err
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return replayed, fmt.Errorf("failed to truncate spool: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return replayed, fmt.Errorf("failed to fsync spool: %w", err)
+	}
+	s.offset, s.size = 0, 0
+	return replayed, nil
+}
+
+// advance moves the checkpoint to offset past the given amount of records
+func (s *Spool) advance(offset int64, records int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writeCheckpoint(offset); err != nil {
+		return err
+	}
+	s.offset = offset
+	s.pending -= records
+	return nil
+}
+
+// quarantine copies length bytes of the log at offset, holding the given amount of records,
+// to the quarantine file and skips them
+func (s *Spool) quarantine(offset int64, length int64, records int, cause error) error {
+	data := make([]byte, length)
+	if _, err := s.file.ReadAt(data, offset); err != nil {
+		return fmt.Errorf("failed to read damaged spool record: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(s.dir, quarantineFileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open spool quarantine: %w", err)
+	}
+	defer file.Close()
+	if _, err = file.Write(data); err != nil {
+		return fmt.Errorf("failed to write spool quarantine: %w", err)
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("failed to fsync spool quarantine: %w", err)
+	}
+
+	s.sugar.Errorw("SPOOL: damaged records moved to quarantine", "error", cause,
+		"offset", offset, "bytes", length, "records", records, "file", file.Name())
+	return s.advance(offset+length, records)
+}
+
+// Close closes the log file
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// recover counts complete records after the checkpoint and cuts off a torn tail.
+// Damaged records followed by intact ones are counted, Replay quarantines them.
+func (s *Spool) recover() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat spool log: %w", err)
+	}
+	if s.offset > info.Size() {
+		return fmt.Errorf("spool checkpoint %d is beyond log size %d", s.offset, info.Size())
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.offset, info.Size()-s.offset))
+	pos, end := s.offset, s.offset
+	records := 0
+	for {
+		data, err := readRecord(reader)
+		if err != nil && !errors.Is(err, errChecksum) {
+			break
+		}
+		pos += int64(headerSize + len(data))
+		records++
+		// a damaged last record is a torn write, not a damaged one
+		if err == nil {
+			end = pos
+			s.pending = records
+		}
+	}
+	pos = end
+	if pos != info.Size() {
+		if err = s.file.Truncate(pos); err != nil {
+			return fmt.Errorf("failed to truncate torn spool record: %w", err)
+		}
+		if err = s.file.Sync(); err != nil {
+			return fmt.Errorf("failed to fsync spool: %w", err)
+		}
+	}
+	s.size = pos
+	return nil
+}
+
+// readID reads the name of the spool, a new spool gets the host name and a random suffix
+func (s *Spool) readID() (string, error) {
+	path := filepath.Join(s.dir, idFileName)
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		return strings.TrimSpace(string(raw)), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read spool id: %w", err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "spool"
+	}
+	var b [4]byte
+	if _, err = rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate spool id: %w", err)
+	}
+	id := host + "-" + hex.EncodeToString(b[:])
+	if err = os.WriteFile(path, []byte(id+"\n"), 0o640); err != nil {
+		return "", fmt.Errorf("failed to write spool id: %w", err)
+	}
+	return id, nil
+}
+
+func (s *Spool) readCheckpoint() (int64, error) {
+	raw, err := os.ReadFile(filepath.Join(s.dir, checkpointFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spool checkpoint: %w", err)
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupted spool checkpoint: %w", err)
+	}
+	return offset, nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint file
+func (s *Spool) writeCheckpoint(offset int64) error {
+	path := filepath.Join(s.dir, checkpointFileName)
+	tmp, err := os.CreateTemp(s.dir, checkpointFileName+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write spool checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(strconv.FormatInt(offset, 10)); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write spool checkpoint: %w", err)
+	}
+	return nil
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("invalid record size %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return data, errChecksum
+	}
+	return data, nil
+}
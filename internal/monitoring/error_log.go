@@ -0,0 +1,117 @@
+package monitoring
+
+import (
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"time"
+)
+
+// LoggedError is an entry logged at error level or above
+type LoggedError struct {
+	At      time.Time `json:"at"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	// Error is the "error" field of the entry, if it has one
+	Error  string `json:"error,omitempty"`
+	Caller string `json:"caller,omitempty"`
+}
+
+// ErrorLog is a zap core which keeps the latest errors for the operations page,
+// it's teed with the core writing the log
+type ErrorLog struct {
+	ring *errorRing
+	// err is the "error" field added with With
+	err string
+}
+
+type errorRing struct {
+	mu      sync.Mutex
+	entries []LoggedError
+	next    int
+	full    bool
+}
+
+// NewErrorLog creates a log which keeps the latest size errors
+func NewErrorLog(size int) *ErrorLog {
+	return &ErrorLog{ring: &errorRing{entries: make([]LoggedError, size)}}
+}
+
+// Recent returns the kept errors, newest first
+func (l *ErrorLog) Recent() []LoggedError {
+	r := l.ring
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+	recent := make([]LoggedError, 0, n)
+	for i := 1; i <= n; i++ {
+		recent = append(recent, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return recent
+}
+
+func (l *ErrorLog) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+func (l *ErrorLog) With(fields []zapcore.Field) zapcore.Core {
+	clone := *l
+	if err, ok := errorField(fields); ok {
+		clone.err = err
+	}
+	return &clone
+}
+
+func (l *ErrorLog) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if l.Enabled(entry.Level) {
+		return checked.AddCore(entry, l)
+	}
+	return checked
+}
+
+func (l *ErrorLog) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	logged := LoggedError{At: entry.Time, Level: entry.Level.String(), Message: entry.Message, Error: l.err}
+	if err, ok := errorField(fields); ok {
+		logged.Error = err
+	}
+	if entry.Caller.Defined {
+		logged.Caller = entry.Caller.TrimmedPath()
+	}
+
+	r := l.ring
+	if len(r.entries) == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = logged
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+	return nil
+}
+
+func (l *ErrorLog) Sync() error {
+	return nil
+}
+
+// errorField returns the value of the "error" field, sugared loggers add errors as error fields
+func errorField(fields []zapcore.Field) (string, bool) {
+	for _, f := range fields {
+		if f.Key != "error" && f.Key != "err" {
+			continue
+		}
+		switch f.Type {
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				return err.Error(), true
+			}
+		case zapcore.StringType:
+			return f.String, true
+		}
+	}
+	return "", false
+}
@@ -18,16 +18,19 @@ type HealthChecker struct {
 	interval    time.Duration
 	sugar       *zap.SugaredLogger
 	stop        context.CancelFunc
+	// dbOptional means the service can run without db (degraded mode), so db failures aren't fatal
+	dbOptional bool
 }
 
 // NewHealthChecker creates a new health checker
-func NewHealthChecker(dbClient HealthCheckable, cacheClient HealthCheckable, interval time.Duration, logger *zap.SugaredLogger, cancelFunc context.CancelFunc) *HealthChecker {
+func NewHealthChecker(dbClient HealthCheckable, cacheClient HealthCheckable, interval time.Duration, logger *zap.SugaredLogger, cancelFunc context.CancelFunc, dbOptional bool) *HealthChecker {
 	return &HealthChecker{
 		dbClient:    dbClient,
 		cacheClient: cacheClient,
 		interval:    interval,
 		sugar:       logger,
 		stop:        cancelFunc,
+		dbOptional:  dbOptional,
 	}
 }
 
@@ -56,7 +59,10 @@ func (h *HealthChecker) Start(ctx context.Context) {
 func (h *HealthChecker) checkHealth(ctx context.Context) error {
 	// Проверка базы данных
 	if err := h.dbClient.Ping(ctx); err != nil {
-		return fmt.Errorf("db healthcheck failed: %w", err)
+		if !h.dbOptional {
+			return fmt.Errorf("db healthcheck failed: %w", err)
+		}
+		h.sugar.Warnw("db healthcheck failed, running in degraded mode", "error", err)
 	}
 
 	// Проверка кэша
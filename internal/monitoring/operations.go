@@ -0,0 +1,121 @@
+package monitoring
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"sync"
+	"time"
+)
+
+// probeTimeout limits a single health check of the operations snapshot
+const probeTimeout = 3 * time.Second
+
+// Names of the checked components
+const (
+	ComponentDB    = "db"
+	ComponentRedis = "redis"
+	ComponentKafka = "kafka"
+)
+
+// LagReader reads the lag of the consumer group, a successful read also means kafka is healthy
+type LagReader interface {
+	ConsumerLag(ctx context.Context) ([]model.PartitionLag, error)
+}
+
+// Operations collects the live state of the pipeline for the operations page
+type Operations struct {
+	dbClient    HealthCheckable
+	cacheClient HealthCheckable
+	kafka       LagReader
+	pipeline    *PipelineMetrics
+	errors      *ErrorLog
+}
+
+// OperationsSnapshot is the state of the pipeline at a moment.
+// Rates and errors are of this instance, the lag is of the whole consumer group.
+type OperationsSnapshot struct {
+	At         time.Time         `json:"at"`
+	Components []ComponentHealth `json:"components"`
+	// Lag is empty if kafka is unavailable
+	Lag          []model.PartitionLag `json:"lag"`
+	TotalLag     int64                `json:"total_lag"`
+	Pipeline     PipelineStats        `json:"pipeline"`
+	RecentErrors []LoggedError        `json:"recent_errors"`
+}
+
+// ComponentHealth is the result of a health check
+type ComponentHealth struct {
+	Name      string  `json:"name"`
+	Healthy   bool    `json:"healthy"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// NewOperations creates a collector, errors is optional
+func NewOperations(dbClient HealthCheckable, cacheClient HealthCheckable, kafka LagReader, pipeline *PipelineMetrics, errors *ErrorLog) *Operations {
+	return &Operations{
+		dbClient:    dbClient,
+		cacheClient: cacheClient,
+		kafka:       kafka,
+		pipeline:    pipeline,
+		errors:      errors,
+	}
+}
+
+// Snapshot checks db, redis and kafka concurrently and returns them with the pipeline metrics
+func (o *Operations) Snapshot(ctx context.Context) *OperationsSnapshot {
+	snapshot := &OperationsSnapshot{
+		At:           time.Now(),
+		Components:   make([]ComponentHealth, 3),
+		Lag:          []model.PartitionLag{},
+		RecentErrors: []LoggedError{},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		snapshot.Components[0] = probe(ctx, ComponentDB, o.dbClient.Ping)
+	}()
+	go func() {
+		defer wg.Done()
+		snapshot.Components[1] = probe(ctx, ComponentRedis, o.cacheClient.Ping)
+	}()
+	go func() {
+		defer wg.Done()
+		snapshot.Components[2] = probe(ctx, ComponentKafka, func(ctx context.Context) error {
+			lag, err := o.kafka.ConsumerLag(ctx)
+			if err == nil {
+				snapshot.Lag = lag
+			}
+			return err
+		})
+	}()
+	wg.Wait()
+
+	for _, p := range snapshot.Lag {
+		snapshot.TotalLag += p.Lag
+	}
+	snapshot.Pipeline = o.pipeline.Stats()
+	if o.errors != nil {
+		snapshot.RecentErrors = o.errors.Recent()
+	}
+	return snapshot
+}
+
+// probe runs a health check with its own timeout and measures its latency
+func probe(ctx context.Context, name string, check func(ctx context.Context) error) ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	err := check(ctx)
+	health := ComponentHealth{
+		Name:      name,
+		Healthy:   err == nil,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		health.Error = err.Error()
+	}
+	return health
+}
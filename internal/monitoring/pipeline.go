@@ -0,0 +1,177 @@
+package monitoring
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricsWindow is the amount of seconds rates are computed over
+const metricsWindow = 60
+
+// secondBucket holds the counters of a single second, it's reused a minute later
+type secondBucket struct {
+	second      int64
+	consumed    int64
+	rejected    int64
+	rules       map[string]int64
+	cacheHits   int64
+	cacheMisses int64
+}
+
+// PipelineMetrics counts consumed messages, rejections by validation rule and cache lookups
+// per second of the last minute, along with totals since start
+type PipelineMetrics struct {
+	mu      sync.Mutex
+	started time.Time
+	buckets [metricsWindow]secondBucket
+
+	consumed    int64
+	rejected    int64
+	rules       map[string]int64
+	cacheHits   int64
+	cacheMisses int64
+}
+
+// PipelineStats is a snapshot of the pipeline metrics, rates are computed over the last minute
+type PipelineStats struct {
+	WindowSeconds int `json:"window_seconds"`
+	// ConsumedPerSecond is the amount of consumed messages per second of the window, oldest first
+	ConsumedPerSecond []int64 `json:"consumed_per_second"`
+	MessagesPerSecond float64 `json:"messages_per_second"`
+	// RejectionRate is the share of consumed messages which were rejected
+	RejectionRate float64 `json:"rejection_rate"`
+	ConsumedTotal int64   `json:"consumed_total"`
+	RejectedTotal int64   `json:"rejected_total"`
+	// Rules are the rejection rules seen since start, the most violated first
+	Rules       []RuleStats `json:"rules"`
+	CacheHits   int64       `json:"cache_hits"`
+	CacheMisses int64       `json:"cache_misses"`
+	// CacheHitRatio is nil if there were no lookups in the window
+	CacheHitRatio *float64 `json:"cache_hit_ratio"`
+}
+
+// RuleStats tells how often messages were rejected because of a rule,
+// a rule is "invalid_json" or a validated field like "/items/*/price"
+type RuleStats struct {
+	Rule string `json:"rule"`
+	// Rejected is the amount of messages rejected by the rule in the window
+	Rejected int64 `json:"rejected"`
+	// Rate is the share of messages consumed in the window which were rejected by the rule
+	Rate  float64 `json:"rate"`
+	Total int64   `json:"total"`
+}
+
+// NewPipelineMetrics creates empty metrics
+func NewPipelineMetrics() *PipelineMetrics {
+	return &PipelineMetrics{started: time.Now(), rules: make(map[string]int64)}
+}
+
+// MessageConsumed counts a message read from kafka, rejected ones included
+func (m *PipelineMetrics) MessageConsumed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bucket(time.Now()).consumed++
+	m.consumed++
+}
+
+// MessageRejected counts a rejected message once for each of the rules it violated
+func (m *PipelineMetrics) MessageRejected(rules []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.bucket(time.Now())
+	b.rejected++
+	m.rejected++
+	for _, rule := range rules {
+		if b.rules == nil {
+			b.rules = make(map[string]int64)
+		}
+		b.rules[rule]++
+		m.rules[rule]++
+	}
+}
+
+// CacheLookups counts cache hits and misses of order reads
+func (m *PipelineMetrics) CacheLookups(hits, misses int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.bucket(time.Now())
+	b.cacheHits += int64(hits)
+	b.cacheMisses += int64(misses)
+	m.cacheHits += int64(hits)
+	m.cacheMisses += int64(misses)
+}
+
+// bucket returns the bucket of the second, resetting it if it was left from a previous minute. m.mu must be held.
+func (m *PipelineMetrics) bucket(now time.Time) *secondBucket {
+	second := now.Unix()
+	b := &m.buckets[second%metricsWindow]
+	if b.second != second {
+		*b = secondBucket{second: second}
+	}
+	return b
+}
+
+// Stats returns the metrics of the last minute
+func (m *PipelineMetrics) Stats() PipelineStats {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := PipelineStats{
+		WindowSeconds:     metricsWindow,
+		ConsumedPerSecond: make([]int64, metricsWindow),
+		ConsumedTotal:     m.consumed,
+		RejectedTotal:     m.rejected,
+		Rules:             make([]RuleStats, 0, len(m.rules)),
+	}
+	var consumed, rejected int64
+	windowRules := make(map[string]int64)
+	// the current second is still being counted, so the window ends with the previous one
+	last := now.Unix() - 1
+	for i := range metricsWindow {
+		second := last - metricsWindow + 1 + int64(i)
+		b := &m.buckets[second%metricsWindow]
+		if b.second != second {
+			continue
+		}
+		stats.ConsumedPerSecond[i] = b.consumed
+		consumed += b.consumed
+		rejected += b.rejected
+		stats.CacheHits += b.cacheHits
+		stats.CacheMisses += b.cacheMisses
+		for rule, n := range b.rules {
+			windowRules[rule] += n
+		}
+	}
+
+	// right after start the window is shorter than a minute
+	if seconds := min(metricsWindow, last-m.started.Unix()+1); seconds > 0 {
+		stats.MessagesPerSecond = float64(consumed) / float64(seconds)
+	}
+	if consumed > 0 {
+		stats.RejectionRate = float64(rejected) / float64(consumed)
+	}
+	for rule, total := range m.rules {
+		rs := RuleStats{Rule: rule, Rejected: windowRules[rule], Total: total}
+		if consumed > 0 {
+			rs.Rate = float64(rs.Rejected) / float64(consumed)
+		}
+		stats.Rules = append(stats.Rules, rs)
+	}
+	sort.Slice(stats.Rules, func(i, j int) bool {
+		a, b := stats.Rules[i], stats.Rules[j]
+		if a.Rejected != b.Rejected {
+			return a.Rejected > b.Rejected
+		}
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Rule < b.Rule
+	})
+	if lookups := stats.CacheHits + stats.CacheMisses; lookups > 0 {
+		ratio := float64(stats.CacheHits) / float64(lookups)
+		stats.CacheHitRatio = &ratio
+	}
+	return stats
+}
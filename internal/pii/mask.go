@@ -0,0 +1,122 @@
+// Package pii masks personal data of orders for callers which may not see it verbatim
+package pii
+
+import (
+	"MockOrderService/internal/domain/model"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// redacted replaces values which are hidden completely
+const redacted = "***"
+
+// personalFields are validation fields of personal data, messages about them quote the values
+var personalFields = map[string]bool{
+	"/delivery/name":    true,
+	"/delivery/phone":   true,
+	"/delivery/email":   true,
+	"/delivery/zip":     true,
+	"/delivery/address": true,
+}
+
+// quotedValue matches Go-quoted strings, like values in validation messages
+var quotedValue = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// MaskOrder returns a copy of the order with masked delivery data, the order itself is not modified
+func MaskOrder(order *model.Order) *model.Order {
+	if order == nil || order.Delivery == nil {
+		return order
+	}
+	masked := *order
+	masked.Delivery = MaskDelivery(order.Delivery)
+	return &masked
+}
+
+// MaskDelivery returns a copy of the delivery with masked name, phone, email, zip and address.
+// City and region are kept.
+func MaskDelivery(d *model.Delivery) *model.Delivery {
+	if d == nil {
+		return nil
+	}
+	masked := *d
+	masked.Name = MaskName(d.Name)
+	masked.Phone = MaskPhone(d.Phone)
+	masked.Email = MaskEmail(d.Email)
+	masked.Zip = MaskZip(d.Zip)
+	masked.Address = Redact(d.Address)
+	return &masked
+}
+
+// MaskName keeps the first letter of every word: "Ivan Petrov" -> "I*** P***"
+func MaskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = string([]rune(word)[:1]) + redacted
+	}
+	return strings.Join(words, " ")
+}
+
+// MaskPhone keeps the operator code and the last two digits: "+79151234567" -> "+7 (915) ***-**-67".
+// Other numbers keep the first two and the last two digits.
+func MaskPhone(phone string) string {
+	digits := make([]rune, 0, len(phone))
+	for _, r := range phone {
+		if unicode.IsDigit(r) {
+			digits = append(digits, r)
+		}
+	}
+	switch {
+	case len(digits) == 11 && (digits[0] == '7' || digits[0] == '8'):
+		return "+7 (" + string(digits[1:4]) + ") ***-**-" + string(digits[9:])
+	case len(digits) >= 7:
+		prefix := ""
+		if strings.HasPrefix(strings.TrimSpace(phone), "+") {
+			prefix = "+"
+		}
+		return prefix + string(digits[:2]) + strings.Repeat("*", len(digits)-4) + string(digits[len(digits)-2:])
+	case phone == "":
+		return ""
+	default:
+		return redacted
+	}
+}
+
+// MaskEmail keeps the first letter of the local part and the domain: "ivan@example.ru" -> "i***@example.ru"
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return Redact(email)
+	}
+	return string([]rune(local)[:1]) + redacted + "@" + domain
+}
+
+// MaskZip keeps the first three characters, which identify a region rather than a house
+func MaskZip(zip string) string {
+	runes := []rune(zip)
+	if len(runes) <= 3 {
+		return Redact(zip)
+	}
+	return string(runes[:3]) + strings.Repeat("*", len(runes)-3)
+}
+
+// Redact hides a non-empty value completely
+func Redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// RedactQuoted hides the quoted values of a message: `delivery.phone invalid: "+7915"` -> `delivery.phone invalid: "***"`
+func RedactQuoted(message string) string {
+	return quotedValue.ReplaceAllString(message, `"`+redacted+`"`)
+}
+
+// RedactProblem hides the quoted values of a validation message if the field holds personal data
+func RedactProblem(field, message string) string {
+	if !personalFields[field] {
+		return message
+	}
+	return RedactQuoted(message)
+}
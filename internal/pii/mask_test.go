@@ -0,0 +1,78 @@
+package pii
+
+import (
+	"MockOrderService/internal/domain/model"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name     string
+		mask     func(string) string
+		value    string
+		expected string
+	}{
+		{"name", MaskName, "Ivan Petrov", "I*** P***"},
+		{"cyrillic name", MaskName, "Иван  Петров", "И*** П***"},
+		{"empty name", MaskName, "", ""},
+		{"russian phone", MaskPhone, "+79151234567", "+7 (915) ***-**-67"},
+		{"russian phone with 8", MaskPhone, "8 (915) 123-45-67", "+7 (915) ***-**-67"},
+		{"foreign phone", MaskPhone, "+972 0000 000", "+97******00"},
+		{"short phone", MaskPhone, "12345", "***"},
+		{"empty phone", MaskPhone, "", ""},
+		{"email", MaskEmail, "ivan@example.ru", "i***@example.ru"},
+		{"cyrillic email", MaskEmail, "иван@пример.рф", "и***@пример.рф"},
+		{"email without local part", MaskEmail, "@example.ru", "***"},
+		{"not an email", MaskEmail, "ivan", "***"},
+		{"empty email", MaskEmail, "", ""},
+		{"zip", MaskZip, "263980", "263***"},
+		{"short zip", MaskZip, "263", "***"},
+		{"empty zip", MaskZip, "", ""},
+		{"quoted values", RedactQuoted, `delivery.phone "+7915" is not "+7\"916"`, `delivery.phone "***" is not "***"`},
+		{"nothing quoted", RedactQuoted, "delivery.phone is required", "delivery.phone is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mask(tt.value); got != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRedactProblem(t *testing.T) {
+	tests := []struct {
+		field    string
+		message  string
+		expected string
+	}{
+		{"/delivery/email", `invalid email "ivan@example"`, `invalid email "***"`},
+		{"/delivery/address", `address "Lenina 1" is too long`, `address "***" is too long`},
+		{"/delivery/city", `unknown city "Moskva"`, `unknown city "Moskva"`},
+		{"/items/0/rid", `duplicated rid "ab42"`, `duplicated rid "ab42"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := RedactProblem(tt.field, tt.message); got != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMaskOrder(t *testing.T) {
+	delivery := &model.Delivery{Name: "Ivan Petrov", Phone: "+79151234567", Email: "ivan@example.ru", Zip: "263980", City: "Moskva", Address: "Lenina 1"}
+	order := &model.Order{OrderUID: "a", Delivery: delivery}
+
+	masked := MaskOrder(order)
+	expected := model.Delivery{Name: "I*** P***", Phone: "+7 (915) ***-**-67", Email: "i***@example.ru", Zip: "263***", City: "Moskva", Address: "***"}
+	if *masked.Delivery != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *masked.Delivery)
+	}
+	if order.Delivery != delivery || delivery.Name != "Ivan Petrov" {
+		t.Fatal("the order itself was modified")
+	}
+	if bare := (&model.Order{OrderUID: "b"}); MaskOrder(bare) != bare {
+		t.Fatal("expected an order without delivery to be returned as is")
+	}
+}
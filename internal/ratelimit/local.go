@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxLocalBuckets is the size at which full buckets are dropped, a full bucket is the same as no bucket
+const maxLocalBuckets = 10000
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+	// full is the time the bucket is refilled completely
+	full time.Time
+}
+
+// LocalLimiter keeps buckets in memory, so limits are enforced per process
+type LocalLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token from the bucket of the key
+func (l *LocalLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxLocalBuckets {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: float64(limit.Burst), at: now}
+		l.buckets[key] = b
+	}
+	tokens := limit.Refill(b.tokens, now.Sub(b.at))
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	res := limit.Result(allowed, tokens)
+	b.tokens, b.at, b.full = tokens, now, now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep drops buckets which are full by now
+func (l *LocalLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package ratelimit implements token bucket rate limiting.
+// A bucket holds up to Burst tokens and is refilled with Requests tokens per Period, every request takes one token.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket policy
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Rate returns the refill rate in tokens per second
+func (l Limit) Rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// String formats the limit the way ParseLimit reads it
+func (l Limit) String() string {
+	period := l.Period.String()
+	// 1m0s reads as 1m
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+	return fmt.Sprintf("%d/%s,burst=%d", l.Requests, period, l.Burst)
+}
+
+// Result is the state of a bucket after taking a token
+type Result struct {
+	Allowed bool
+	// Remaining is the amount of whole tokens left
+	Remaining int
+	// RetryAfter is the time until a token is available, zero if Allowed
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+}
+
+// ParseLimit reads "<requests>/<period>[,burst=<n>]", e.g. "100/1m" or "20/1s,burst=50".
+// Burst defaults to requests.
+func ParseLimit(s string) (Limit, error) {
+	spec, burstSpec, hasBurst := strings.Cut(strings.TrimSpace(s), ",")
+	requests, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<period>[,burst=<n>]", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive integer", s)
+	}
+	period = strings.TrimSpace(period)
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		// "10/s" means "10/1s"
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", s)
+	}
+	limit := Limit{Requests: n, Period: d, Burst: n}
+	if hasBurst {
+		value, ok := strings.CutPrefix(strings.TrimSpace(burstSpec), "burst=")
+		burst, err := strconv.Atoi(value)
+		if !ok || err != nil || burst < 1 {
+			return Limit{}, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", s)
+		}
+		limit.Burst = burst
+	}
+	return limit, nil
+}
+
+// Refill returns the tokens of a bucket which had the given amount elapsed ago
+func (l Limit) Refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate())
+}
+
+// Result describes a bucket with tokens left after a request was allowed or denied
+func (l Limit) Result(allowed bool, tokens float64) Result {
+	res := Result{Allowed: allowed, Remaining: int(math.Max(0, tokens))}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / l.Rate())
+	}
+	res.Reset = seconds((float64(l.Burst) - tokens) / l.Rate())
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,271 @@
+package postgres
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// analyticsRefreshLock is the advisory lock key held while refreshing, so replicas don't refresh at once
+const analyticsRefreshLock = 4_817_001
+
+// analyticsDimensions maps report dimensions to columns of order_stats_daily
+var analyticsDimensions = map[string]string{
+	model.DimensionDeliveryService: "delivery_service",
+	model.DimensionProvider:        "provider",
+	model.DimensionBank:            "bank",
+	model.DimensionCity:            "city",
+	model.DimensionRegion:          "region",
+}
+
+// AnalyticsRepository reads reports from the daily aggregates order_stats_daily, item_stats_daily and brand_stats_daily.
+// The materialized views lag behind orders until they are refreshed.
+type AnalyticsRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAnalyticsRepository(pool *pgxpool.Pool) *AnalyticsRepository {
+	return &AnalyticsRepository{pool: pool}
+}
+
+// RefreshAnalytics refreshes the aggregates unless they are younger than maxAge or another replica refreshes them.
+// Readers aren't blocked meanwhile. It returns whether they were refreshed.
+func (r *AnalyticsRepository) RefreshAnalytics(ctx context.Context, maxAge time.Duration) (bool, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, analyticsRefreshLock).Scan(&locked); err != nil {
+		return false, fmt.Errorf("analytics lock failed: %w", err)
+	}
+	if !locked {
+		return false, nil
+	}
+	// the lock belongs to the session, a broken connection releases it as well
+	defer conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, analyticsRefreshLock)
+
+	var age float64
+	err = conn.QueryRow(ctx, `SELECT extract(epoch FROM now() - refreshed_at)::float8 FROM analytics_refreshes`).Scan(&age)
+	if err != nil {
+		return false, fmt.Errorf("analytics refresh time query failed: %w", err)
+	}
+	if maxAge > 0 && age < maxAge.Seconds() {
+		return false, nil
+	}
+	for _, view := range []string{"order_stats_daily", "item_stats_daily", "brand_stats_daily"} {
+		if _, err = conn.Exec(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY `+view); err != nil {
+			return false, fmt.Errorf("refresh of %s failed: %w", view, err)
+		}
+	}
+	if _, err = conn.Exec(ctx, `UPDATE analytics_refreshes SET refreshed_at = now()`); err != nil {
+		return false, fmt.Errorf("analytics refresh time update failed: %w", err)
+	}
+	return true, nil
+}
+
+// AnalyticsRefreshedAt returns when the aggregates were refreshed last
+func (r *AnalyticsRepository) AnalyticsRefreshedAt(ctx context.Context) (time.Time, error) {
+	var refreshedAt time.Time
+	if err := r.pool.QueryRow(ctx, `SELECT refreshed_at FROM analytics_refreshes`).Scan(&refreshedAt); err != nil {
+		return refreshedAt, fmt.Errorf("analytics refresh time query failed: %w", err)
+	}
+	return refreshedAt, nil
+}
+
+// OrderVolume returns orders, revenue and items per day or week (model.IntervalDay, model.IntervalWeek), oldest first
+func (r *AnalyticsRepository) OrderVolume(ctx context.Context, interval string, filter model.AnalyticsFilter) ([]model.VolumeRow, error) {
+	if interval != model.IntervalDay && interval != model.IntervalWeek {
+		return nil, fmt.Errorf("unknown interval: %q", interval)
+	}
+	where, args := analyticsFilterClause(filter)
+	args = append(args, interval)
+	rows, err := r.pool.Query(ctx, `
+SELECT date_trunc($`+strconv.Itoa(len(args))+`, day::timestamp)::date, currency, sum(orders)::bigint, sum(revenue)::bigint, sum(items)::bigint
+FROM order_stats_daily
+`+where+`
+GROUP BY 1, 2
+ORDER BY 1, 2`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("order volume query failed: %w", err)
+	}
+	defer rows.Close()
+	result := []model.VolumeRow{}
+	for rows.Next() {
+		var row model.VolumeRow
+		if err = rows.Scan(&row.Period, &row.Currency, &row.Orders, &row.Revenue, &row.Items); err != nil {
+			return nil, fmt.Errorf("order volume scan failed: %w", err)
+		}
+		result = append(result, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("order volume iteration failed: %w", err)
+	}
+	return result, nil
+}
+
+// OrderBreakdown returns the volume per value of a dimension (model.DimensionCity, ...), the most orders first
+func (r *AnalyticsRepository) OrderBreakdown(ctx context.Context, dimension string, filter model.AnalyticsFilter, limit int) ([]model.BreakdownRow, error) {
+	column, ok := analyticsDimensions[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown dimension: %q", dimension)
+	}
+	where, args := analyticsFilterClause(filter)
+	args = append(args, limit)
+	rows, err := r.pool.Query(ctx, `
+SELECT `+column+`, currency, sum(orders)::bigint, sum(revenue)::bigint, sum(items)::bigint
+FROM order_stats_daily
+`+where+`
+GROUP BY 1, 2
+ORDER BY 3 DESC, 1, 2
+LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("order breakdown query failed: %w", err)
+	}
+	defer rows.Close()
+	result := []model.BreakdownRow{}
+	for rows.Next() {
+		var row model.BreakdownRow
+		if err = rows.Scan(&row.Value, &row.Currency, &row.Orders, &row.Revenue, &row.Items); err != nil {
+			return nil, fmt.Errorf("order breakdown scan failed: %w", err)
+		}
+		result = append(result, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("order breakdown iteration failed: %w", err)
+	}
+	return result, nil
+}
+
+// BasketStats returns the average amount and the average amount of items of an order per currency
+func (r *AnalyticsRepository) BasketStats(ctx context.Context, filter model.AnalyticsFilter) ([]model.BasketStats, error) {
+	where, args := analyticsFilterClause(filter)
+	rows, err := r.pool.Query(ctx, `
+SELECT currency, sum(orders)::bigint, sum(revenue)::bigint, (sum(revenue) / sum(orders))::float8, (sum(items) / sum(orders))::float8
+FROM order_stats_daily
+`+where+`
+GROUP BY 1
+ORDER BY 1`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("basket stats query failed: %w", err)
+	}
+	defer rows.Close()
+	result := []model.BasketStats{}
+	for rows.Next() {
+		var row model.BasketStats
+		if err = rows.Scan(&row.Currency, &row.Orders, &row.Revenue, &row.AverageAmount, &row.AverageItems); err != nil {
+			return nil, fmt.Errorf("basket stats scan failed: %w", err)
+		}
+		result = append(result, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("basket stats iteration failed: %w", err)
+	}
+	return result, nil
+}
+
+// TopProducts returns the best selling products (nm_id and brand) by revenue or by sold items ("revenue", "items")
+func (r *AnalyticsRepository) TopProducts(ctx context.Context, sortBy string, filter model.AnalyticsFilter, limit int) ([]model.TopProduct, error) {
+	var order string
+	switch sortBy {
+	case "revenue":
+		order = "6 DESC, 4 DESC"
+	case "items":
+		order = "4 DESC, 6 DESC"
+	default:
+		return nil, fmt.Errorf("unknown sort: %q", sortBy)
+	}
+	where, args := analyticsFilterClause(filter)
+	args = append(args, limit)
+	rows, err := r.pool.Query(ctx, `
+SELECT nm_id, brand, currency, sum(items)::bigint, sum(orders)::bigint, sum(revenue)::bigint
+FROM item_stats_daily
+`+where+`
+GROUP BY 1, 2, 3
+ORDER BY `+order+`, 1, 2, 3
+LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("top products query failed: %w", err)
+	}
+	defer rows.Close()
+	result := []model.TopProduct{}
+	for rows.Next() {
+		var row model.TopProduct
+		if err = rows.Scan(&row.NmID, &row.Brand, &row.Currency, &row.Items, &row.Orders, &row.Revenue); err != nil {
+			return nil, fmt.Errorf("top products scan failed: %w", err)
+		}
+		result = append(result, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("top products iteration failed: %w", err)
+	}
+	return result, nil
+}
+
+// TopBrands returns the best selling brands by revenue or by sold items ("revenue", "items").
+// Orders are summed over days only, an order has a single day, so it's never counted twice.
+func (r *AnalyticsRepository) TopBrands(ctx context.Context, sortBy string, filter model.AnalyticsFilter, limit int) ([]model.TopBrand, error) {
+	var order string
+	switch sortBy {
+	case "revenue":
+		order = "5 DESC, 3 DESC"
+	case "items":
+		order = "3 DESC, 5 DESC"
+	default:
+		return nil, fmt.Errorf("unknown sort: %q", sortBy)
+	}
+	where, args := analyticsFilterClause(filter)
+	args = append(args, limit)
+	rows, err := r.pool.Query(ctx, `
+SELECT brand, currency, sum(items)::bigint, sum(orders)::bigint, sum(revenue)::bigint
+FROM brand_stats_daily
+`+where+`
+GROUP BY 1, 2
+ORDER BY `+order+`, 1, 2
+LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("top brands query failed: %w", err)
+	}
+	defer rows.Close()
+	result := []model.TopBrand{}
+	for rows.Next() {
+		var row model.TopBrand
+		if err = rows.Scan(&row.Brand, &row.Currency, &row.Items, &row.Orders, &row.Revenue); err != nil {
+			return nil, fmt.Errorf("top brands scan failed: %w", err)
+		}
+		result = append(result, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("top brands iteration failed: %w", err)
+	}
+	return result, nil
+}
+
+// analyticsFilterClause builds a WHERE clause over the day and currency columns of the aggregates
+func analyticsFilterClause(filter model.AnalyticsFilter) (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.From != nil {
+		add("day >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("day < $%d", *filter.To)
+	}
+	if filter.Currency != "" {
+		add("currency = $%d", filter.Currency)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type APIKeyRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAPIKeyRepository(pool *pgxpool.Pool) *APIKeyRepository {
+	return &APIKeyRepository{pool: pool}
+}
+
+// CreateAPIKey saves a key, its ID and CreatedAt are set from the database
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	err := r.pool.QueryRow(ctx, `
+INSERT INTO api_keys (name, role, prefix, key_hash)
+VALUES ($1,$2,$3,$4)
+RETURNING id, created_at
+`, key.Name, key.Role, key.Prefix, key.KeyHash).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("api key insert failed: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys returns all keys including revoked ones
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context) ([]*model.APIKey, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, name, role, prefix, key_hash, created_at, revoked_at FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("api keys query failed: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*model.APIKey{}
+	for rows.Next() {
+		var key model.APIKey
+		err = rows.Scan(&key.ID, &key.Name, &key.Role, &key.Prefix, &key.KeyHash, &key.CreatedAt, &key.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("api key scan failed: %w", err)
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("api keys iteration query failed: %w", err)
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByHash returns a key by the hash of its value, pgx.ErrNoRows if there is none
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.pool.QueryRow(ctx,
+		`SELECT id, name, role, prefix, key_hash, created_at, revoked_at FROM api_keys WHERE key_hash = $1`, hash).
+		Scan(&key.ID, &key.Name, &key.Role, &key.Prefix, &key.KeyHash, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		return nil, fmt.Errorf("api key query failed: %w", err)
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey marks a key as revoked, pgx.ErrNoRows if there is no such active key
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, id int32) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("api key revoke failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
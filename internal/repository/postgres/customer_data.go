@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+)
+
+// customerHash identifies an erased customer without keeping the customer id.
+// It's keyed, so it can't be reversed by hashing candidate ids, and empty without a keyring.
+func (r *OrderRepository) customerHash(customerID string) string {
+	if r.keyring == nil {
+		return ""
+	}
+	return r.keyring.CustomerIndex(customerID)
+}
+
+// newPseudonym returns a random customer id for erased orders, it has nothing to do with the erased one
+func newPseudonym() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate pseudonym: %w", err)
+	}
+	return "erased-" + hex.EncodeToString(b[:]), nil
+}
+
+// EraseCustomer anonymises every order of the customer and records the erasure, all in one transaction.
+// Delivery fields are blanked and the wrapped data keys dropped, the customer id is replaced with a pseudonym.
+// The erasure gets its ID, CustomerHash, Pseudonym, Orders and ErasedAt set.
+// Returns the orderUIDs of the erased orders, pgx.ErrNoRows if the customer has none.
+func (r *OrderRepository) EraseCustomer(ctx context.Context, customerID string, erasure *model.Erasure) ([]string, error) {
+	erasure.CustomerHash = r.customerHash(customerID)
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		return nil, err
+	}
+	erasure.Pseudonym = pseudonym
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT order_uid FROM orders WHERE customer_id = $1 ORDER BY order_uid FOR UPDATE`, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("orders query failed: %w", err)
+	}
+	var orderUIDs []string
+	for rows.Next() {
+		var orderUID string
+		if err = rows.Scan(&orderUID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("order scan failed: %w", err)
+		}
+		orderUIDs = append(orderUIDs, orderUID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("orders iteration query failed: %w", err)
+	}
+	if len(orderUIDs) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+
+	_, err = tx.Exec(ctx, `
+UPDATE deliveries SET name = '', phone = '', zip = '', city = '', address = '', region = '', email = '',
+  key_id = NULL, wrapped_key = NULL, phone_index = NULL, email_index = NULL
+WHERE order_uid = ANY($1)`, orderUIDs)
+	if err != nil {
+		return nil, fmt.Errorf("deliveries update failed: %w", err)
+	}
+	_, err = tx.Exec(ctx, `UPDATE orders SET customer_id = $2 WHERE order_uid = ANY($1)`,
+		orderUIDs, erasure.Pseudonym)
+	if err != nil {
+		return nil, fmt.Errorf("orders update failed: %w", err)
+	}
+
+	erasure.Orders = len(orderUIDs)
+	err = tx.QueryRow(ctx, `
+INSERT INTO erasures (customer_hash, pseudonym, orders, requested_by, reason, spools_checked)
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id, erased_at
+`, erasure.CustomerHash, erasure.Pseudonym, erasure.Orders, erasure.RequestedBy, erasure.Reason, erasure.SpoolsChecked).Scan(&erasure.ID, &erasure.ErasedAt)
+	if err != nil {
+		return nil, fmt.Errorf("erasure insert failed: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return orderUIDs, nil
+}
+
+// ListErasures returns the erasure log, newest first. A non-empty customerID returns only erasures of that customer,
+// model.ErrNoCustomerIndex if there is no keyring to find them with.
+func (r *OrderRepository) ListErasures(ctx context.Context, customerID string, limit int) ([]*model.Erasure, error) {
+	hash := ""
+	if customerID != "" {
+		if hash = r.customerHash(customerID); hash == "" {
+			return nil, model.ErrNoCustomerIndex
+		}
+	}
+	rows, err := r.pool.Query(ctx, `
+SELECT id, customer_hash, pseudonym, orders, requested_by, reason, spools_checked, erased_at
+FROM erasures WHERE $1 = '' OR customer_hash = $1 ORDER BY id DESC LIMIT $2`, hash, limit)
+	if err != nil {
+		return nil, fmt.Errorf("erasures query failed: %w", err)
+	}
+	defer rows.Close()
+
+	erasures := []*model.Erasure{}
+	for rows.Next() {
+		var erasure model.Erasure
+		err = rows.Scan(&erasure.ID, &erasure.CustomerHash, &erasure.Pseudonym, &erasure.Orders, &erasure.RequestedBy, &erasure.Reason, &erasure.SpoolsChecked, &erasure.ErasedAt)
+		if err != nil {
+			return nil, fmt.Errorf("erasure scan failed: %w", err)
+		}
+		erasures = append(erasures, &erasure)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("erasures iteration query failed: %w", err)
+	}
+	return erasures, nil
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/encryption"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+)
+
+// storedDelivery is a delivery the way it's written to the deliveries table.
+// Without a keyring the fields are plaintext and the envelope and indexes are NULL.
+type storedDelivery struct {
+	*model.Delivery
+	KeyID      *string
+	WrappedKey []byte
+	PhoneIndex *string
+	EmailIndex *string
+}
+
+// sealDelivery encrypts personal data of a delivery and computes its blind indexes
+func (r *OrderRepository) sealDelivery(orderUID string, d *model.Delivery) (*storedDelivery, error) {
+	if r.keyring == nil {
+		return &storedDelivery{Delivery: d}, nil
+	}
+	sealed, env, err := r.keyring.SealDelivery(orderUID, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt delivery: %w", err)
+	}
+	return &storedDelivery{
+		Delivery:   sealed,
+		KeyID:      &env.KeyID,
+		WrappedKey: env.WrappedKey,
+		PhoneIndex: nullIfEmpty(r.keyring.PhoneIndex(d.Phone)),
+		EmailIndex: nullIfEmpty(r.keyring.EmailIndex(d.Email)),
+	}, nil
+}
+
+// openDelivery decrypts a delivery read from the table, rows without key_id are plaintext
+func (r *OrderRepository) openDelivery(orderUID string, d *model.Delivery, keyID *string, wrappedKey []byte) error {
+	if keyID == nil {
+		return nil
+	}
+	if r.keyring == nil {
+		return fmt.Errorf("delivery of order %s is encrypted, but no keyring is configured", orderUID)
+	}
+	return r.keyring.OpenDelivery(orderUID, d, &encryption.Envelope{KeyID: *keyID, WrappedKey: wrappedKey})
+}
+
+// ReencryptDeliveries brings up to limit deliveries to the active key and returns how many were updated.
+// Plaintext rows are encrypted and indexed, rows of older keys only get their data keys rewrapped.
+// Locked rows are skipped, so several instances may run it at once.
+func (r *OrderRepository) ReencryptDeliveries(ctx context.Context, limit int) (int, error) {
+	if r.keyring == nil {
+		return 0, nil
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+SELECT order_uid, COALESCE(name, ''), COALESCE(phone, ''), COALESCE(address, ''), COALESCE(email, ''), key_id, wrapped_key
+FROM deliveries
+WHERE key_id IS DISTINCT FROM $1
+ORDER BY id
+LIMIT $2
+FOR UPDATE SKIP LOCKED`, r.keyring.ActiveKeyID(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("deliveries query failed: %w", err)
+	}
+	type staleDelivery struct {
+		delivery   model.Delivery
+		keyID      *string
+		wrappedKey []byte
+	}
+	var stale []staleDelivery
+	for rows.Next() {
+		var s staleDelivery
+		err = rows.Scan(&s.delivery.OrderUID, &s.delivery.Name, &s.delivery.Phone, &s.delivery.Address,
+			&s.delivery.Email, &s.keyID, &s.wrappedKey)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("delivery scan failed: %w", err)
+		}
+		stale = append(stale, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("deliveries iteration query failed: %w", err)
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, s := range stale {
+		orderUID := s.delivery.OrderUID
+		if s.keyID == nil {
+			stored, err := r.sealDelivery(orderUID, &s.delivery)
+			if err != nil {
+				return 0, fmt.Errorf("order %s: %w", orderUID, err)
+			}
+			batch.Queue(`
+UPDATE deliveries SET name = $2, phone = $3, address = $4, email = $5,
+  key_id = $6, wrapped_key = $7, phone_index = $8, email_index = $9
+WHERE order_uid = $1`, orderUID, stored.Name, stored.Phone, stored.Address, stored.Email,
+				stored.KeyID, stored.WrappedKey, stored.PhoneIndex, stored.EmailIndex)
+			continue
+		}
+		env, err := r.keyring.Rewrap(&encryption.Envelope{KeyID: *s.keyID, WrappedKey: s.wrappedKey})
+		if err != nil {
+			return 0, fmt.Errorf("order %s: %w", orderUID, err)
+		}
+		batch.Queue(`UPDATE deliveries SET key_id = $2, wrapped_key = $3 WHERE order_uid = $1`,
+			orderUID, env.KeyID, env.WrappedKey)
+	}
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, fmt.Errorf("deliveries update failed: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(stale), nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
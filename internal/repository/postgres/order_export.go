@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/encryption"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"strings"
+)
+
+// exportFetchSize is the amount of rows fetched from the export cursor at once
+const exportFetchSize = 1000
+
+// ExportOrders calls fn for every order matching the filter, ordered by date_created.
+// Orders are read with a server-side cursor in a read-only snapshot, so memory use doesn't depend on the amount of orders.
+// Orders passed to fn are complete (delivery, payment, items) and must not be retained.
+func (r *OrderRepository) ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(order *model.Order) error) error {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	where, args := r.orderFilterClause(filter)
+	// one row per item, orders without items get a single row with NULL item columns
+	_, err = tx.Exec(ctx, `
+DECLARE orders_export NO SCROLL CURSOR FOR
+SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+  o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.created_at,
+  d.order_uid IS NOT NULL, COALESCE(d.name, ''), COALESCE(d.phone, ''), COALESCE(d.zip, ''), COALESCE(d.city, ''),
+  COALESCE(d.address, ''), COALESCE(d.region, ''), COALESCE(d.email, ''), d.key_id, d.wrapped_key,
+  p.id, COALESCE(p.transaction_id, ''), COALESCE(p.request_id, ''), COALESCE(p.currency, ''), COALESCE(p.provider, ''),
+  p.amount, p.payment_dt, COALESCE(p.bank, ''), p.delivery_cost, p.goods_total, p.custom_fee, p.created_at,
+  i.id, i.chrt_id, COALESCE(i.track_number, ''), i.price, COALESCE(i.rid, ''), COALESCE(i.name, ''), i.sale,
+  COALESCE(i.size, ''), i.total_price, i.nm_id, COALESCE(i.brand, ''), i.status, i.created_at
+FROM orders o
+LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+LEFT JOIN payments p ON p.order_uid = o.order_uid
+LEFT JOIN items i ON i.order_uid = o.order_uid
+`+where+`
+ORDER BY o.date_created, o.order_uid, i.id`, args...)
+	if err != nil {
+		return fmt.Errorf("export cursor failed: %w", err)
+	}
+
+	var current *model.Order
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH FORWARD %d FROM orders_export", exportFetchSize))
+		if err != nil {
+			return fmt.Errorf("export fetch failed: %w", err)
+		}
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			var (
+				order       model.Order
+				delivery    model.Delivery
+				payment     model.Payment
+				item        model.Item
+				hasDelivery bool
+				keyID       *string
+				wrappedKey  []byte
+				paymentID   *int32
+				itemID      *int32
+			)
+			err = rows.Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
+				&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.CreatedAt,
+				&hasDelivery, &delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City,
+				&delivery.Address, &delivery.Region, &delivery.Email, &keyID, &wrappedKey,
+				&paymentID, &payment.TransactionID, &payment.RequestID, &payment.Currency, &payment.Provider,
+				&payment.Amount, &payment.PaymentDt, &payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee, &payment.CreatedAt,
+				&itemID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale,
+				&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status, &item.CreatedAt)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("export scan failed: %w", err)
+			}
+
+			if current == nil || current.OrderUID != order.OrderUID {
+				if current != nil {
+					if err = fn(current); err != nil {
+						rows.Close()
+						return err
+					}
+				}
+				current = &order
+				if hasDelivery {
+					delivery.OrderUID = order.OrderUID
+					if err = r.openDelivery(order.OrderUID, &delivery, keyID, wrappedKey); err != nil {
+						rows.Close()
+						return err
+					}
+					current.Delivery = &delivery
+				}
+				if paymentID != nil {
+					payment.ID = *paymentID
+					payment.OrderUID = order.OrderUID
+					current.Payment = &payment
+				}
+			}
+			if itemID != nil {
+				item.ID = *itemID
+				item.OrderUID = order.OrderUID
+				current.Items = append(current.Items, &item)
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("export iteration failed: %w", err)
+		}
+		if fetched < exportFetchSize {
+			break
+		}
+	}
+	if current != nil {
+		if err = fn(current); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// orderFilterClause builds a WHERE clause over the orders table aliased as o and deliveries aliased as d.
+// Encrypted phones and emails are looked up by their blind indexes, deliveries the key rotator
+// hasn't encrypted yet by their normalized plaintext.
+func (r *OrderRepository) orderFilterClause(filter model.OrderFilter) (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	// addEither adds a condition over the blind index and the plaintext of a field
+	addEither := func(condition string, index any, plaintext any) {
+		args = append(args, index, plaintext)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)-1, len(args)))
+	}
+	if filter.CreatedFrom != nil {
+		add("o.date_created >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		add("o.date_created < $%d", *filter.CreatedTo)
+	}
+	if filter.CustomerID != "" {
+		add("o.customer_id = $%d", filter.CustomerID)
+	}
+	if filter.DeliveryService != "" {
+		add("o.delivery_service = $%d", filter.DeliveryService)
+	}
+	if filter.Locale != "" {
+		add("o.locale = $%d", filter.Locale)
+	}
+	if filter.Phone != "" {
+		if r.keyring != nil {
+			addEither(`(d.phone_index = $%d OR (d.key_id IS NULL AND `+
+				`regexp_replace(regexp_replace(d.phone, '\D', '', 'g'), '^8(\d{10})$', '7\1') = $%d))`,
+				r.keyring.PhoneIndex(filter.Phone), encryption.NormalizePhone(filter.Phone))
+		} else {
+			add("d.phone = $%d", filter.Phone)
+		}
+	}
+	if filter.Email != "" {
+		if r.keyring != nil {
+			addEither("(d.email_index = $%d OR (d.key_id IS NULL AND lower(trim(d.email)) = $%d))",
+				r.keyring.EmailIndex(filter.Email), encryption.NormalizeEmail(filter.Email))
+		} else {
+			add("d.email = $%d", filter.Email)
+		}
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
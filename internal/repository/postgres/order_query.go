@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"strconv"
+)
+
+// ListOrders returns up to limit orders matching the filter, newest first, following the after cursor if it's set.
+// Only order columns are read, sub-resources are left nil.
+func (r *OrderRepository) ListOrders(ctx context.Context, filter model.OrderFilter, after *model.OrderCursor, limit int) ([]*model.Order, error) {
+	where, args := r.orderFilterClause(filter)
+	if after != nil {
+		args = append(args, after.CreatedAt, after.OrderUID)
+		keyset := "(o.created_at, o.order_uid) < ($" + strconv.Itoa(len(args)-1) + ", $" + strconv.Itoa(len(args)) + ")"
+		if where == "" {
+			where = "WHERE " + keyset
+		} else {
+			where += " AND " + keyset
+		}
+	}
+	args = append(args, limit)
+
+	rows, err := r.pool.Query(ctx, `
+SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+  o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.created_at
+FROM orders o
+LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+`+where+`
+ORDER BY o.created_at DESC, o.order_uid DESC
+LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("orders failed: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []*model.Order
+	for rows.Next() {
+		var order model.Order
+		err = rows.Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
+			&order.InternalSignature, &order.CustomerID,
+			&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("order scan failed: %w", err)
+		}
+		orders = append(orders, &order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("order iteration query failed: %w", err)
+	}
+	return orders, nil
+}
+
+// OrderStats aggregates orders matching the filter. The queries are sent in a single batch.
+func (r *OrderRepository) OrderStats(ctx context.Context, filter model.OrderFilter) (*model.OrderStats, error) {
+	where, args := r.orderFilterClause(filter)
+	from := `
+FROM orders o
+LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+`
+
+	batch := &pgx.Batch{}
+	batch.Queue(`SELECT count(*), min(o.date_created), max(o.date_created)`+from+where, args...)
+	batch.Queue(`SELECT COALESCE(o.delivery_service, ''), count(*)`+from+where+`
+GROUP BY 1 ORDER BY 2 DESC, 1`, args...)
+	batch.Queue(`SELECT COALESCE(p.currency, ''), count(*), COALESCE(sum(p.amount), 0)::bigint, COALESCE(avg(p.amount), 0)::float8`+from+`
+JOIN payments p ON p.order_uid = o.order_uid
+`+where+`
+GROUP BY 1 ORDER BY 1`, args...)
+
+	results := r.pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	var stats model.OrderStats
+	err := results.QueryRow().Scan(&stats.Orders, &stats.FirstDateCreated, &stats.LastDateCreated)
+	if err != nil {
+		return nil, fmt.Errorf("order stats query failed: %w", err)
+	}
+
+	rows, err := results.Query()
+	if err != nil {
+		return nil, fmt.Errorf("delivery service stats query failed: %w", err)
+	}
+	for rows.Next() {
+		var s model.DeliveryServiceStats
+		if err = rows.Scan(&s.DeliveryService, &s.Orders); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("delivery service stats scan failed: %w", err)
+		}
+		stats.ByDeliveryService = append(stats.ByDeliveryService, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("delivery service stats iteration failed: %w", err)
+	}
+
+	rows, err = results.Query()
+	if err != nil {
+		return nil, fmt.Errorf("currency stats query failed: %w", err)
+	}
+	for rows.Next() {
+		var s model.CurrencyStats
+		if err = rows.Scan(&s.Currency, &s.Orders, &s.Amount, &s.AverageAmount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("currency stats scan failed: %w", err)
+		}
+		stats.ByCurrency = append(stats.ByCurrency, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("currency stats iteration failed: %w", err)
+	}
+	return &stats, nil
+}
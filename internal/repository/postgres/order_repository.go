@@ -2,17 +2,22 @@ package postgres
 
 import (
 	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/encryption"
 	"context"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type OrderRepository struct {
 	pool *pgxpool.Pool
+	// keyring encrypts personal data of deliveries, nil stores it as plaintext
+	keyring *encryption.Keyring
 }
 
-func NewOrderRepository(pool *pgxpool.Pool) *OrderRepository {
-	return &OrderRepository{pool: pool}
+// NewOrderRepository creates a repository, keyring is optional
+func NewOrderRepository(pool *pgxpool.Pool, keyring *encryption.Keyring) *OrderRepository {
+	return &OrderRepository{pool: pool, keyring: keyring}
 }
 
 // SaveOrder saves an order to the database
@@ -35,12 +40,18 @@ ON CONFLICT (order_uid) DO NOTHING
 		return err
 	}
 
+	delivery, err := r.sealDelivery(order.OrderUID, order.Delivery)
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec(ctx, `
-INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
-VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email,
+                        key_id, wrapped_key, phone_index, email_index)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
 ON CONFLICT (order_uid) DO NOTHING
-`, order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City,
-		order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+`, order.OrderUID, delivery.Name, delivery.Phone, delivery.Zip, delivery.City,
+		delivery.Address, delivery.Region, delivery.Email,
+		delivery.KeyID, delivery.WrappedKey, delivery.PhoneIndex, delivery.EmailIndex)
 	if err != nil {
 		return err
 	}
@@ -73,8 +84,9 @@ ON CONFLICT (order_uid, rid) DO NOTHING
 	return tx.Commit(ctx)
 }
 
-// GetOrderByOrderUID returns an order by orderUID from the database
-func (r *OrderRepository) GetOrderByOrderUID(ctx context.Context, orderUID string) (*model.Order, error) {
+// GetOrderByOrderUID returns an order by orderUID from the database.
+// Sub-resources which are not requested in parts are not read.
+func (r *OrderRepository) GetOrderByOrderUID(ctx context.Context, orderUID string, parts model.OrderParts) (*model.Order, error) {
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return nil, err
@@ -84,46 +96,64 @@ func (r *OrderRepository) GetOrderByOrderUID(ctx context.Context, orderUID strin
 	var order model.Order
 	err = tx.QueryRow(ctx,
 		`SELECT order_uid, track_number, entry, locale, internal_signature,
-		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, created_at
 		FROM orders WHERE order_uid = $1`, orderUID).
 		Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
 			&order.InternalSignature, &order.CustomerID,
-			&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard)
+			&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.CreatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("orders query failed: %w", err)
 	}
 
-	var delivery model.Delivery
-	err = tx.QueryRow(ctx,
-		`SELECT order_uid, name, phone, zip, city, address, region, email 
+	if parts.Delivery {
+		var (
+			delivery   model.Delivery
+			keyID      *string
+			wrappedKey []byte
+		)
+		err = tx.QueryRow(ctx,
+			`SELECT order_uid, name, phone, zip, city, address, region, email, key_id, wrapped_key
 			FROM deliveries WHERE order_uid = $1`, orderUID).
-		Scan(&delivery.OrderUID, &delivery.Name, &delivery.Phone, &delivery.Zip,
-			&delivery.City, &delivery.Address, &delivery.Region, &delivery.Email)
-	if err != nil {
-		return nil, fmt.Errorf("deliveries query failed: %w", err)
+			Scan(&delivery.OrderUID, &delivery.Name, &delivery.Phone, &delivery.Zip,
+				&delivery.City, &delivery.Address, &delivery.Region, &delivery.Email, &keyID, &wrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("deliveries query failed: %w", err)
+		}
+		if err = r.openDelivery(delivery.OrderUID, &delivery, keyID, wrappedKey); err != nil {
+			return nil, err
+		}
+		order.Delivery = &delivery
 	}
-	order.Delivery = &delivery
 
-	rows, err := r.pool.Query(ctx,
-		`SELECT id, order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, created_at
+	if parts.Payment {
+		order.Payment, err = getPayment(ctx, tx, orderUID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parts.Items {
+		rows, err := r.pool.Query(ctx,
+			`SELECT id, order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, created_at
 			 FROM items
 			 WHERE order_uid = $1
 	`, orderUID)
-	if err != nil {
-		return nil, fmt.Errorf("items failed: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var item model.Item
-		err = rows.Scan(&item.ID, &item.OrderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status, &item.CreatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("item scan failed: %w", err)
+			return nil, fmt.Errorf("items failed: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var item model.Item
+			err = rows.Scan(&item.ID, &item.OrderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status, &item.CreatedAt)
+			if err != nil {
+				return nil, fmt.Errorf("item scan failed: %w", err)
+			}
+			order.Items = append(order.Items, &item)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("items iteration query failed: %w", err)
 		}
-		order.Items = append(order.Items, &item)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("items iteration query failed: %w", err)
 	}
 
 	err = tx.Commit(ctx)
@@ -146,7 +176,7 @@ func (r *OrderRepository) GetRecentOrders(ctx context.Context, limit int) ([]*mo
 
 	rows, err := r.pool.Query(ctx,
 		`SELECT order_uid, track_number, entry, locale, internal_signature,
-		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, created_at
 		FROM orders ORDER BY created_at DESC LIMIT $1`, limit)
 	if err != nil {
 		return nil, fmt.Errorf("orders failed: %w", err)
@@ -157,7 +187,7 @@ func (r *OrderRepository) GetRecentOrders(ctx context.Context, limit int) ([]*mo
 		var order model.Order
 		err = rows.Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
 			&order.InternalSignature, &order.CustomerID,
-			&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard)
+			&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("order scan failed: %w", err)
 		}
@@ -168,17 +198,29 @@ func (r *OrderRepository) GetRecentOrders(ctx context.Context, limit int) ([]*mo
 	}
 
 	for _, order := range orders {
-		var delivery model.Delivery
+		var (
+			delivery   model.Delivery
+			keyID      *string
+			wrappedKey []byte
+		)
 		err = tx.QueryRow(ctx,
-			`SELECT order_uid, name, phone, zip, city, address, region, email 
+			`SELECT order_uid, name, phone, zip, city, address, region, email, key_id, wrapped_key
 			FROM deliveries WHERE order_uid = $1`, order.OrderUID).
 			Scan(&delivery.OrderUID, &delivery.Name, &delivery.Phone, &delivery.Zip,
-				&delivery.City, &delivery.Address, &delivery.Region, &delivery.Email)
+				&delivery.City, &delivery.Address, &delivery.Region, &delivery.Email, &keyID, &wrappedKey)
 		if err != nil {
 			return nil, fmt.Errorf("deliveries query failed: %w", err)
 		}
+		if err = r.openDelivery(delivery.OrderUID, &delivery, keyID, wrappedKey); err != nil {
+			return nil, err
+		}
 		order.Delivery = &delivery
 
+		order.Payment, err = getPayment(ctx, tx, order.OrderUID)
+		if err != nil {
+			return nil, err
+		}
+
 		rows, err := r.pool.Query(ctx,
 			`SELECT id, order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, created_at
 			 FROM items
@@ -209,3 +251,149 @@ func (r *OrderRepository) GetRecentOrders(ctx context.Context, limit int) ([]*mo
 
 	return orders, nil
 }
+
+// getPayment returns the payment of an order
+func getPayment(ctx context.Context, tx pgx.Tx, orderUID string) (*model.Payment, error) {
+	var payment model.Payment
+	err := tx.QueryRow(ctx,
+		`SELECT id, order_uid, transaction_id, request_id, currency, provider, amount, payment_dt,
+			bank, delivery_cost, goods_total, custom_fee, created_at
+			FROM payments WHERE order_uid = $1`, orderUID).
+		Scan(&payment.ID, &payment.OrderUID, &payment.TransactionID, &payment.RequestID, &payment.Currency,
+			&payment.Provider, &payment.Amount, &payment.PaymentDt, &payment.Bank, &payment.DeliveryCost,
+			&payment.GoodsTotal, &payment.CustomFee, &payment.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("payments query failed: %w", err)
+	}
+	return &payment, nil
+}
+
+// GetOrdersByOrderUIDs returns orders with given orderUIDs from the database.
+// All tables are queried in a single batch (one round trip), unknown orderUIDs are absent from the result.
+// Sub-resources which are not requested in parts are not read.
+func (r *OrderRepository) GetOrdersByOrderUIDs(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error) {
+	orders := make(map[string]*model.Order, len(orderUIDs))
+	if len(orderUIDs) == 0 {
+		return orders, nil
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`SELECT order_uid, track_number, entry, locale, internal_signature,
+		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, created_at
+		FROM orders WHERE order_uid = ANY($1)`, orderUIDs)
+	if parts.Delivery {
+		batch.Queue(`SELECT order_uid, name, phone, zip, city, address, region, email, key_id, wrapped_key
+		FROM deliveries WHERE order_uid = ANY($1)`, orderUIDs)
+	}
+	if parts.Payment {
+		batch.Queue(`SELECT id, order_uid, transaction_id, request_id, currency, provider, amount, payment_dt,
+		bank, delivery_cost, goods_total, custom_fee, created_at
+		FROM payments WHERE order_uid = ANY($1)`, orderUIDs)
+	}
+	if parts.Items {
+		batch.Queue(`SELECT id, order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, created_at
+		FROM items WHERE order_uid = ANY($1) ORDER BY id`, orderUIDs)
+	}
+
+	results := r.pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	rows, err := results.Query()
+	if err != nil {
+		return nil, fmt.Errorf("orders query failed: %w", err)
+	}
+	for rows.Next() {
+		var order model.Order
+		err = rows.Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
+			&order.InternalSignature, &order.CustomerID,
+			&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("order scan failed: %w", err)
+		}
+		orders[order.OrderUID] = &order
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("order iteration query failed: %w", err)
+	}
+
+	if parts.Delivery {
+		rows, err = results.Query()
+		if err != nil {
+			return nil, fmt.Errorf("deliveries query failed: %w", err)
+		}
+		for rows.Next() {
+			var (
+				delivery   model.Delivery
+				keyID      *string
+				wrappedKey []byte
+			)
+			err = rows.Scan(&delivery.OrderUID, &delivery.Name, &delivery.Phone, &delivery.Zip,
+				&delivery.City, &delivery.Address, &delivery.Region, &delivery.Email, &keyID, &wrappedKey)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("delivery scan failed: %w", err)
+			}
+			if err = r.openDelivery(delivery.OrderUID, &delivery, keyID, wrappedKey); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if order, ok := orders[delivery.OrderUID]; ok {
+				order.Delivery = &delivery
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("deliveries iteration query failed: %w", err)
+		}
+	}
+
+	if parts.Payment {
+		rows, err = results.Query()
+		if err != nil {
+			return nil, fmt.Errorf("payments query failed: %w", err)
+		}
+		for rows.Next() {
+			var payment model.Payment
+			err = rows.Scan(&payment.ID, &payment.OrderUID, &payment.TransactionID, &payment.RequestID, &payment.Currency,
+				&payment.Provider, &payment.Amount, &payment.PaymentDt, &payment.Bank, &payment.DeliveryCost,
+				&payment.GoodsTotal, &payment.CustomFee, &payment.CreatedAt)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("payment scan failed: %w", err)
+			}
+			if order, ok := orders[payment.OrderUID]; ok {
+				order.Payment = &payment
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("payments iteration query failed: %w", err)
+		}
+	}
+
+	if parts.Items {
+		rows, err = results.Query()
+		if err != nil {
+			return nil, fmt.Errorf("items failed: %w", err)
+		}
+		for rows.Next() {
+			var item model.Item
+			err = rows.Scan(&item.ID, &item.OrderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status, &item.CreatedAt)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("item scan failed: %w", err)
+			}
+			if order, ok := orders[item.OrderUID]; ok {
+				order.Items = append(order.Items, &item)
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("items iteration query failed: %w", err)
+		}
+	}
+
+	return orders, nil
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// searchQueryCTE turns $1 into a tsquery matching Russian and English word forms
+const searchQueryCTE = `WITH q AS (
+  SELECT websearch_to_tsquery('russian', $1) || websearch_to_tsquery('english', $1) AS tsq
+)`
+
+// SearchOrders finds orders by words of item names and brands, delivery cities and addresses (weights A and B
+// of deliveries.search_vector) and track numbers. Misspelled words are matched by trigram similarity.
+// An order matching in several places ranks higher. Highlights cover the matched fields of the found orders.
+func (r *OrderRepository) SearchOrders(ctx context.Context, search model.OrderSearch) ([]*model.OrderSearchHit, error) {
+	rows, err := r.pool.Query(ctx, searchQueryCTE+`,
+hits AS (
+  SELECT i.order_uid,
+    ts_rank(i.search_vector, q.tsq) + word_similarity($1, concat_ws(' ', i.name, i.brand)) AS rank
+  FROM items i, q
+  WHERE i.search_vector @@ q.tsq OR $1 <% i.name OR $1 <% i.brand
+  UNION ALL
+  SELECT d.order_uid,
+    ts_rank(CASE WHEN $4 THEN d.search_vector ELSE ts_filter(d.search_vector, '{b}') END, q.tsq)
+      + greatest(word_similarity($1, d.city), CASE WHEN $4 AND d.key_id IS NULL THEN word_similarity($1, d.address) ELSE 0 END)
+  FROM deliveries d, q
+  WHERE (d.search_vector @@ q.tsq AND ($4 OR ts_filter(d.search_vector, '{b}') @@ q.tsq))
+    OR $1 <% d.city
+    OR ($4 AND d.key_id IS NULL AND $1 <% d.address)
+  UNION ALL
+  SELECT o.order_uid,
+    CASE WHEN lower(o.track_number) = lower($1) THEN 2 ELSE similarity(o.track_number, $1) END
+  FROM orders o
+  WHERE o.track_number ILIKE $2 OR o.track_number % $1
+)
+SELECT order_uid, sum(rank)::float8 AS rank
+FROM hits
+GROUP BY order_uid
+ORDER BY rank DESC, order_uid
+LIMIT $3`, search.Query, likePattern(search.Query), search.Limit, search.Addresses)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	var hits []*model.OrderSearchHit
+	byOrderUID := make(map[string]*model.OrderSearchHit)
+	for rows.Next() {
+		var hit model.OrderSearchHit
+		if err = rows.Scan(&hit.OrderUID, &hit.Rank); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("search scan failed: %w", err)
+		}
+		hits = append(hits, &hit)
+		byOrderUID[hit.OrderUID] = &hit
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("search iteration failed: %w", err)
+	}
+	if len(hits) == 0 {
+		return hits, nil
+	}
+
+	orderUIDs := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		orderUIDs = append(orderUIDs, hit.OrderUID)
+	}
+	// short fields are highlighted as a whole, fuzzy tells fields matched only by similarity
+	rows, err = r.pool.Query(ctx, searchQueryCTE+`
+SELECT i.order_uid, 'items.name', ts_headline('russian', i.name, q.tsq, $3), $1 <% i.name
+FROM items i, q WHERE i.order_uid = ANY($2) AND i.name <> ''
+UNION ALL
+SELECT i.order_uid, 'items.brand', ts_headline('russian', i.brand, q.tsq, $3), $1 <% i.brand
+FROM items i, q WHERE i.order_uid = ANY($2) AND i.brand <> ''
+UNION ALL
+SELECT d.order_uid, 'delivery.city', ts_headline('russian', d.city, q.tsq, $3), $1 <% d.city
+FROM deliveries d, q WHERE d.order_uid = ANY($2) AND d.city <> ''
+UNION ALL
+SELECT d.order_uid, 'delivery.address', ts_headline('russian', d.address, q.tsq, $3), $1 <% d.address
+FROM deliveries d, q WHERE $4 AND d.key_id IS NULL AND d.order_uid = ANY($2) AND d.address <> ''
+UNION ALL
+SELECT o.order_uid, 'track_number', o.track_number, o.track_number % $1
+FROM orders o WHERE o.order_uid = ANY($2) AND o.track_number <> ''`,
+		search.Query, orderUIDs, "StartSel="+model.HighlightStart+", StopSel="+model.HighlightStop+", HighlightAll=true", search.Addresses)
+	if err != nil {
+		return nil, fmt.Errorf("search highlights failed: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			orderUID, field, fragment string
+			fuzzy                     bool
+		)
+		if err = rows.Scan(&orderUID, &field, &fragment, &fuzzy); err != nil {
+			return nil, fmt.Errorf("search highlight scan failed: %w", err)
+		}
+		if field == "track_number" {
+			fragment = highlightSubstring(fragment, search.Query)
+		}
+		if !fuzzy && !strings.Contains(fragment, model.HighlightStart) {
+			continue
+		}
+		if hit, ok := byOrderUID[orderUID]; ok {
+			hit.Highlights = append(hit.Highlights, model.SearchHighlight{Field: field, Fragment: fragment})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("search highlight iteration failed: %w", err)
+	}
+	return hits, nil
+}
+
+// likePattern matches values containing s, wildcards of s are escaped
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// highlightSubstring marks the first case-insensitive occurrence of substr in s
+func highlightSubstring(s, substr string) string {
+	lower, lowerSubstr := strings.ToLower(s), strings.ToLower(substr)
+	// offsets in lower are only valid in s if lowering kept the byte lengths
+	if len(lower) != len(s) || len(lowerSubstr) != len(substr) {
+		return s
+	}
+	i := strings.Index(lower, lowerSubstr)
+	if i < 0 {
+		return s
+	}
+	return s[:i] + model.HighlightStart + s[i:i+len(substr)] + model.HighlightStop + s[i+len(substr):]
+}
@@ -2,25 +2,58 @@ package redis
 
 import (
 	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/encryption"
+	"MockOrderService/internal/service"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"math/rand/v2"
+	"strings"
+	"sync"
 	"time"
 )
 
+const orderKeyPrefix = "order:"
+
+// CacheMetrics counts hits and misses of order lookups
+type CacheMetrics interface {
+	CacheLookups(hits, misses int)
+}
+
 type CacheRepository struct {
-	client *redis.Client
+	client redis.UniversalClient
+	// keyring encrypts personal data of deliveries, nil caches it as plaintext
+	keyring *encryption.Keyring
+	metrics CacheMetrics
 }
 
-func NewCacheRepository(client *redis.Client) *CacheRepository {
-	return &CacheRepository{client: client}
+// NewCacheRepository creates a repository, keyring and metrics are optional
+func NewCacheRepository(client redis.UniversalClient, keyring *encryption.Keyring, metrics CacheMetrics) *CacheRepository {
+	return &CacheRepository{client: client, keyring: keyring, metrics: metrics}
+}
+
+// cachedOrder is the cached JSON of an order, Envelope is set if the delivery is encrypted
+type cachedOrder struct {
+	*model.Order
+	Envelope *encryption.Envelope `json:"envelope,omitempty"`
 }
 
 // SaveOrder saves order to cache with expiration time of 5 minutes
 func (r *CacheRepository) SaveOrder(ctx context.Context, order *model.Order) error {
 	orderKey := fmt.Sprintf("order:%s", order.OrderUID)
-	data, err := json.Marshal(order)
+	cached := cachedOrder{Order: order}
+	if r.keyring != nil && order.Delivery != nil {
+		sealed := *order
+		delivery, env, err := r.keyring.SealDelivery(order.OrderUID, order.Delivery)
+		if err != nil {
+			return fmt.Errorf("caching error – failed to encrypt delivery: %w", err)
+		}
+		sealed.Delivery = delivery
+		cached = cachedOrder{Order: &sealed, Envelope: env}
+	}
+	data, err := json.Marshal(&cached)
 	if err != nil {
 		return fmt.Errorf("caching error – failed to marshal order: %w", err)
 	}
@@ -33,22 +66,51 @@ func (r *CacheRepository) SaveOrder(ctx context.Context, order *model.Order) err
 	return nil
 }
 
-// GetOrder returns order from cache if it exists, otherwise returns error
+// GetOrder returns order from cache if it exists, otherwise returns error.
+// An entry which can't be decoded or decrypted (e.g. its data key is wrapped with a removed key) is deleted
+// and reported as a miss wrapping redis.Nil and service.ErrCacheEntryBroken, so that the order is read from db.
 func (r *CacheRepository) GetOrder(ctx context.Context, orderUID string) (*model.Order, error) {
 	orderKey := fmt.Sprintf("order:%s", orderUID)
 	// redis value is a json object, so we take bytes right away
 	val, err := r.client.Get(ctx, orderKey).Bytes()
 	if err != nil {
 		// cache miss
+		if errors.Is(err, redis.Nil) {
+			r.countLookups(0, 1)
+		}
 		return nil, err
 	}
-	// cache hit
-	var order model.Order
-	err = json.Unmarshal(val, &order)
+	order, err := r.decodeOrder(val)
 	if err != nil {
+		// broken entry is treated as a miss, db has the truth
+		r.countLookups(0, 1)
+		r.client.Del(ctx, orderKey)
+		return nil, fmt.Errorf("%w: %w: %s: %w", redis.Nil, service.ErrCacheEntryBroken, orderUID, err)
+	}
+	// cache hit
+	r.countLookups(1, 0)
+	return order, nil
+}
+
+// decodeOrder unmarshals a cached order and decrypts its delivery
+func (r *CacheRepository) decodeOrder(val []byte) (*model.Order, error) {
+	var cached cachedOrder
+	if err := json.Unmarshal(val, &cached); err != nil {
 		return nil, err
 	}
-	return &order, nil
+	if cached.Order == nil {
+		return nil, errors.New("cached order is empty")
+	}
+	if cached.Envelope == nil || cached.Delivery == nil {
+		return cached.Order, nil
+	}
+	if r.keyring == nil {
+		return nil, fmt.Errorf("cached order %s is encrypted, but no keyring is configured", cached.OrderUID)
+	}
+	if err := r.keyring.OpenDelivery(cached.OrderUID, cached.Delivery, cached.Envelope); err != nil {
+		return nil, err
+	}
+	return cached.Order, nil
 }
 
 // IsCacheEmpty returns true if cache is empty, otherwise returns false
@@ -59,3 +121,137 @@ func (r *CacheRepository) IsCacheEmpty(ctx context.Context) (bool, error) {
 	}
 	return n == 0, nil
 }
+
+// DeleteOrder removes order from cache
+func (r *CacheRepository) DeleteOrder(ctx context.Context, orderUID string) error {
+	orderKey := fmt.Sprintf("order:%s", orderUID)
+	if err := r.client.Del(ctx, orderKey).Err(); err != nil {
+		return fmt.Errorf("cache delete error: %w", err)
+	}
+	return nil
+}
+
+// ScanOrderUIDs iterates over all cached orders and calls fn with their orderUIDs.
+// Iteration stops at the first error returned by fn.
+// In cluster mode every master node is scanned.
+func (r *CacheRepository) ScanOrderUIDs(ctx context.Context, fn func(orderUID string) error) error {
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanOrderUIDs(ctx, node, fn)
+		})
+	}
+	return scanOrderUIDs(ctx, r.client, fn)
+}
+
+func scanOrderUIDs(ctx context.Context, client redis.Cmdable, fn func(orderUID string) error) error {
+	iter := client.Scan(ctx, 0, orderKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := fn(strings.TrimPrefix(iter.Val(), orderKeyPrefix)); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// SampleOrderUIDs returns orderUIDs of up to n cached orders.
+// Order keys are scanned from a random cursor, so other keys don't take up the sample and every run checks
+// another part of the cache. In cluster mode every master node is sampled.
+func (r *CacheRepository) SampleOrderUIDs(ctx context.Context, n int) ([]string, error) {
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return sampleOrderUIDs(ctx, r.client, n)
+	}
+	var mu sync.Mutex
+	var sampled []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		orderUIDs, err := sampleOrderUIDs(ctx, node, n)
+		mu.Lock()
+		sampled = append(sampled, orderUIDs...)
+		mu.Unlock()
+		return err
+	})
+	rand.Shuffle(len(sampled), func(i, j int) {
+		sampled[i], sampled[j] = sampled[j], sampled[i]
+	})
+	return sampled[:min(n, len(sampled))], err
+}
+
+func sampleOrderUIDs(ctx context.Context, client redis.Cmdable, n int) ([]string, error) {
+	orderUIDs := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	// SCAN accepts any cursor, after reaching the end the scan starts over once
+	cursor := rand.Uint64()
+	wrapped := false
+	for len(orderUIDs) < n {
+		keys, next, err := client.Scan(ctx, cursor, orderKeyPrefix+"*", 100).Result()
+		if err != nil {
+			return orderUIDs, err
+		}
+		for _, key := range keys {
+			orderUID := strings.TrimPrefix(key, orderKeyPrefix)
+			if _, ok := seen[orderUID]; ok || len(orderUIDs) == n {
+				continue
+			}
+			seen[orderUID] = struct{}{}
+			orderUIDs = append(orderUIDs, orderUID)
+		}
+		if next == 0 {
+			if wrapped {
+				break
+			}
+			wrapped = true
+		}
+		cursor = next
+	}
+	return orderUIDs, nil
+}
+
+// GetOrders returns cached orders by orderUIDs in a single pipeline.
+// Cache misses are absent from the result.
+// Pipeline is used instead of MGET since MGET fails on keys from different cluster slots.
+func (r *CacheRepository) GetOrders(ctx context.Context, orderUIDs []string) (map[string]*model.Order, error) {
+	orders := make(map[string]*model.Order, len(orderUIDs))
+	if len(orderUIDs) == 0 {
+		return orders, nil
+	}
+
+	cmds := make([]*redis.StringCmd, len(orderUIDs))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, orderUID := range orderUIDs {
+			cmds[i] = pipe.Get(ctx, fmt.Sprintf("order:%s", orderUID))
+		}
+		return nil
+	})
+	// redis.Nil is returned if at least one key is missing, it's fine
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("cache pipeline error: %w", err)
+	}
+
+	var broken []string
+	for i, cmd := range cmds {
+		val, err := cmd.Bytes()
+		if err != nil {
+			// cache miss
+			continue
+		}
+		order, err := r.decodeOrder(val)
+		if err != nil {
+			// broken entry is treated as a miss, db has the truth
+			broken = append(broken, fmt.Sprintf("order:%s", orderUIDs[i]))
+			continue
+		}
+		orders[orderUIDs[i]] = order
+	}
+	// keys are deleted one by one, they may be in different cluster slots
+	for _, key := range broken {
+		r.client.Del(ctx, key)
+	}
+	r.countLookups(len(orders), len(orderUIDs)-len(orders))
+	return orders, nil
+}
+
+func (r *CacheRepository) countLookups(hits, misses int) {
+	if r.metrics != nil {
+		r.metrics.CacheLookups(hits, misses)
+	}
+}
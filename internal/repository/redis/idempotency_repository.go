@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+type IdempotencyRepository struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+func NewIdempotencyRepository(client redis.UniversalClient, ttl time.Duration) *IdempotencyRepository {
+	return &IdempotencyRepository{client: client, ttl: ttl}
+}
+
+// Reserve marks the key as being processed for pendingTTL, so a key of a crashed request isn't held for long.
+// If the key was already used, returns the stored response and false.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key string, fingerprint string, pendingTTL time.Duration) (*model.IdempotentResponse, bool, error) {
+	data, err := json.Marshal(&model.IdempotentResponse{Fingerprint: fingerprint, Pending: true})
+	if err != nil {
+		return nil, false, fmt.Errorf("idempotency error – failed to marshal: %w", err)
+	}
+	reserved, err := r.client.SetNX(ctx, idempotencyKey(key), data, pendingTTL).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("idempotency error: %w", err)
+	}
+	if reserved {
+		return nil, true, nil
+	}
+
+	val, err := r.client.Get(ctx, idempotencyKey(key)).Bytes()
+	if err != nil {
+		// expired between SETNX and GET
+		if errors.Is(err, redis.Nil) {
+			return r.Reserve(ctx, key, fingerprint, pendingTTL)
+		}
+		return nil, false, fmt.Errorf("idempotency error: %w", err)
+	}
+	var stored model.IdempotentResponse
+	if err = json.Unmarshal(val, &stored); err != nil {
+		return nil, false, fmt.Errorf("idempotency error – failed to unmarshal: %w", err)
+	}
+	return &stored, false, nil
+}
+
+// Complete stores the response for a reserved key, it's kept for the full ttl
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, resp *model.IdempotentResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("idempotency error – failed to marshal: %w", err)
+	}
+	if err = r.client.Set(ctx, idempotencyKey(key), data, r.ttl).Err(); err != nil {
+		return fmt.Errorf("idempotency error: %w", err)
+	}
+	// the response is stored as a whole, results of single lines aren't needed anymore
+	if err = r.client.Del(ctx, idempotencyLinesKey(key, resp.Fingerprint)).Err(); err != nil {
+		return fmt.Errorf("idempotency error: %w", err)
+	}
+	return nil
+}
+
+// Lines returns the stored results of the already ingested lines of a bulk request by line number
+func (r *IdempotencyRepository) Lines(ctx context.Context, key string, fingerprint string) (map[int][]byte, error) {
+	vals, err := r.client.HGetAll(ctx, idempotencyLinesKey(key, fingerprint)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("idempotency error: %w", err)
+	}
+	lines := make(map[int][]byte, len(vals))
+	for field, val := range vals {
+		line, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("idempotency error – invalid line %q: %w", field, err)
+		}
+		lines[line] = []byte(val)
+	}
+	return lines, nil
+}
+
+// SaveLines stores results of ingested lines of a bulk request, so its retry with the same key skips them
+func (r *IdempotencyRepository) SaveLines(ctx context.Context, key string, fingerprint string, lines map[int][]byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	values := make([]any, 0, 2*len(lines))
+	for line, result := range lines {
+		values = append(values, strconv.Itoa(line), result)
+	}
+	linesKey := idempotencyLinesKey(key, fingerprint)
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, linesKey, values...)
+	pipe.Expire(ctx, linesKey, r.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("idempotency error: %w", err)
+	}
+	return nil
+}
+
+// Release frees a reserved key, so the request can be retried (e.g. after an internal error)
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	if err := r.client.Del(ctx, idempotencyKey(key)).Err(); err != nil {
+		return fmt.Errorf("idempotency error: %w", err)
+	}
+	return nil
+}
+
+func idempotencyKey(key string) string {
+	return fmt.Sprintf("idempotency:%s", key)
+}
+
+// idempotencyLinesKey includes the fingerprint, so lines of a released key aren't mixed with another payload
+func idempotencyLinesKey(key string, fingerprint string) string {
+	return fmt.Sprintf("idempotency-lines:%s:%s", key, fingerprint)
+}
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestIdempotencyRepository(t *testing.T) (*IdempotencyRepository, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewIdempotencyRepository(client, time.Hour), mr
+}
+
+func TestIdempotencyRepository(t *testing.T) {
+	ctx := context.Background()
+	response := &model.IdempotentResponse{Fingerprint: "fp", Status: 201, ContentType: "application/json", Body: []byte(`{"ok":true}`)}
+
+	tests := []struct {
+		name string
+		// prepare brings the key "k" to the tested state
+		prepare func(t *testing.T, repo *IdempotencyRepository, mr *miniredis.Miniredis)
+		stored  *model.IdempotentResponse
+	}{
+		{
+			name:    "new key",
+			prepare: func(*testing.T, *IdempotencyRepository, *miniredis.Miniredis) {},
+		},
+		{
+			name: "request in progress",
+			prepare: func(t *testing.T, repo *IdempotencyRepository, _ *miniredis.Miniredis) {
+				mustReserve(t, repo)
+			},
+			stored: &model.IdempotentResponse{Fingerprint: "fp", Pending: true},
+		},
+		{
+			name: "request in progress crashed",
+			prepare: func(t *testing.T, repo *IdempotencyRepository, mr *miniredis.Miniredis) {
+				mustReserve(t, repo)
+				mr.FastForward(time.Minute + time.Second)
+			},
+		},
+		{
+			name: "released",
+			prepare: func(t *testing.T, repo *IdempotencyRepository, _ *miniredis.Miniredis) {
+				mustReserve(t, repo)
+				if err := repo.Release(ctx, "k"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "completed",
+			prepare: func(t *testing.T, repo *IdempotencyRepository, mr *miniredis.Miniredis) {
+				mustReserve(t, repo)
+				if err := repo.Complete(ctx, "k", response); err != nil {
+					t.Fatal(err)
+				}
+				// the response outlives the pending ttl
+				mr.FastForward(30 * time.Minute)
+			},
+			stored: response,
+		},
+		{
+			name: "completed long ago",
+			prepare: func(t *testing.T, repo *IdempotencyRepository, mr *miniredis.Miniredis) {
+				mustReserve(t, repo)
+				if err := repo.Complete(ctx, "k", response); err != nil {
+					t.Fatal(err)
+				}
+				mr.FastForward(time.Hour + time.Second)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mr := newTestIdempotencyRepository(t)
+			tt.prepare(t, repo, mr)
+
+			stored, reserved, err := repo.Reserve(ctx, "k", "fp", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reserved != (tt.stored == nil) {
+				t.Fatalf("expected reserved %v, got %v", tt.stored == nil, reserved)
+			}
+			if !reflect.DeepEqual(stored, tt.stored) {
+				t.Fatalf("expected stored response %+v, got %+v", tt.stored, stored)
+			}
+		})
+	}
+}
+
+func TestIdempotencyRepositoryLines(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestIdempotencyRepository(t)
+	mustReserve(t, repo)
+
+	if err := repo.SaveLines(ctx, "k", "fp", map[int][]byte{1: []byte(`"a"`), 3: []byte(`"b"`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveLines(ctx, "k", "fp", map[int][]byte{4: []byte(`"c"`)}); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := repo.Lines(ctx, "k", "fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int][]byte{1: []byte(`"a"`), 3: []byte(`"b"`), 4: []byte(`"c"`)}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected lines %q, got %q", expected, lines)
+	}
+	// lines of another payload under the same key aren't mixed in
+	if other, err := repo.Lines(ctx, "k", "other"); err != nil || len(other) != 0 {
+		t.Fatalf("expected no lines for another fingerprint, got %q, %v", other, err)
+	}
+
+	if err = repo.Complete(ctx, "k", &model.IdempotentResponse{Fingerprint: "fp", Status: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if lines, err = repo.Lines(ctx, "k", "fp"); err != nil || len(lines) != 0 {
+		t.Fatalf("expected lines to be deleted on completion, got %q, %v", lines, err)
+	}
+}
+
+func mustReserve(t *testing.T, repo *IdempotencyRepository) {
+	t.Helper()
+	_, reserved, err := repo.Reserve(context.Background(), "k", "fp", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reserved {
+		t.Fatal("expected the key to be reserved")
+	}
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"MockOrderService/internal/service"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const (
+	// keys share a hash tag, so the script works in cluster mode
+	feedSeqKey = "{orderfeed}:seq"
+	feedLogKey = "{orderfeed}:log"
+	// feedChannel is the pub/sub channel events are sent to
+	feedChannel = "orderfeed"
+)
+
+// appendEventScript numbers the event, keeps the latest ARGV[2] events and publishes the event.
+// The id is spliced into the JSON object, so it needn't be decoded.
+var appendEventScript = redis.NewScript(`
+local id = redis.call('INCR', KEYS[1])
+local payload = '{"id":' .. id .. ',' .. string.sub(ARGV[1], 2)
+redis.call('ZADD', KEYS[2], id, payload)
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -tonumber(ARGV[2]) - 1)
+redis.call('PUBLISH', ARGV[3], payload)
+return id
+`)
+
+// feedEvent is the stored form of an order event, orders aren't stored
+type feedEvent struct {
+	ID       int64     `json:"id,omitempty"`
+	Type     string    `json:"type"`
+	OrderUID string    `json:"order_uid"`
+	At       time.Time `json:"at"`
+}
+
+// OrderFeedRepository is the order event log in redis: a counter for ids,
+// a sorted set with the latest events for resuming subscribers and a pub/sub channel for live ones
+type OrderFeedRepository struct {
+	client  redis.UniversalClient
+	history int
+}
+
+// NewOrderFeedRepository creates the log, it keeps the latest history events
+func NewOrderFeedRepository(client redis.UniversalClient, history int) *OrderFeedRepository {
+	return &OrderFeedRepository{client: client, history: history}
+}
+
+// Append assigns the next id to ev, stores it and publishes it
+func (r *OrderFeedRepository) Append(ctx context.Context, ev service.OrderEvent) (int64, error) {
+	data, err := json.Marshal(feedEvent{Type: ev.Type, OrderUID: ev.OrderUID, At: ev.At})
+	if err != nil {
+		return 0, fmt.Errorf("feed error – failed to marshal event: %w", err)
+	}
+	id, err := appendEventScript.Run(ctx, r.client, []string{feedSeqKey, feedLogKey}, data, r.history, feedChannel).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("feed error: %w", err)
+	}
+	return id, nil
+}
+
+// Since returns up to limit stored events with ids greater than afterID, oldest first
+func (r *OrderFeedRepository) Since(ctx context.Context, afterID int64, limit int) ([]service.OrderEvent, error) {
+	vals, err := r.client.ZRangeByScore(ctx, feedLogKey, &redis.ZRangeBy{
+		Min:   "(" + strconv.FormatInt(afterID, 10),
+		Max:   "+inf",
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("feed error: %w", err)
+	}
+	events := make([]service.OrderEvent, 0, len(vals))
+	for _, val := range vals {
+		ev, err := decodeFeedEvent(val)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// Listen calls fn for every published event until ctx is done.
+// The subscription reconnects on its own, events published meanwhile are only available with Since.
+func (r *OrderFeedRepository) Listen(ctx context.Context, fn func(ev service.OrderEvent)) error {
+	sub := r.client.Subscribe(ctx, feedChannel)
+	defer sub.Close()
+	// fails fast if redis can't be reached
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("feed error – failed to subscribe: %w", err)
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("feed error – subscription closed")
+			}
+			ev, err := decodeFeedEvent(msg.Payload)
+			if err != nil {
+				return err
+			}
+			fn(ev)
+		}
+	}
+}
+
+func decodeFeedEvent(data string) (service.OrderEvent, error) {
+	var ev feedEvent
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		return service.OrderEvent{}, fmt.Errorf("feed error – failed to unmarshal event: %w", err)
+	}
+	return service.OrderEvent{ID: ev.ID, Type: ev.Type, OrderUID: ev.OrderUID, At: ev.At}, nil
+}
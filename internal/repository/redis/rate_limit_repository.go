@@ -0,0 +1,63 @@
+package redis
+
+import (
+	"MockOrderService/internal/ratelimit"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+// takeTokenScript refills the bucket by the time passed on the redis clock and takes a token from it.
+// The key expires once the bucket would be full again.
+var takeTokenScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RateLimitRepository keeps token buckets in redis, so limits are shared by every api server replica
+type RateLimitRepository struct {
+	client redis.UniversalClient
+}
+
+func NewRateLimitRepository(client redis.UniversalClient) *RateLimitRepository {
+	return &RateLimitRepository{client: client}
+}
+
+// Allow takes a token from the bucket of the key
+func (r *RateLimitRepository) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	// the script works in milliseconds
+	rate := strconv.FormatFloat(limit.Rate()/1000, 'g', -1, 64)
+	val, err := takeTokenScript.Run(ctx, r.client, []string{rateLimitKey(key)}, limit.Burst, rate).Slice()
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("rate limit error: %w", err)
+	}
+	if len(val) != 2 {
+		return ratelimit.Result{}, fmt.Errorf("rate limit error – unexpected reply %v", val)
+	}
+	allowed, _ := val[0].(int64)
+	tokensValue, _ := val[1].(string)
+	tokens, err := strconv.ParseFloat(tokensValue, 64)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("rate limit error – invalid tokens %q: %w", tokensValue, err)
+	}
+	return limit.Result(allowed == 1, tokens), nil
+}
+
+func rateLimitKey(key string) string {
+	return fmt.Sprintf("ratelimit:%s", key)
+}
@@ -0,0 +1,104 @@
+package redis
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+const (
+	// keys share a hash tag, so the script works in cluster mode
+	rejectionSeqKey = "{rejections}:seq"
+	rejectionLogKey = "{rejections}:log"
+)
+
+// appendRejectionScript numbers the rejection and keeps the latest ARGV[2] ones.
+// The id is spliced into the JSON object, so it needn't be decoded.
+var appendRejectionScript = redis.NewScript(`
+local id = redis.call('INCR', KEYS[1])
+redis.call('ZADD', KEYS[2], id, '{"id":' .. id .. ',' .. string.sub(ARGV[1], 2))
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -tonumber(ARGV[2]) - 1)
+return id
+`)
+
+// RejectionRepository is the log of rejected messages in redis, a sorted set of the latest rejections by id
+type RejectionRepository struct {
+	client  redis.UniversalClient
+	history int
+}
+
+// NewRejectionRepository creates the log, it keeps the latest history rejections
+func NewRejectionRepository(client redis.UniversalClient, history int) *RejectionRepository {
+	return &RejectionRepository{client: client, history: history}
+}
+
+// SaveRejection assigns the next id to the rejection and stores it
+func (r *RejectionRepository) SaveRejection(ctx context.Context, rejection *model.Rejection) error {
+	stored := *rejection
+	stored.ID = 0
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return fmt.Errorf("rejection log error – failed to marshal rejection: %w", err)
+	}
+	id, err := appendRejectionScript.Run(ctx, r.client, []string{rejectionSeqKey, rejectionLogKey}, data, r.history).Int64()
+	if err != nil {
+		return fmt.Errorf("rejection log error: %w", err)
+	}
+	rejection.ID = id
+	return nil
+}
+
+// ListRejections returns up to limit rejections with ids less than beforeID (all if it's 0), newest first
+func (r *RejectionRepository) ListRejections(ctx context.Context, beforeID int64, limit int) ([]*model.Rejection, error) {
+	max := "+inf"
+	if beforeID > 0 {
+		max = "(" + strconv.FormatInt(beforeID, 10)
+	}
+	vals, err := r.client.ZRevRangeByScore(ctx, rejectionLogKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   max,
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("rejection log error: %w", err)
+	}
+	rejections := make([]*model.Rejection, 0, len(vals))
+	for _, val := range vals {
+		var rejection model.Rejection
+		if err := json.Unmarshal([]byte(val), &rejection); err != nil {
+			return nil, fmt.Errorf("rejection log error – failed to unmarshal rejection: %w", err)
+		}
+		rejections = append(rejections, &rejection)
+	}
+	return rejections, nil
+}
+
+// DeleteCustomerRejections removes the rejections of a customer by the blind index of its id, returns how many were removed
+func (r *RejectionRepository) DeleteCustomerRejections(ctx context.Context, customerIndex string) (int, error) {
+	vals, err := r.client.ZRange(ctx, rejectionLogKey, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("rejection log error: %w", err)
+	}
+	var members []any
+	for _, val := range vals {
+		var rejection model.Rejection
+		if err := json.Unmarshal([]byte(val), &rejection); err != nil {
+			return 0, fmt.Errorf("rejection log error – failed to unmarshal rejection: %w", err)
+		}
+		if rejection.CustomerIndex == customerIndex {
+			members = append(members, val)
+		}
+	}
+	if len(members) == 0 {
+		return 0, nil
+	}
+	// members trimmed from the log in the meantime are simply not found
+	removed, err := r.client.ZRem(ctx, rejectionLogKey, members...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("rejection log error: %w", err)
+	}
+	return int(removed), nil
+}
@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+// spoolsPendingKey is a hash of spool ids to their pending records, spools without pending records aren't in it
+const spoolsPendingKey = "spools:pending"
+
+// SpoolRepository shares the pending records of every replica's spool, so one replica can tell
+// whether orders still wait in the spool of another
+type SpoolRepository struct {
+	client redis.UniversalClient
+}
+
+func NewSpoolRepository(client redis.UniversalClient) *SpoolRepository {
+	return &SpoolRepository{client: client}
+}
+
+// ReportPending stores the amount of pending records of a spool, 0 removes the spool.
+// A spool with pending records stays listed until they are flushed, even if its replica is gone.
+func (r *SpoolRepository) ReportPending(ctx context.Context, spoolID string, pending int) error {
+	var err error
+	if pending > 0 {
+		err = r.client.HSet(ctx, spoolsPendingKey, spoolID, pending).Err()
+	} else {
+		err = r.client.HDel(ctx, spoolsPendingKey, spoolID).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("spool registry error: %w", err)
+	}
+	return nil
+}
+
+// PendingSpools returns the spools with pending records and their amounts
+func (r *SpoolRepository) PendingSpools(ctx context.Context) (map[string]int, error) {
+	vals, err := r.client.HGetAll(ctx, spoolsPendingKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("spool registry error: %w", err)
+	}
+	spools := make(map[string]int, len(vals))
+	for spoolID, val := range vals {
+		pending, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("spool registry error – invalid pending %q of %s: %w", val, spoolID, err)
+		}
+		spools[spoolID] = pending
+	}
+	return spools, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+type AnalyticsRepository interface {
+	RefreshAnalytics(ctx context.Context, maxAge time.Duration) (bool, error)
+}
+
+// AnalyticsRefresher keeps the analytics aggregates up to date.
+// Every replica runs it, the refresh is skipped when another replica has just done it.
+type AnalyticsRefresher struct {
+	sugar *zap.SugaredLogger
+	repo  AnalyticsRepository
+}
+
+func NewAnalyticsRefresher(sugar *zap.SugaredLogger, repo AnalyticsRepository) *AnalyticsRefresher {
+	return &AnalyticsRefresher{sugar: sugar, repo: repo}
+}
+
+// Start refreshes right away and then every interval until ctx is canceled
+func (a *AnalyticsRefresher) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// aggregates refreshed within half an interval by another replica are fresh enough
+		a.Run(ctx, interval/2)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run refreshes the aggregates if they are older than maxAge, 0 refreshes them anyway.
+// It returns false if they weren't refreshed, because they are fresh or another replica is refreshing them.
+func (a *AnalyticsRefresher) Run(ctx context.Context, maxAge time.Duration) (bool, error) {
+	start := time.Now()
+	refreshed, err := a.repo.RefreshAnalytics(ctx, maxAge)
+	if err != nil {
+		a.sugar.Errorw("ANALYTICS: refresh failed", "error", err)
+		return false, err
+	}
+	if refreshed {
+		a.sugar.Infow("ANALYTICS: aggregates refreshed", "duration", time.Since(start))
+	}
+	return refreshed, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+// reencryptBatchSize is the amount of deliveries re-encrypted in one transaction
+const reencryptBatchSize = 500
+
+type ReencryptOrderRepository interface {
+	ReencryptDeliveries(ctx context.Context, limit int) (int, error)
+}
+
+type Keyring interface {
+	Reload() (bool, error)
+	ActiveKeyID() string
+}
+
+// KeyRotator picks up keyfile changes and brings stored deliveries to the active key in the background:
+// plaintext rows are encrypted, rows of older keys get their data keys rewrapped.
+type KeyRotator struct {
+	sugar     *zap.SugaredLogger
+	orderRepo ReencryptOrderRepository
+	keyring   Keyring
+}
+
+func NewKeyRotator(sugar *zap.SugaredLogger, orderRepo ReencryptOrderRepository, keyring Keyring) *KeyRotator {
+	return &KeyRotator{sugar: sugar, orderRepo: orderRepo, keyring: keyring}
+}
+
+// Start re-encrypts right away and then every interval until ctx is canceled
+func (k *KeyRotator) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		k.Run(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run reloads the keyfile and re-encrypts deliveries until none are left
+func (k *KeyRotator) Run(ctx context.Context) {
+	reloaded, err := k.keyring.Reload()
+	if err != nil {
+		// the previous keys stay in use
+		k.sugar.Errorw("ENCRYPTION: failed to reload keyfile", "error", err)
+	} else if reloaded {
+		k.sugar.Infow("ENCRYPTION: keyfile reloaded", "active_key", k.keyring.ActiveKeyID())
+	}
+
+	total := 0
+	for ctx.Err() == nil {
+		n, err := k.orderRepo.ReencryptDeliveries(ctx, reencryptBatchSize)
+		if err != nil {
+			k.sugar.Errorw("ENCRYPTION: re-encryption failed", "reencrypted", total, "error", err)
+			return
+		}
+		total += n
+		if n < reencryptBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		k.sugar.Infow("ENCRYPTION: deliveries re-encrypted", "count", total, "active_key", k.keyring.ActiveKeyID())
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// OrderEventLog numbers events, keeps the latest of them and delivers them to every replica.
+// Events are stored without orders, so personal data never leaves encrypted storage.
+type OrderEventLog interface {
+	// Append assigns the next id to ev, stores it and sends it to listeners of all replicas
+	Append(ctx context.Context, ev OrderEvent) (int64, error)
+	// Since returns up to limit stored events with ids greater than afterID, oldest first
+	Since(ctx context.Context, afterID int64, limit int) ([]OrderEvent, error)
+	// Listen calls fn for every appended event until ctx is done
+	Listen(ctx context.Context, fn func(ev OrderEvent)) error
+}
+
+type OrderGetter interface {
+	GetOrders(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error)
+}
+
+const (
+	// feedAppendTimeout keeps order processing from waiting on the log
+	feedAppendTimeout = 2 * time.Second
+	// feedResolveTimeout limits reading the orders of a batch of events
+	feedResolveTimeout = 5 * time.Second
+	// feedResolveQueue is how many events may wait for their orders, beyond it subscribers are dropped
+	feedResolveQueue = 1024
+	// feedResolveBatch limits the orders read at once
+	feedResolveBatch = 100
+	// feedListenRetry is the pause before listening again after the log failed
+	feedListenRetry = time.Second
+)
+
+// OrderBroadcaster sends order events of this replica to the log and events of all replicas to local subscribers.
+// Orders of the events are read back with the cache-then-db reader on every replica.
+type OrderBroadcaster struct {
+	sugar  *zap.SugaredLogger
+	log    OrderEventLog
+	reader OrderGetter
+	feed   *OrderFeed
+	// history limits the events replayed to a resuming subscriber
+	history int
+}
+
+func NewOrderBroadcaster(sugar *zap.SugaredLogger, log OrderEventLog, reader OrderGetter, feed *OrderFeed, history int) *OrderBroadcaster {
+	return &OrderBroadcaster{
+		sugar:   sugar,
+		log:     log,
+		reader:  reader,
+		feed:    feed,
+		history: history,
+	}
+}
+
+// Publish appends ev to the log. If the log is unavailable ev is only passed to local subscribers, without an id.
+func (b *OrderBroadcaster) Publish(ev OrderEvent) {
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), feedAppendTimeout)
+	defer cancel()
+	if _, err := b.log.Append(ctx, ev); err != nil {
+		b.sugar.Warnw("FEED: couldn't append order event, it's delivered to this replica only",
+			"orderUID", ev.OrderUID, "type", ev.Type, "error", err)
+		b.feed.Publish(ev)
+	}
+}
+
+// Subscribe returns a channel of events published from now on, see OrderFeed.Subscribe
+func (b *OrderBroadcaster) Subscribe(buffer int) (<-chan OrderEvent, func()) {
+	return b.feed.Subscribe(buffer)
+}
+
+// Run passes events of the log to local subscribers until ctx is done.
+// Orders are read on a separate goroutine, so reading them doesn't hold up listening,
+// and only while this replica has subscribers.
+func (b *OrderBroadcaster) Run(ctx context.Context) {
+	queue := make(chan OrderEvent, feedResolveQueue)
+	go b.publishResolved(ctx, queue)
+	for {
+		err := b.log.Listen(ctx, func(ev OrderEvent) {
+			// nobody would get it, a subscriber resuming later reads it from the log
+			if b.feed.Subscribers() == 0 {
+				return
+			}
+			select {
+			case queue <- ev:
+			default:
+				// subscribers would miss the event without knowing, they're dropped to resume from the log instead
+				b.sugar.Warnw("FEED: too many events wait for their orders, dropping subscribers",
+					"orderUID", ev.OrderUID, "id", ev.ID, "subscribers", b.feed.Subscribers())
+				b.feed.DropAll()
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		b.sugar.Warnw("FEED: listening for order events failed, retrying", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(feedListenRetry):
+		}
+	}
+}
+
+// Replay returns the events following afterID which are still in the log, with their orders
+func (b *OrderBroadcaster) Replay(ctx context.Context, afterID int64) ([]OrderEvent, error) {
+	events, err := b.log.Since(ctx, afterID, b.history)
+	if err != nil {
+		// the log lives in redis next to the cache
+		return nil, fmt.Errorf("%w: %w", ErrCacheUnavailable, err)
+	}
+	var orderUIDs []string
+	for _, ev := range events {
+		if ev.Type == OrderStored {
+			orderUIDs = append(orderUIDs, ev.OrderUID)
+		}
+	}
+	if len(orderUIDs) == 0 {
+		return events, nil
+	}
+	orders, err := b.reader.GetOrders(ctx, orderUIDs, model.AllOrderParts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		events[i].Order = orders[events[i].OrderUID]
+	}
+	return events, nil
+}
+
+// publishResolved reads orders of queued events in batches and passes the events to local subscribers in order
+func (b *OrderBroadcaster) publishResolved(ctx context.Context, queue <-chan OrderEvent) {
+	for {
+		var batch []OrderEvent
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-queue:
+			batch = append(batch, ev)
+		}
+		// events which came in meanwhile are read together
+	drain:
+		for len(batch) < feedResolveBatch {
+			select {
+			case ev := <-queue:
+				batch = append(batch, ev)
+			default:
+				break drain
+			}
+		}
+		if b.feed.Subscribers() == 0 {
+			continue
+		}
+		for _, ev := range b.resolve(ctx, batch) {
+			b.feed.Publish(ev)
+		}
+	}
+}
+
+// resolve reads the orders of stored events, events stay bare if their orders can't be read
+func (b *OrderBroadcaster) resolve(ctx context.Context, events []OrderEvent) []OrderEvent {
+	var orderUIDs []string
+	for _, ev := range events {
+		if ev.Type == OrderStored && ev.Order == nil {
+			orderUIDs = append(orderUIDs, ev.OrderUID)
+		}
+	}
+	if len(orderUIDs) == 0 {
+		return events
+	}
+	ctx, cancel := context.WithTimeout(ctx, feedResolveTimeout)
+	defer cancel()
+	orders, err := b.reader.GetOrders(ctx, orderUIDs, model.AllOrderParts)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			b.sugar.Warnw("FEED: couldn't read orders of events", "count", len(orderUIDs), "error", err)
+		}
+		return events
+	}
+	for i := range events {
+		if events[i].Type == OrderStored && events[i].Order == nil {
+			events[i].Order = orders[events[i].OrderUID]
+		}
+	}
+	return events
+}
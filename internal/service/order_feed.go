@@ -0,0 +1,131 @@
+package service
+
+import (
+	"MockOrderService/internal/domain/model"
+	"sync"
+	"time"
+)
+
+const (
+	// OrderStored is published once an order is saved to db or to the spool.
+	// Orders delivered again are published again, db keeps the first copy.
+	OrderStored = "stored"
+	// OrderErased is published for every order anonymised by a customer erasure, Order is nil
+	OrderErased = "erased"
+)
+
+// OrderEvent tells subscribers of OrderFeed about a new or changed order
+type OrderEvent struct {
+	// ID is assigned by the event log and grows with every event, 0 if the event never reached the log
+	ID       int64
+	Type     string
+	OrderUID string
+	// Order is the stored order, nil for erasures
+	Order *model.Order
+	At    time.Time
+}
+
+// OrderEventFilter selects events for a subscriber, zero fields don't filter
+type OrderEventFilter struct {
+	CustomerID      string
+	DeliveryService string
+	Locale          string
+	// ItemStatus matches orders with at least one item in the status
+	ItemStatus *int32
+}
+
+// Match tells if the subscriber wants ev.
+// Erasures carry no personal data and match any filter, so subscribers can drop erased orders they show.
+// Stored events whose order couldn't be read only match an empty filter.
+func (f OrderEventFilter) Match(ev OrderEvent) bool {
+	if ev.Type == OrderErased {
+		return true
+	}
+	order := ev.Order
+	if order == nil {
+		return f == OrderEventFilter{}
+	}
+	if f.CustomerID != "" && order.CustomerID != f.CustomerID {
+		return false
+	}
+	if f.DeliveryService != "" && order.DeliveryService != f.DeliveryService {
+		return false
+	}
+	if f.Locale != "" && order.Locale != f.Locale {
+		return false
+	}
+	if f.ItemStatus != nil {
+		for _, item := range order.Items {
+			if item.Status != nil && *item.Status == *f.ItemStatus {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// OrderFeed fans order events out to subscribers of this process.
+// Publishing never blocks: a subscriber whose buffer is full is dropped and its channel is closed.
+type OrderFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan OrderEvent]struct{}
+}
+
+func NewOrderFeed() *OrderFeed {
+	return &OrderFeed{subscribers: make(map[chan OrderEvent]struct{})}
+}
+
+// Subscribe returns a channel of events published from now on and a function to unsubscribe.
+// The channel is closed on unsubscribe or if the subscriber falls more than buffer events behind.
+func (f *OrderFeed) Subscribe(buffer int) (<-chan OrderEvent, func()) {
+	ch := make(chan OrderEvent, buffer)
+	f.mu.Lock()
+	f.subscribers[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch, func() { f.drop(ch) }
+}
+
+// Publish passes ev to every subscriber
+func (f *OrderFeed) Publish(ev OrderEvent) {
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// slow subscribers must not hold up order processing
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribers returns the amount of current subscribers
+func (f *OrderFeed) Subscribers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers)
+}
+
+// DropAll closes the channels of all subscribers, like falling behind, so they resume from the log
+func (f *OrderFeed) DropAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (f *OrderFeed) drop(ch chan OrderEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subscribers[ch]; ok {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+}
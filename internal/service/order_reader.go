@@ -0,0 +1,111 @@
+package service
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCacheUnavailable = errors.New("cache is unavailable")
+	ErrDBUnavailable    = errors.New("database is unavailable")
+	// ErrCacheEntryBroken is reported along with redis.Nil for cached orders which can't be decoded or decrypted
+	ErrCacheEntryBroken = errors.New("cached order can't be decoded")
+)
+
+type OrderReaderRepository interface {
+	GetOrderByOrderUID(ctx context.Context, orderUID string, parts model.OrderParts) (*model.Order, error)
+	GetOrdersByOrderUIDs(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error)
+}
+
+type OrderReaderCache interface {
+	GetOrder(ctx context.Context, orderUID string) (*model.Order, error)
+	GetOrders(ctx context.Context, orderUIDs []string) (map[string]*model.Order, error)
+}
+
+// OrderReader reads orders from cache first and from db on a miss.
+// It's shared by the HTTP and gRPC APIs.
+type OrderReader struct {
+	sugar     *zap.SugaredLogger
+	orderRepo OrderReaderRepository
+	cacheRepo OrderReaderCache
+}
+
+func NewOrderReader(sugar *zap.SugaredLogger, orderRepo OrderReaderRepository, cacheRepo OrderReaderCache) *OrderReader {
+	return &OrderReader{
+		sugar:     sugar,
+		orderRepo: orderRepo,
+		cacheRepo: cacheRepo,
+	}
+}
+
+// GetOrder reads an order from cache or db. Sub-resources not in parts may be absent.
+// An unknown order is reported with pgx.ErrNoRows.
+func (or *OrderReader) GetOrder(ctx context.Context, orderUID string, parts model.OrderParts) (*model.Order, error) {
+	// try redis first
+	val, err := or.cacheRepo.GetOrder(ctx, orderUID)
+	if err != nil {
+		// key no found
+		if errors.Is(err, redis.Nil) {
+			if errors.Is(err, ErrCacheEntryBroken) {
+				or.sugar.Warnw("broken cached order, reading it from db", "orderUID", orderUID, "error", err)
+			}
+			// try from db
+			order, err := or.orderRepo.GetOrderByOrderUID(ctx, orderUID, parts)
+			if err != nil {
+				return nil, ClassifyDBError(err)
+			}
+			return order, nil
+		} else {
+			return nil, fmt.Errorf("%w: %w", ErrCacheUnavailable, err)
+		}
+	}
+	return val, nil
+
+}
+
+// GetOrders reads orders from cache and fetches only the misses from db.
+// Unknown orders are absent from the result.
+func (or *OrderReader) GetOrders(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error) {
+	orders, err := or.cacheRepo.GetOrders(ctx, orderUIDs)
+	if err != nil {
+		// cache is optional here, db has everything
+		or.sugar.Warnw("batch cache read failed", "error", err)
+		orders = make(map[string]*model.Order, len(orderUIDs))
+	}
+
+	var misses []string
+	for _, orderUID := range orderUIDs {
+		if _, ok := orders[orderUID]; !ok {
+			misses = append(misses, orderUID)
+		}
+	}
+	if len(misses) == 0 {
+		return orders, nil
+	}
+
+	stored, err := or.orderRepo.GetOrdersByOrderUIDs(ctx, misses, parts)
+	if err != nil {
+		return nil, ClassifyDBError(err)
+	}
+	for orderUID, order := range stored {
+		orders[orderUID] = order
+	}
+	return orders, nil
+}
+
+// ClassifyDBError marks errors of an unreachable database with ErrDBUnavailable.
+// Errors reported by the database itself (and pgx.ErrNoRows) and ended contexts are returned as is.
+func ClassifyDBError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrDBUnavailable, err)
+}
@@ -2,11 +2,18 @@ package service
 
 import (
 	"MockOrderService/internal/domain/model"
+	"MockOrderService/internal/encryption"
+	"MockOrderService/internal/tracing"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
@@ -20,17 +27,57 @@ type CacheRepository interface {
 	IsCacheEmpty(ctx context.Context) (bool, error)
 }
 
+// OrderSpool is a durable local log used to keep orders while the database is unavailable
+type OrderSpool interface {
+	ID() string
+	Append(data []byte) error
+	Pending() int
+	Replay(ctx context.Context, fn func(data []byte) error) (int, error)
+}
+
+// SpoolRegistry shares the pending records of spools between replicas, erasures wait until every spool is empty
+type SpoolRegistry interface {
+	ReportPending(ctx context.Context, spoolID string, pending int) error
+}
+
+// OrderEventPublisher tells watchers about stored orders, see OrderBroadcaster
+type OrderEventPublisher interface {
+	Publish(ev OrderEvent)
+}
+
 type OrderService struct {
 	sugar     *zap.SugaredLogger
 	orderRepo OrderRepository
 	cacheRepo CacheRepository
+	spool     OrderSpool
+	registry  SpoolRegistry
+	// reportMu guards reported, the pending records last reported to registry, -1 if unknown
+	reportMu sync.Mutex
+	reported int
+	// keyring encrypts personal data of deliveries in the spool, nil spools it as plaintext
+	keyring *encryption.Keyring
+	events  OrderEventPublisher
+}
+
+// spooledOrder is a spool record, Envelope is set if the delivery is encrypted
+type spooledOrder struct {
+	*model.Order
+	Envelope *encryption.Envelope `json:"envelope,omitempty"`
 }
 
-func NewOrderService(sugar *zap.SugaredLogger, orderRepo OrderRepository, cacheRepo CacheRepository) *OrderService {
+// NewOrderService creates a new order service.
+// spool is optional: if it's nil, degraded (write-behind) mode is disabled. registry and keyring are optional as well.
+// events is optional too: if it's set, every stored order is published to it.
+func NewOrderService(sugar *zap.SugaredLogger, orderRepo OrderRepository, cacheRepo CacheRepository, spool OrderSpool, registry SpoolRegistry, keyring *encryption.Keyring, events OrderEventPublisher) *OrderService {
 	return &OrderService{
 		sugar:     sugar,
 		orderRepo: orderRepo,
 		cacheRepo: cacheRepo,
+		spool:     spool,
+		registry:  registry,
+		reported:  -1,
+		keyring:   keyring,
+		events:    events,
 	}
 }
 func (s *OrderService) HeatUpCache(ctx context.Context) {
@@ -72,18 +119,165 @@ func (s *OrderService) HeatUpCache(ctx context.Context) {
 // Business rules imply that we should commit the message after it being saved to db, regardless of caching.
 // So error is returned in case of failure to save the order to db.
 // But there is no returning error in case of failure to save the order to cache.
-func (s *OrderService) ProcessOrder(ctx context.Context, order *model.Order) error {
-	err := s.orderRepo.SaveOrder(ctx, order)
+// In degraded mode (spool is set) an unavailable db is not an error: the order is written to the spool instead,
+// and it's considered saved once the spool write is fsynced.
+func (s *OrderService) ProcessOrder(ctx context.Context, order *model.Order) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "OrderService.ProcessOrder", trace.WithAttributes(attribute.String("order.uid", order.OrderUID)))
+	defer func() { tracing.End(span, err) }()
+
+	// orders must reach the db in the same order, so nothing bypasses the spool until it's drained
+	if s.spool != nil && s.spool.Pending() > 0 {
+		return s.spoolOrder(ctx, order)
+	}
+
+	err = s.orderRepo.SaveOrder(ctx, order)
 	if err != nil {
-		return fmt.Errorf("failed to save message to db – orderUID: %v – err: %w", order.OrderUID, err)
+		if s.spool == nil || !isUnavailable(err) {
+			return fmt.Errorf("failed to save message to db – orderUID: %v – err: %w", order.OrderUID, err)
+		}
+		s.sugar.Warnw("db is unavailable, switching to spool", "orderUID", order.OrderUID, "error", err)
+		return s.spoolOrder(ctx, order)
 	}
 	s.sugar.Infow("order was saved to db", "orderUID", order.OrderUID)
 
-	err = s.cacheRepo.SaveOrder(ctx, order)
+	s.cacheOrder(ctx, order)
+	s.publishStored(order)
+	return nil
+}
+
+// spoolOrder appends the order to the spool and caches it, so it stays readable until it's flushed to db.
+// The delivery is encrypted like in db and cache, so the spool isn't a plaintext copy of personal data.
+func (s *OrderService) spoolOrder(ctx context.Context, order *model.Order) error {
+	record := spooledOrder{Order: order}
+	if s.keyring != nil && order.Delivery != nil {
+		sealed := *order
+		delivery, env, err := s.keyring.SealDelivery(order.OrderUID, order.Delivery)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt delivery for spool – orderUID: %v – err: %w", order.OrderUID, err)
+		}
+		sealed.Delivery = delivery
+		record = spooledOrder{Order: &sealed, Envelope: env}
+	}
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal order for spool – orderUID: %v – err: %w", order.OrderUID, err)
+	}
+	if err = s.spool.Append(data); err != nil {
+		return fmt.Errorf("failed to save message to spool – orderUID: %v – err: %w", order.OrderUID, err)
+	}
+	s.sugar.Infow("order was saved to spool", "orderUID", order.OrderUID, "pending", s.spool.Pending())
+	s.reportSpool(ctx)
+
+	s.cacheOrder(ctx, order)
+	s.publishStored(order)
+	return nil
+}
+
+// FlushSpool periodically moves spooled orders to db in the order they were received.
+// Flushing stops at the first unavailable-db error and is retried on the next tick.
+func (s *OrderService) FlushSpool(ctx context.Context, interval time.Duration) {
+	if s.spool == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// also repeats a report which failed
+			s.reportSpool(ctx)
+			if s.spool.Pending() == 0 {
+				continue
+			}
+			flushed, err := s.spool.Replay(ctx, func(data []byte) error {
+				var record spooledOrder
+				if err := json.Unmarshal(data, &record); err != nil || record.Order == nil {
+					// can't happen unless the spool is tampered with, skipping is the only way forward
+					s.sugar.Errorw("SPOOL: dropping unreadable record", "error", err, "size", len(data))
+					return nil
+				}
+				order := record.Order
+				if record.Envelope != nil && order.Delivery != nil {
+					// kept pending: the order is fine, the keyfile has to be fixed
+					if s.keyring == nil {
+						err := fmt.Errorf("spooled order %s is encrypted, but no keyring is configured", order.OrderUID)
+						s.sugar.Errorw("SPOOL: can't decrypt spooled order", "orderUID", order.OrderUID, "error", err)
+						return err
+					}
+					if err := s.keyring.OpenDelivery(order.OrderUID, order.Delivery, record.Envelope); err != nil {
+						s.sugar.Errorw("SPOOL: can't decrypt spooled order", "orderUID", order.OrderUID, "error", err)
+						return err
+					}
+				}
+				if err := s.orderRepo.SaveOrder(ctx, order); err != nil {
+					if isUnavailable(err) {
+						return err
+					}
+					// db rejected the order, keeping it would block the spool forever
+					s.sugar.Errorw("SPOOL: db rejected spooled order, dropping it",
+						"orderUID", order.OrderUID, "error", err)
+					return nil
+				}
+				s.sugar.Infow("SPOOL: order was flushed to db", "orderUID", order.OrderUID)
+				return nil
+			})
+			s.reportSpool(ctx)
+			if err != nil {
+				s.sugar.Warnw("SPOOL: flush interrupted", "flushed", flushed, "pending", s.spool.Pending(), "error", err)
+				continue
+			}
+			s.sugar.Infow("SPOOL: flush completed", "flushed", flushed)
+		}
+	}
+}
+
+// reportSpool tells the registry how many records are pending in the spool, if it changed since the last report
+func (s *OrderService) reportSpool(ctx context.Context) {
+	if s.registry == nil {
+		return
+	}
+	s.reportMu.Lock()
+	defer s.reportMu.Unlock()
+	pending := s.spool.Pending()
+	if pending == s.reported {
+		return
+	}
+	if err := s.registry.ReportPending(ctx, s.spool.ID(), pending); err != nil {
+		s.sugar.Warnw("SPOOL: couldn't report pending records, other replicas may erase customers with spooled orders", "pending", pending, "error", err)
+		s.reported = -1
+		return
+	}
+	s.reported = pending
+}
+
+// isUnavailable reports whether err means that db couldn't be reached,
+// as opposed to db receiving the query and rejecting it
+func isUnavailable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	return !errors.As(err, &pgErr)
+}
+
+// cacheOrder saves order to cache, failures are only logged
+func (s *OrderService) cacheOrder(ctx context.Context, order *model.Order) {
+	err := s.cacheRepo.SaveOrder(ctx, order)
 	if err != nil {
 		s.sugar.Errorw("failed to cache order", "orderUID", order.OrderUID, "error", err)
-		return nil
+		return
 	}
 	s.sugar.Infow("order was cached", "orderUID", order.OrderUID)
-	return nil
+}
+
+// publishStored tells watchers about the order.
+// Spooled orders are published once spooled, flushing them to db isn't a new event.
+func (s *OrderService) publishStored(order *model.Order) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(OrderEvent{Type: OrderStored, OrderUID: order.OrderUID, Order: order})
 }
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"MockOrderService/internal/domain/model"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ReconcileOrderRepository interface {
+	GetOrderByOrderUID(ctx context.Context, orderUID string, parts model.OrderParts) (*model.Order, error)
+}
+
+type ReconcileCacheRepository interface {
+	GetOrder(ctx context.Context, orderUID string) (*model.Order, error)
+	SaveOrder(ctx context.Context, order *model.Order) error
+	DeleteOrder(ctx context.Context, orderUID string) error
+	ScanOrderUIDs(ctx context.Context, fn func(orderUID string) error) error
+	SampleOrderUIDs(ctx context.Context, n int) ([]string, error)
+}
+
+// ReconcileReport describes a single reconciliation run
+type ReconcileReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Mode is "scan" for a full pass over the cache or "sample" for a random part of it
+	Mode     string `json:"mode"`
+	Checked  int    `json:"checked"`
+	Matched  int    `json:"matched"`
+	Repaired int    `json:"repaired"`
+	Evicted  int    `json:"evicted"`
+	Errors   int    `json:"errors"`
+	// MismatchedFields counts how many times each field differed, e.g. "payment.amount"
+	MismatchedFields map[string]int `json:"mismatched_fields"`
+	Skipped          string         `json:"skipped,omitempty"`
+}
+
+// ReconcileStats is the last report plus totals since the start
+type ReconcileStats struct {
+	Runs          int              `json:"runs"`
+	TotalChecked  int              `json:"total_checked"`
+	TotalRepaired int              `json:"total_repaired"`
+	TotalEvicted  int              `json:"total_evicted"`
+	TotalErrors   int              `json:"total_errors"`
+	LastRun       *ReconcileReport `json:"last_run,omitempty"`
+}
+
+// Reconciler finds drift between cached orders and db.
+// Mismatched cache entries are overwritten with the db version, entries missing in db are evicted.
+type Reconciler struct {
+	sugar      *zap.SugaredLogger
+	orderRepo  ReconcileOrderRepository
+	cacheRepo  ReconcileCacheRepository
+	spool      OrderSpool
+	sampleSize int
+
+	runMu   sync.Mutex
+	statsMu sync.RWMutex
+	stats   ReconcileStats
+}
+
+// NewReconciler creates a new reconciler.
+// sampleSize > 0 checks that many random cached orders per run, otherwise the whole cache is scanned.
+// spool is optional, while it has pending orders reconciliation is skipped since cache is ahead of db on purpose.
+func NewReconciler(sugar *zap.SugaredLogger, orderRepo ReconcileOrderRepository, cacheRepo ReconcileCacheRepository, spool OrderSpool, sampleSize int) *Reconciler {
+	return &Reconciler{
+		sugar:      sugar,
+		orderRepo:  orderRepo,
+		cacheRepo:  cacheRepo,
+		spool:      spool,
+		sampleSize: sampleSize,
+	}
+}
+
+// Start runs reconciliation every interval until ctx is canceled
+func (r *Reconciler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Run(ctx); err != nil {
+				r.sugar.Errorw("RECONCILE: run failed", "error", err)
+			}
+		}
+	}
+}
+
+// Stats returns reconciliation statistics
+func (r *Reconciler) Stats() ReconcileStats {
+	r.statsMu.RLock()
+	defer r.statsMu.RUnlock()
+	return r.stats
+}
+
+// Run performs a single reconciliation pass. Concurrent calls are serialized.
+func (r *Reconciler) Run(ctx context.Context) (*ReconcileReport, error) {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	report := &ReconcileReport{
+		StartedAt:        time.Now(),
+		Mode:             "scan",
+		MismatchedFields: make(map[string]int),
+	}
+	if r.sampleSize > 0 {
+		report.Mode = "sample"
+	}
+
+	var err error
+	if r.spool != nil && r.spool.Pending() > 0 {
+		report.Skipped = "spool has pending orders"
+	} else if r.sampleSize > 0 {
+		var orderUIDs []string
+		orderUIDs, err = r.cacheRepo.SampleOrderUIDs(ctx, r.sampleSize)
+		for _, orderUID := range orderUIDs {
+			if ctx.Err() != nil {
+				break
+			}
+			r.reconcileOrder(ctx, orderUID, report)
+		}
+	} else {
+		err = r.cacheRepo.ScanOrderUIDs(ctx, func(orderUID string) error {
+			r.reconcileOrder(ctx, orderUID, report)
+			return ctx.Err()
+		})
+	}
+	report.FinishedAt = time.Now()
+
+	r.statsMu.Lock()
+	r.stats.Runs++
+	r.stats.TotalChecked += report.Checked
+	r.stats.TotalRepaired += report.Repaired
+	r.stats.TotalEvicted += report.Evicted
+	r.stats.TotalErrors += report.Errors
+	r.stats.LastRun = report
+	r.statsMu.Unlock()
+
+	if err != nil {
+		return report, fmt.Errorf("cache iteration failed: %w", err)
+	}
+	r.sugar.Infow("RECONCILE: run completed", "mode", report.Mode, "checked", report.Checked,
+		"repaired", report.Repaired, "evicted", report.Evicted, "errors", report.Errors)
+	return report, nil
+}
+
+// reconcileOrder compares one cached order with db and fixes the cache if needed
+func (r *Reconciler) reconcileOrder(ctx context.Context, orderUID string, report *ReconcileReport) {
+	cached, err := r.cacheRepo.GetOrder(ctx, orderUID)
+	if err != nil {
+		// expired between listing and reading
+		if errors.Is(err, redis.Nil) && !errors.Is(err, ErrCacheEntryBroken) {
+			return
+		}
+		// unreadable payload is a drift too, the cache has already dropped it
+		r.sugar.Warnw("RECONCILE: failed to read cached order", "orderUID", orderUID, "error", err)
+		cached = nil
+	}
+	report.Checked++
+
+	stored, err := r.orderRepo.GetOrderByOrderUID(ctx, orderUID, model.AllOrderParts)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			report.Errors++
+			r.sugar.Errorw("RECONCILE: failed to get order from db", "orderUID", orderUID, "error", err)
+			return
+		}
+		if err = r.cacheRepo.DeleteOrder(ctx, orderUID); err != nil {
+			report.Errors++
+			r.sugar.Errorw("RECONCILE: failed to evict order", "orderUID", orderUID, "error", err)
+			return
+		}
+		report.Evicted++
+		r.sugar.Warnw("RECONCILE: evicted order missing in db", "orderUID", orderUID)
+		return
+	}
+
+	var mismatches []string
+	if cached == nil {
+		mismatches = []string{"payload"}
+	} else {
+		mismatches = diffOrders(cached, stored)
+	}
+	if len(mismatches) == 0 {
+		report.Matched++
+		return
+	}
+	for _, field := range mismatches {
+		report.MismatchedFields[field]++
+	}
+
+	if err = r.cacheRepo.SaveOrder(ctx, stored); err != nil {
+		report.Errors++
+		r.sugar.Errorw("RECONCILE: failed to repair cached order", "orderUID", orderUID, "error", err)
+		return
+	}
+	report.Repaired++
+	r.sugar.Warnw("RECONCILE: repaired cached order", "orderUID", orderUID, "fields", mismatches)
+}
+
+// diffOrders returns json names of business fields which differ between two orders.
+// Surrogate ids and created_at timestamps are generated by db and not compared.
+func diffOrders(a, b *model.Order) []string {
+	var diff []string
+	diff = diffStructs("", reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), diff)
+
+	switch {
+	case (a.Delivery == nil) != (b.Delivery == nil):
+		diff = append(diff, "delivery")
+	case a.Delivery != nil:
+		diff = diffStructs("delivery.", reflect.ValueOf(a.Delivery).Elem(), reflect.ValueOf(b.Delivery).Elem(), diff)
+	}
+
+	switch {
+	case (a.Payment == nil) != (b.Payment == nil):
+		diff = append(diff, "payment")
+	case a.Payment != nil:
+		diff = diffStructs("payment.", reflect.ValueOf(a.Payment).Elem(), reflect.ValueOf(b.Payment).Elem(), diff)
+	}
+
+	// items are matched by rid, which is unique within an order
+	if len(a.Items) != len(b.Items) {
+		return append(diff, "items")
+	}
+	byRid := make(map[string]*model.Item, len(b.Items))
+	for _, item := range b.Items {
+		byRid[item.Rid] = item
+	}
+	for _, item := range a.Items {
+		other, ok := byRid[item.Rid]
+		if !ok {
+			return append(diff, "items")
+		}
+		diff = diffStructs("items.", reflect.ValueOf(item).Elem(), reflect.ValueOf(other).Elem(), diff)
+	}
+	return diff
+}
+
+var timePtrType = reflect.TypeOf((*time.Time)(nil))
+
+// diffStructs compares scalar fields of two structs of the same type and appends json names of different ones
+func diffStructs(prefix string, a, b reflect.Value, diff []string) []string {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		switch {
+		case field.Name == "ID", field.Name == "CreatedAt":
+			continue
+		case field.Name == "OrderUID" && prefix != "":
+			// nested entities inherit it from the order, producers often leave it empty
+			continue
+		}
+		kind := field.Type.Kind()
+		if kind == reflect.Slice || (kind == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct && field.Type != timePtrType) {
+			// nested entities are compared separately
+			continue
+		}
+
+		av, bv := a.Field(i), b.Field(i)
+		equal := false
+		if field.Type == timePtrType {
+			equal = av.IsNil() == bv.IsNil() && (av.IsNil() || av.Interface().(*time.Time).Equal(*bv.Interface().(*time.Time)))
+		} else {
+			equal = reflect.DeepEqual(av.Interface(), bv.Interface())
+		}
+		if !equal {
+			diff = append(diff, prefix+jsonName(field))
+		}
+	}
+	return diff
+}
+
+func jsonName(field reflect.StructField) string {
+	tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if tag == "" {
+		return field.Name
+	}
+	return tag
+}
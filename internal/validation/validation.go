@@ -2,22 +2,34 @@ package validation
 
 import (
 	"MockOrderService/internal/domain/model"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 	"time"
 )
 
+// FieldProblem is a single validation problem.
+// Field is a JSON pointer to the offending field, e.g. "/delivery/zip" or "/items/0/price".
+type FieldProblem struct {
+	Field   string
+	Message string
+}
+
 type validationError struct {
-	Problems []string
+	Problems []FieldProblem
 }
 
-func (v *validationError) Add(format string, args ...interface{}) {
-	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+func (v *validationError) Add(field string, format string, args ...interface{}) {
+	v.Problems = append(v.Problems, FieldProblem{Field: field, Message: fmt.Sprintf(format, args...)})
 }
 
 func (v *validationError) Error() string {
-	return strings.Join(v.Problems, "; ")
+	messages := make([]string, 0, len(v.Problems))
+	for _, p := range v.Problems {
+		messages = append(messages, p.Message)
+	}
+	return strings.Join(messages, "; ")
 }
 
 func (v *validationError) Empty() bool {
@@ -35,85 +47,85 @@ func ValidateOrder(order *model.Order) error {
 
 	// ---- BASIC REQUIRED FIELDS ----
 	if strings.TrimSpace(order.OrderUID) == "" {
-		verr.Add("order_uid is required")
+		verr.Add("/order_uid", "order_uid is required")
 	}
 	if strings.TrimSpace(order.TrackNumber) == "" {
-		verr.Add("track_number is required")
+		verr.Add("/track_number", "track_number is required")
 	}
 	// Locale is optional but if provided, check length
 	if order.Locale != "" && len(order.Locale) > 10 {
-		verr.Add("locale seems invalid: %q", order.Locale)
+		verr.Add("/locale", "locale seems invalid: %q", order.Locale)
 	}
 
 	// SmID if present should be non-negative
 	if order.SmID != nil && *order.SmID < 0 {
-		verr.Add("sm_id must be non-negative")
+		verr.Add("/sm_id", "sm_id must be non-negative")
 	}
 
 	// ---- DELIVERY ----
 	if order.Delivery == nil {
-		verr.Add("delivery is required")
+		verr.Add("/delivery", "delivery is required")
 	} else {
 		d := order.Delivery
 		if strings.TrimSpace(d.Name) == "" {
-			verr.Add("delivery.name is required")
+			verr.Add("/delivery/name", "delivery.name is required")
 		}
 		if strings.TrimSpace(d.Address) == "" {
-			verr.Add("delivery.address is required")
+			verr.Add("/delivery/address", "delivery.address is required")
 		}
 		if strings.TrimSpace(d.City) == "" {
-			verr.Add("delivery.city is required")
+			verr.Add("/delivery/city", "delivery.city is required")
 		}
 		// Russian zip: 6 digits typical
 		if strings.TrimSpace(d.Zip) == "" {
-			verr.Add("delivery.zip is required")
+			verr.Add("/delivery/zip", "delivery.zip is required")
 		} else if !isValidZip(d.Zip) {
-			verr.Add("delivery.zip invalid: %q", d.Zip)
+			verr.Add("/delivery/zip", "delivery.zip invalid: %q", d.Zip)
 		}
 		// Phone logger (loose, supports +7 and common separators)
 		if strings.TrimSpace(d.Phone) == "" {
-			verr.Add("delivery.phone is required")
+			verr.Add("/delivery/phone", "delivery.phone is required")
 		} else if !isValidPhone(d.Phone) {
-			verr.Add("delivery.phone invalid: %q", d.Phone)
+			verr.Add("/delivery/phone", "delivery.phone invalid: %q", d.Phone)
 		}
 		// Email optional but validate if present
 		if d.Email != "" && !isValidEmail(d.Email) {
-			verr.Add("delivery.email invalid: %q", d.Email)
+			verr.Add("/delivery/email", "delivery.email invalid: %q", d.Email)
 		}
 	}
 
 	// ---- PAYMENT ----
 	if order.Payment == nil {
-		verr.Add("payment is required")
+		verr.Add("/payment", "payment is required")
 	} else {
 		p := order.Payment
 		// amount required (pointer) in many models — check presence
 		if p.Amount == nil {
-			verr.Add("payment.amount is required")
+			verr.Add("/payment/amount", "payment.amount is required")
 		} else {
 			if *p.Amount < 0 {
-				verr.Add("payment.amount must be >= 0")
+				verr.Add("/payment/amount", "payment.amount must be >= 0")
 			}
 		}
 		// goods_total and delivery_cost presence recommended (but optional)
 		if p.GoodsTotal != nil && *p.GoodsTotal < 0 {
-			verr.Add("payment.goods_total must be >= 0")
+			verr.Add("/payment/goods_total", "payment.goods_total must be >= 0")
 		}
 		if p.DeliveryCost != nil && *p.DeliveryCost < 0 {
-			verr.Add("payment.delivery_cost must be >= 0")
+			verr.Add("/payment/delivery_cost", "payment.delivery_cost must be >= 0")
 		}
 		if p.CustomFee != nil && *p.CustomFee < 0 {
-			verr.Add("payment.custom_fee must be >= 0")
+			verr.Add("/payment/custom_fee", "payment.custom_fee must be >= 0")
 		}
 		// payment_dt should be reasonable (epoch seconds)
 		if p.PaymentDt != nil {
 			if *p.PaymentDt <= 0 {
-				verr.Add("payment.payment_dt must be a positive epoch")
+				verr.Add("/payment/payment_dt", "payment.payment_dt must be a positive epoch")
 			} else {
 				// not too far in future
 				t := time.Unix(*p.PaymentDt, 0)
 				if t.After(time.Now().Add(24 * time.Hour)) {
-					verr.Add("payment.payment_dt is in the future: %v", t)
+					verr.Add("/payment/payment_dt", "payment.payment_dt is in the future: %v", t)
 				}
 			}
 		}
@@ -122,18 +134,22 @@ func ValidateOrder(order *model.Order) error {
 	// ---- ITEMS ----
 	if len(order.Items) == 0 {
 		// many business rules expect at least one item
-		verr.Add("items must contain at least one item")
+		verr.Add("/items", "items must contain at least one item")
 	} else {
 		seenRID := make(map[string]struct{})
 		var sumItemTotals int64 = 0
 		for i := range order.Items {
 			it := order.Items[i]
 			idx := i + 1
+			if it == nil {
+				verr.Add(fmt.Sprintf("/items/%d", i), "items[%d] is null", idx)
+				continue
+			}
 			if strings.TrimSpace(it.Rid) == "" {
-				verr.Add("items[%d].rid is required", idx)
+				verr.Add(itemField(i, "rid"), "items[%d].rid is required", idx)
 			} else {
 				if _, ok := seenRID[it.Rid]; ok {
-					verr.Add("items[%d].rid duplicated: %q", idx, it.Rid)
+					verr.Add(itemField(i, "rid"), "items[%d].rid duplicated: %q", idx, it.Rid)
 				}
 				seenRID[it.Rid] = struct{}{}
 			}
@@ -142,33 +158,33 @@ func ValidateOrder(order *model.Order) error {
 			if it.Price != nil {
 				priceVal = *it.Price
 				if priceVal < 0 {
-					verr.Add("items[%d].price must be >= 0", idx)
+					verr.Add(itemField(i, "price"), "items[%d].price must be >= 0", idx)
 				}
 			} else {
-				verr.Add("items[%d].price is nil", idx)
+				verr.Add(itemField(i, "price"), "items[%d].price is nil", idx)
 			}
 			var totalVal int64
 			if it.TotalPrice != nil {
 				totalVal = *it.TotalPrice
 				if totalVal < 0 {
-					verr.Add("items[%d].total_price must be >= 0", idx)
+					verr.Add(itemField(i, "total_price"), "items[%d].total_price must be >= 0", idx)
 				}
 			} else {
-				verr.Add("items[%d].total_price is nil", idx)
+				verr.Add(itemField(i, "total_price"), "items[%d].total_price is nil", idx)
 			}
 			// Simple sanity: totalPrice should be <= price * some factor (we don't know count, but usually total <= price)
 			// We just check totalVal not wildly bigger than priceVal * 1000 as heuristic
 			if priceVal > 0 && totalVal > priceVal*1000 {
-				verr.Add("items[%d].total_price seems unrealistically large (price=%d total_price=%d)", idx, priceVal, totalVal)
+				verr.Add(itemField(i, "total_price"), "items[%d].total_price seems unrealistically large (price=%d total_price=%d)", idx, priceVal, totalVal)
 			}
 			if it.Sale != nil {
 				if *it.Sale < 0 || *it.Sale > 100 {
-					verr.Add("items[%d].sale must be between 0 and 100", idx)
+					verr.Add(itemField(i, "sale"), "items[%d].sale must be between 0 and 100", idx)
 				}
 			}
 			if it.Status != nil {
 				if *it.Status < 0 {
-					verr.Add("items[%d].status must be non-negative", idx)
+					verr.Add(itemField(i, "status"), "items[%d].status must be non-negative", idx)
 				}
 			}
 			// accumulate sum of total prices if available
@@ -178,7 +194,7 @@ func ValidateOrder(order *model.Order) error {
 		// Compare items sum with payment.goods_total if payment data present
 		if order.Payment != nil && order.Payment.GoodsTotal != nil {
 			if sumItemTotals != *order.Payment.GoodsTotal {
-				verr.Add("sum(items.total_price) = %d does not equal payment.goods_total = %d", sumItemTotals, *order.Payment.GoodsTotal)
+				verr.Add("/payment/goods_total", "sum(items.total_price) = %d does not equal payment.goods_total = %d", sumItemTotals, *order.Payment.GoodsTotal)
 			}
 		}
 	}
@@ -200,7 +216,7 @@ func ValidateOrder(order *model.Order) error {
 			// use computed sumItemTotals
 			var sumComputed int64
 			for i := range order.Items {
-				if order.Items[i].TotalPrice != nil {
+				if order.Items[i] != nil && order.Items[i].TotalPrice != nil {
 					sumComputed += *order.Items[i].TotalPrice
 				}
 			}
@@ -214,7 +230,7 @@ func ValidateOrder(order *model.Order) error {
 		}
 		// Compare payment.Amount with expected if expected > 0
 		if expected > 0 && *order.Payment.Amount != expected {
-			verr.Add("payment.amount (%d) does not equal expected total (goods+delivery+custom = %d)", *order.Payment.Amount, expected)
+			verr.Add("/payment/amount", "payment.amount (%d) does not equal expected total (goods+delivery+custom = %d)", *order.Payment.Amount, expected)
 		}
 	}
 
@@ -222,7 +238,7 @@ func ValidateOrder(order *model.Order) error {
 	// DateCreated if present should be parseable / not future
 	if order.DateCreated != nil {
 		if order.DateCreated.After(time.Now().Add(1 * time.Hour)) {
-			verr.Add("date_created is in the future: %v", order.DateCreated)
+			verr.Add("/date_created", "date_created is in the future: %v", order.DateCreated)
 		}
 	}
 
@@ -235,6 +251,11 @@ func ValidateOrder(order *model.Order) error {
 
 // -- Helpers: simple validators --
 
+// itemField returns JSON pointer to a field of the i-th (zero-based) item
+func itemField(i int, name string) string {
+	return fmt.Sprintf("/items/%d/%s", i, name)
+}
+
 // isValidPhone validates common Russian phone formats like:
 // +7 (915) 123-45-67, +7 921 765-43-21, +7 903 222-11-00, +7XXXXXXXXXX
 func isValidPhone(s string) bool {
@@ -268,3 +289,12 @@ func isValidZip(zip string) bool {
 	re := regexp.MustCompile(`^\d{6}$`)
 	return re.MatchString(zip)
 }
+
+// Problems returns the list of field-level problems if err is a validation error, otherwise nil
+func Problems(err error) []FieldProblem {
+	var verr *validationError
+	if errors.As(err, &verr) {
+		return verr.Problems
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package validation
+
+import (
+	"MockOrderService/internal/domain/model"
+	"testing"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func validOrder() *model.Order {
+	return &model.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Delivery: &model.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+79720000000",
+			Zip:     "263980",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Email:   "test@gmail.com",
+		},
+		Payment: &model.Payment{Amount: ptr[int64](1817), GoodsTotal: ptr[int64](317), DeliveryCost: ptr[int64](1500)},
+		Items:   []*model.Item{{Rid: "ab4219087a764ae0btest", Price: ptr[int64](453), TotalPrice: ptr[int64](317)}},
+	}
+}
+
+func TestValidateOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(order *model.Order)
+		fields []string
+	}{
+		{"valid", func(*model.Order) {}, nil},
+		{"null item", func(o *model.Order) { o.Items = append(o.Items, nil) }, []string{"/items/1"}},
+		{"null item without goods total", func(o *model.Order) {
+			o.Payment.GoodsTotal = nil
+			o.Items = []*model.Item{nil}
+		}, []string{"/items/0", "/payment/amount"}},
+		{"no items", func(o *model.Order) { o.Items = nil }, []string{"/items"}},
+		{"duplicated rid", func(o *model.Order) {
+			o.Items = append(o.Items, &model.Item{Rid: o.Items[0].Rid, Price: ptr[int64](0), TotalPrice: ptr[int64](0)})
+		}, []string{"/items/1/rid"}},
+		{"invalid phone", func(o *model.Order) { o.Delivery.Phone = "12345" }, []string{"/delivery/phone"}},
+		{"no delivery", func(o *model.Order) { o.Delivery = nil }, []string{"/delivery"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := validOrder()
+			tt.change(order)
+			err := ValidateOrder(order)
+			problems := Problems(err)
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if len(problems) != len(tt.fields) {
+				t.Fatalf("expected problems of %v, got %+v", tt.fields, problems)
+			}
+			for i, field := range tt.fields {
+				if problems[i].Field != field {
+					t.Fatalf("expected problems of %v, got %+v", tt.fields, problems)
+				}
+			}
+		})
+	}
+}